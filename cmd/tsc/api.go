@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/utils"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	profileAPIPath      = "/api/profile"
+	optimumStartAPIPath = "/api/optimum-start"
+)
+
+// profileAPI switches heating profiles at runtime
+//
+//	GET    /api/profile           get global and room profiles
+//	PUT    /api/profile           switch global profile, body {"profile": "away"}
+//	PUT    /api/profile/<topic>   switch profile of the room
+//	DELETE /api/profile/<topic>   return the room to the global profile
+type profileAPI struct {
+	client MQTT.Client
+}
+
+// profileRequest is the body of the profile switch
+type profileRequest struct {
+	Profile string `json:"profile"`
+}
+
+func (api *profileAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	topic, err := url.PathUnescape(strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), profileAPIPath), "/"))
+	if err != nil {
+		utils.WriteError(w, utils.NewAPIError(http.StatusBadRequest, "invalid topic"))
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && topic == "":
+		utils.WriteJSON(w, http.StatusOK, getProfilesStatus())
+	case r.Method == http.MethodPut:
+		request, err := readProfileRequest(r.Body)
+		if err != nil {
+			utils.WriteError(w, err)
+			return
+		}
+		if topic == "" && request.Profile == "" {
+			utils.WriteError(w, utils.NewAPIError(http.StatusBadRequest, "profile: must not be empty"))
+			return
+		}
+		api.switchProfile(w, topic, request.Profile)
+	case r.Method == http.MethodDelete && topic != "":
+		api.switchProfile(w, topic, "")
+	default:
+		utils.WriteError(w, utils.NewAPIError(http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method)))
+	}
+}
+
+func (api *profileAPI) switchProfile(w http.ResponseWriter, topic string, name string) {
+	if err := switchProfile(api.client, topic, name, time.Now()); err != nil {
+		utils.WriteError(w, utils.NewAPIError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, getProfilesStatus())
+}
+
+func readProfileRequest(body io.Reader) (profileRequest, error) {
+	data, err := io.ReadAll(io.LimitReader(body, 1<<20))
+	if err != nil {
+		return profileRequest{}, utils.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	var request profileRequest
+	if err := config.DecodeJSON(data, &request); err != nil {
+		return profileRequest{}, utils.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	return request, nil
+}
+
+// optimumStartAPI shows learned heating models of the rooms with optimum start
+//
+//	GET /api/optimum-start           get heating models of all rooms
+//	GET /api/optimum-start/<topic>   get heating model of the room
+type optimumStartAPI struct{}
+
+func (optimumStartAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	topic, err := url.PathUnescape(strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), optimumStartAPIPath), "/"))
+	if err != nil {
+		utils.WriteError(w, utils.NewAPIError(http.StatusBadRequest, "invalid topic"))
+		return
+	}
+	if r.Method != http.MethodGet {
+		utils.WriteError(w, utils.NewAPIError(http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method)))
+		return
+	}
+	if topic == "" {
+		utils.WriteJSON(w, http.StatusOK, getHeatingModels(time.Now()))
+		return
+	}
+	scheduler, exist := getScheduler(topic)
+	if !exist || scheduler.OptimumStartMaxLead <= 0 {
+		utils.WriteError(w, utils.NewAPIError(http.StatusNotFound, fmt.Sprintf("optimum start of %s not configured", topic)))
+		return
+	}
+	utils.WriteJSON(w, http.StatusOK, getHeatingModel(scheduler, time.Now()))
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/pkg/ical"
+)
+
+// occurrences of the calendar events are expanded for this window around the evaluated time
+const (
+	calendarWindowBefore = 2 * 24 * time.Hour
+	calendarWindowAfter  = 35 * 24 * time.Hour
+)
+
+// Calendar maps events of a local iCalendar (.ics) file to setpoints or profiles of the schedulers
+type Calendar struct {
+	Path   string         `json:"path"`
+	Topics []string       `json:"topics,omitempty"` // schedulers of the calendar, all schedulers when empty
+	Rules  []CalendarRule `json:"rules"`            // the first rule matching the event applies
+}
+
+// CalendarRule maps matching events to a temperature or a profile
+type CalendarRule struct {
+	Summary     string   `json:"summary,omitempty"` // case-insensitive part of the event summary, every event when empty
+	Topics      []string `json:"topics,omitempty"`  // schedulers of the rule, schedulers of the calendar when empty
+	Temperature *float64 `json:"temperature,omitempty"`
+	Profile     string   `json:"profile,omitempty"` // schedulers without the profile keep their schedule
+}
+
+func (c *Calendar) Validate() error {
+	var errs config.Errors
+	errs.Append(config.MustNotBeEmpty("path", c.Path))
+	if len(c.Rules) == 0 {
+		errs.Append(config.FieldErr("rules", errors.New("must not be empty")))
+	}
+	return errs.Err()
+}
+
+func (r *CalendarRule) Validate() error {
+	if (r.Temperature != nil) == (r.Profile != "") {
+		return errors.New("exactly one of temperature or profile must be set")
+	}
+	return nil
+}
+
+// calendarEvent is an occurrence of the calendar event matched by a rule
+type calendarEvent struct {
+	Summary     string
+	Start       time.Time
+	End         time.Time // exclusive
+	AllDay      bool
+	Temperature *float64
+	Profile     string
+}
+
+// loadedCalendar holds events of the calendar file and their occurrences expanded for a window
+type loadedCalendar struct {
+	config   Calendar
+	events   []ical.Event
+	modTime  time.Time
+	size     int64
+	location *time.Location // time zone floating times of the events were read in
+
+	windowStart time.Time
+	windowEnd   time.Time
+	occurrences []calendarOccurrence
+}
+
+type calendarOccurrence struct {
+	event *ical.Event
+	ical.Occurrence
+}
+
+var (
+	calendars   []*loadedCalendar
+	calendarsMu sync.Mutex
+)
+
+// Read events of the calendar file when it or the installation time zone changed since the last read
+func (c *loadedCalendar) refresh() error {
+	info, err := os.Stat(c.config.Path)
+	if err != nil {
+		return err
+	}
+	location := installationLocation()
+	if info.ModTime().Equal(c.modTime) && info.Size() == c.size && location == c.location {
+		return nil
+	}
+	events, err := ical.ParseFile(c.config.Path, location)
+	if err != nil {
+		return err
+	}
+	log.Printf("Calendar %s loaded, %d event(s)", c.config.Path, len(events))
+	c.events, c.modTime, c.size, c.location = events, info.ModTime(), info.Size(), location
+	c.windowStart, c.windowEnd, c.occurrences = time.Time{}, time.Time{}, nil
+	return nil
+}
+
+// Get occurrences of the calendar events around given time
+func (c *loadedCalendar) occurrencesAround(t time.Time) []calendarOccurrence {
+	if t.Before(c.windowStart) || !t.Before(c.windowEnd) {
+		c.windowStart, c.windowEnd = t.Add(-calendarWindowBefore), t.Add(calendarWindowAfter)
+		c.occurrences = nil
+		for i := range c.events {
+			for _, occurrence := range c.events[i].Occurrences(c.windowStart, c.windowEnd) {
+				c.occurrences = append(c.occurrences, calendarOccurrence{event: &c.events[i], Occurrence: occurrence})
+			}
+		}
+	}
+	return c.occurrences
+}
+
+// Check if the occurrence covers given time, all day events cover whole days of the scheduler time zone
+func (o calendarOccurrence) covers(t time.Time) bool {
+	if o.event.AllDay {
+		date := t.Format(dateLayout)
+		return date >= o.Start.Format(dateLayout) && date < o.End.Format(dateLayout)
+	}
+	return !t.Before(o.Start) && t.Before(o.End)
+}
+
+// Get starts and ends of the calendar events occurring between from and until
+func calendarBoundaries(from time.Time, until time.Time) []time.Time {
+	calendarsMu.Lock()
+	defer calendarsMu.Unlock()
+	var boundaries []time.Time
+	for _, calendar := range calendars {
+		for i := range calendar.events {
+			for _, occurrence := range calendar.events[i].Occurrences(from, until) {
+				boundaries = append(boundaries, occurrence.Start, occurrence.End)
+			}
+		}
+	}
+	return boundaries
+}
+
+func containsTopic(topics []string, topic string) bool {
+	for _, current := range topics {
+		if current == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// Get the first rule of the calendar matching the event summary and the scheduler
+func (c Calendar) matchRule(scheduler TemperatureScheduler, summary string) (CalendarRule, bool) {
+	for _, rule := range c.Rules {
+		topics := rule.Topics
+		if len(topics) == 0 {
+			topics = c.Topics
+		}
+		if len(topics) > 0 && !containsTopic(topics, scheduler.Topic) {
+			continue
+		}
+		if !strings.Contains(strings.ToLower(summary), strings.ToLower(rule.Summary)) {
+			continue
+		}
+		if _, exist := scheduler.Profiles[rule.Profile]; rule.Profile != "" && !exist {
+			continue
+		}
+		return rule, true
+	}
+	return CalendarRule{}, false
+}
+
+// Load calendars of the configuration, a calendar failed to load is kept with its previous events
+func setCalendars(configs []Calendar) error {
+	calendarsMu.Lock()
+	defer calendarsMu.Unlock()
+
+	previous := map[string]*loadedCalendar{}
+	for _, calendar := range calendars {
+		previous[calendar.config.Path] = calendar
+	}
+	var errs config.Errors
+	loaded := make([]*loadedCalendar, 0, len(configs))
+	for i, calendarConfig := range configs {
+		calendar := &loadedCalendar{config: calendarConfig}
+		if current, exist := previous[calendarConfig.Path]; exist {
+			calendar.events, calendar.modTime, calendar.size, calendar.location = current.events, current.modTime, current.size, current.location
+		}
+		if err := calendar.refresh(); err != nil {
+			errs.Append(config.FieldErr(fmt.Sprintf("calendars[%d].path", i), err))
+		}
+		loaded = append(loaded, calendar)
+	}
+	calendars = loaded
+	return errs.Err()
+}
+
+// Read calendar files changed since the last read
+func refreshCalendars() {
+	calendarsMu.Lock()
+	defer calendarsMu.Unlock()
+	for _, calendar := range calendars {
+		if err := calendar.refresh(); err != nil {
+			log.Printf("Error! Calendar %s reload failed, keeping its previous events: %v", calendar.config.Path, err)
+		}
+	}
+}
+
+// Get calendar event of the scheduler active at given time, the first calendar and event win
+//
+//	in: t - time in the scheduler time zone
+func getActiveCalendarEvent(scheduler TemperatureScheduler, t time.Time) (calendarEvent, bool) {
+	calendarsMu.Lock()
+	defer calendarsMu.Unlock()
+	for _, calendar := range calendars {
+		for _, occurrence := range calendar.occurrencesAround(t) {
+			if !occurrence.covers(t) {
+				continue
+			}
+			if rule, matched := calendar.config.matchRule(scheduler, occurrence.event.Summary); matched {
+				return calendarEvent{
+					Summary:     occurrence.event.Summary,
+					Start:       occurrence.Start,
+					End:         occurrence.End,
+					AllDay:      occurrence.event.AllDay,
+					Temperature: rule.Temperature,
+					Profile:     rule.Profile,
+				}, true
+			}
+		}
+	}
+	return calendarEvent{}, false
+}
+
+// Get time table of the calendar event active at given time
+//
+//	in: t - time in the scheduler time zone
+//	out: time table; bool - false if no time table is active; default temperature of the event
+func getCalendarTimeTable(scheduler TemperatureScheduler, event calendarEvent, t time.Time) (TimeTable, bool, float64) {
+	if event.Temperature != nil {
+		// slot of the event within the day, 00:00 when the event started before or ends after the day
+		timeTable := TimeTable{Temperature: *event.Temperature}
+		if start := event.Start.In(t.Location()); !event.AllDay && start.Format(dateLayout) == t.Format(dateLayout) {
+			timeTable.Start = getSecondsOfDay(start)
+		}
+		if end := event.End.In(t.Location()); !event.AllDay && end.Format(dateLayout) == t.Format(dateLayout) {
+			timeTable.End = getSecondsOfDay(end)
+		}
+		return timeTable, true, *event.Temperature
+	}
+	profile := scheduler.Profiles[event.Profile]
+	timeTable, active := getActiveEntry(TemperatureScheduler{TimeTable: profile.TimeTable, Programs: profile.Programs}, t)
+	return timeTable, active, profile.DefaultTemperature
+}
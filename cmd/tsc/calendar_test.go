@@ -0,0 +1,130 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+)
+
+const testCalendar = `BEGIN:VCALENDAR
+BEGIN:VEVENT
+SUMMARY:Guest room booked
+DTSTART;VALUE=DATE:20231223
+DTEND;VALUE=DATE:20231225
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Holiday
+DTSTART;VALUE=DATE:20230801
+DTEND;VALUE=DATE:20230815
+END:VEVENT
+BEGIN:VEVENT
+SUMMARY:Yoga
+DTSTART:20231002T180000
+DTEND:20231002T193000
+RRULE:FREQ=WEEKLY;BYDAY=MO
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestCalendars(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "family.ics")
+	if err := os.WriteFile(path, []byte(testCalendar), 0o600); err != nil {
+		log.Fatal(err)
+	}
+	guests, yoga := 21.0, 23.0
+	if err := setCalendars([]Calendar{{
+		Path: path,
+		Rules: []CalendarRule{
+			{Summary: "guest room", Topics: []string{"guestroom-trv"}, Temperature: &guests},
+			{Summary: "HOLIDAY", Profile: "away"},
+			{Summary: "yoga", Topics: []string{"livingroom-trv"}, Temperature: &yoga},
+		},
+	}}); err != nil {
+		log.Fatalf("setCalendars() failed: %v", err)
+	}
+	defer setCalendars(nil)
+
+	guestroom := TemperatureScheduler{Topic: "guestroom-trv", DefaultTemperature: 16}
+	livingroom := TemperatureScheduler{
+		Topic:              "livingroom-trv",
+		DefaultTemperature: 21,
+		TimeTable:          []TimeTable{{Start: 79200, End: 21600, Temperature: 18}},
+		Profiles:           map[string]Profile{"away": {DefaultTemperature: 15}},
+	}
+	tests := []struct {
+		scheduler   TemperatureScheduler
+		time        time.Time
+		temperature float64
+	}{
+		{guestroom, time.Date(2023, 12, 22, 23, 0, 0, 0, time.Local), 16},
+		{guestroom, time.Date(2023, 12, 23, 0, 0, 0, 0, time.Local), 21},
+		{guestroom, time.Date(2023, 12, 24, 23, 59, 0, 0, time.Local), 21},
+		{guestroom, time.Date(2023, 12, 25, 0, 0, 0, 0, time.Local), 16},
+		{guestroom, time.Date(2023, 8, 5, 12, 0, 0, 0, time.Local), 16}, // guest room doesn't have away profile
+		{livingroom, time.Date(2023, 8, 5, 12, 0, 0, 0, time.Local), 15},
+		{livingroom, time.Date(2023, 10, 16, 18, 30, 0, 0, time.Local), 23},
+		{livingroom, time.Date(2023, 10, 16, 19, 30, 0, 0, time.Local), 21},
+		{livingroom, time.Date(2023, 10, 17, 18, 30, 0, 0, time.Local), 21},
+	}
+	for _, tt := range tests {
+		if temperature := getTemperatureAtTime(tt.scheduler, tt.time); temperature != tt.temperature {
+			log.Fatalf("getTemperatureAtTime(%s, %v) = %v, want %v", tt.scheduler.Topic, tt.time, temperature, tt.temperature)
+		}
+	}
+	if status := getSchedulerStatus(livingroom, time.Date(2023, 10, 16, 18, 30, 0, 0, time.Local)); status.Calendar != "Yoga" || status.Slot != "18:00-19:30" {
+		log.Fatalf("status should show the calendar event: %+v", status)
+	}
+	changes := previewSchedules(schedulersConfigs{livingroom}, time.Date(2023, 10, 16, 12, 0, 0, 0, time.Local), time.Date(2023, 10, 16, 20, 0, 0, 0, time.Local))
+	if len(changes) != 3 || changes[1].Source != "calendar Yoga" || !changes[2].Time.Equal(time.Date(2023, 10, 16, 19, 30, 0, 0, time.Local)) {
+		log.Fatalf("preview should show the calendar event: %+v", changes)
+	}
+
+	// changed file is read again
+	if err := os.WriteFile(path, []byte(strings.Replace(testCalendar, "SUMMARY:Yoga", "SUMMARY:Pilates", 1)), 0o600); err != nil {
+		log.Fatal(err)
+	}
+	refreshCalendars()
+	if temperature := getTemperatureAtTime(livingroom, time.Date(2023, 10, 16, 18, 30, 0, 0, time.Local)); temperature != 21 {
+		log.Fatalf("changed calendar should be read again, got %v", temperature)
+	}
+
+	// floating times are read again in the changed installation time zone
+	locationsMu.Lock()
+	previous := installationZone
+	locationsMu.Unlock()
+	defer func() {
+		locationsMu.Lock()
+		installationZone = previous
+		locationsMu.Unlock()
+	}()
+	if err := setInstallationLocation("Asia/Tokyo"); err != nil {
+		log.Fatal(err)
+	}
+	refreshCalendars()
+	calendarsMu.Lock()
+	start := calendars[0].events[2].Start
+	calendarsMu.Unlock()
+	if start.Location().String() != "Asia/Tokyo" || start.Hour() != 18 {
+		log.Fatalf("floating time should be read in the installation time zone, got %v", start)
+	}
+}
+
+func TestCalendarValidation(t *testing.T) {
+	var cfg Config
+	err := config.DecodeYAML([]byte("tsc:\n  calendars:\n    - path: ''\n      rules: []\n    - path: family.ics\n      rules:\n        - {summary: guests}\n"), &cfg)
+	for _, expected := range []string{"tsc.calendars[0].path: must not be empty", "tsc.calendars[0].rules: must not be empty", "tsc.calendars[1].rules[0]: exactly one of temperature or profile must be set"} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			log.Fatalf("expected %q, got: %v", expected, err)
+		}
+	}
+
+	if err := setCalendars([]Calendar{{Path: filepath.Join(t.TempDir(), "missing.ics")}}); err == nil || !strings.Contains(err.Error(), "calendars[0].path") {
+		log.Fatalf("missing calendar should be reported, got: %v", err)
+	}
+	setCalendars(nil)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const (
+	commandRun      = "run"
+	commandValidate = "validate"
+	commandPreview  = "preview"
+)
+
+// Take subcommand from the command line args, tsc [run|validate|preview] [flags]
+//
+//	out: subcommand, run when not given
+func parseCommand() (string, error) {
+	if len(os.Args) < 2 || strings.HasPrefix(os.Args[1], "-") {
+		return commandRun, nil
+	}
+	command := os.Args[1]
+	switch command {
+	case commandRun, commandValidate, commandPreview:
+		os.Args = append(os.Args[:1], os.Args[2:]...)
+		return command, nil
+	default:
+		return "", fmt.Errorf("unknown command %q (commands: %s, %s, %s)", command, commandRun, commandValidate, commandPreview)
+	}
+}
+
+// Print validation result of the configuration
+//
+//	out: exit code, 1 when configuration is invalid
+func runValidate(w io.Writer, schedulers schedulersConfigs, configErrors error) int {
+	if configErrors != nil {
+		fmt.Fprintf(w, "Configuration is invalid:\n%v\n", configErrors)
+		return 1
+	}
+	fmt.Fprintf(w, "Configuration is valid, %d scheduler(s)\n", len(schedulers))
+	return 0
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/pkg/sensors"
+	"github.com/jacfal.io/homeaut/utils"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Config is the configuration file, sections of other services are ignored
+type Config struct {
+	Broker config.Broker `json:"broker"`
+	Tss    interface{}   `json:"tss,omitempty"` // synchronizer section, not used by tsc
+	Tsc    TscConfig     `json:"tsc"`
+}
+
+// TscConfig holds the scheduler settings, command line args take precedence
+type TscConfig struct {
+	ShutdownTimeout    utils.Duration              `json:"shutdown-timeout,omitempty"`
+	State              string                      `json:"state,omitempty"`         // state file
+	ServiceTopic       string                      `json:"service-topic,omitempty"` // availability topic prefix
+	MetricsListen      string                      `json:"metrics-listen,omitempty"`
+	APIListen          string                      `json:"api-listen,omitempty"`
+	Profile            string                      `json:"profile,omitempty"`   // active heating profile unless switched at runtime
+	TimeZone           string                      `json:"time-zone,omitempty"` // IANA time zone of the schedules
+	Latitude           *float64                    `json:"latitude,omitempty"`  // coordinates of the installation for sunrise and sunset
+	Longitude          *float64                    `json:"longitude,omitempty"`
+	OutdoorSensorTopic string                      `json:"outdoor-sensor-topic,omitempty"` // heating rates of optimum start are learned against it
+	OutdoorSensorModel string                      `json:"outdoor-sensor-model,omitempty"`
+	TrvModels          map[string]sensors.TrvModel `json:"trv-models,omitempty"`        // setpoint steps of TRV models, complement known models
+	ReassertInterval   utils.Duration              `json:"reassert-interval,omitempty"` // publish current setpoint again after this interval
+	ConfirmTimeout     utils.Duration              `json:"confirm-timeout,omitempty"`   // retry publish not confirmed by the TRV in this time
+	ConfirmRetries     int                         `json:"confirm-retries,omitempty"`
+	Schedulers         schedulersConfigs           `json:"schedulers,omitempty"`
+	Calendars          []Calendar                  `json:"calendars,omitempty"` // iCalendar files layered on top of the schedules
+}
+
+func (c *TscConfig) Validate() error {
+	var errs config.Errors
+	if _, err := loadLocation(c.TimeZone); err != nil {
+		errs.Append(config.FieldErr("time-zone", err))
+	}
+	if _, err := sensors.GetDecoder(c.OutdoorSensorModel); err != nil {
+		errs.Append(config.FieldErr("outdoor-sensor-model", err))
+	}
+	schedulerIndexes := map[string]int{}
+	for i, scheduler := range c.Schedulers {
+		if first, exist := schedulerIndexes[scheduler.Topic]; exist && scheduler.Topic != "" {
+			errs.Append(config.FieldErr(fmt.Sprintf("schedulers[%d].topic", i), fmt.Errorf("topic %s is already scheduled by schedulers[%d]", scheduler.Topic, first)))
+			continue
+		}
+		schedulerIndexes[scheduler.Topic] = i
+	}
+	errs.Append(config.WithPath("schedulers", checkZoneMembers(c.Schedulers)))
+	for i, scheduler := range c.Schedulers {
+		errs.Append(config.WithPath(fmt.Sprintf("schedulers[%d]", i), checkScheduler(scheduler, c.TrvModels)))
+	}
+	return errs.Err()
+}
+
+func (s *TemperatureScheduler) Validate() error {
+	var errs config.Errors
+	errs.Append(config.MustNotBeEmpty("topic", s.Topic))
+	errs.Append(validatePrograms(s.Programs))
+	if _, err := loadLocation(s.TimeZone); err != nil {
+		errs.Append(config.FieldErr("timeZone", err))
+	}
+	return errs.Err()
+}
+
+// Load configuration file
+func loadConfig(path string) (Config, error) {
+	log.Printf("Loading configuration: %s", path)
+	var cfg Config
+	if err := config.Load(path, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Apply configuration file values to the input args, args set on the command line take precedence
+func applyConfig(cfg Config) {
+	applyFlag := func(name string, value string) {
+		if err := argFlags.Apply(name, value); err != nil {
+			log.Printf("Error! Can't apply configuration value %s=%s: %v", name, value, err)
+		}
+	}
+	formatDuration := func(d utils.Duration) string {
+		if d == 0 {
+			return ""
+		}
+		return d.String()
+	}
+	formatFloat := func(value *float64) string {
+		if value == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*value, 'f', -1, 64)
+	}
+
+	applyFlag("broker", cfg.Broker.URL)
+	applyFlag("state", cfg.Tsc.State)
+	applyFlag("service-topic", cfg.Tsc.ServiceTopic)
+	applyFlag("metrics-listen", cfg.Tsc.MetricsListen)
+	applyFlag("api-listen", cfg.Tsc.APIListen)
+	applyFlag("profile", cfg.Tsc.Profile)
+	applyFlag("time-zone", cfg.Tsc.TimeZone)
+	applyFlag("outdoor-sensor-topic", cfg.Tsc.OutdoorSensorTopic)
+	applyFlag("outdoor-sensor-model", cfg.Tsc.OutdoorSensorModel)
+	applyFlag("latitude", formatFloat(cfg.Tsc.Latitude))
+	applyFlag("longitude", formatFloat(cfg.Tsc.Longitude))
+	applyFlag("reassert-interval", formatDuration(cfg.Tsc.ReassertInterval))
+	applyFlag("confirm-timeout", formatDuration(cfg.Tsc.ConfirmTimeout))
+	if cfg.Tsc.ConfirmRetries != 0 {
+		applyFlag("confirm-retries", fmt.Sprintf("%d", cfg.Tsc.ConfirmRetries))
+	} else {
+		applyFlag("confirm-retries", "")
+	}
+
+	mqttClientID = cfg.Broker.ClientID
+	if mqttClientID == "" {
+		mqttClientID = defaultMqttClientID
+	}
+	mqttUsername = cfg.Broker.Username
+	mqttPassword = cfg.Broker.Password
+
+	shutdownTimeout = defaultShutdownTimeout
+	if cfg.Tsc.ShutdownTimeout > 0 {
+		shutdownTimeout = cfg.Tsc.ShutdownTimeout.Duration()
+	}
+
+	trvModelsMu.Lock()
+	trvModels = cfg.Tsc.TrvModels
+	trvModelsMu.Unlock()
+	temperatureSchedulers = mergeSchedulersConfigs(cfg.Tsc.Schedulers, schedulerArgs)
+}
+
+// Reload configuration file and swap in new schedulers, last temperatures are kept
+func reloadConfig(client MQTT.Client) {
+	if *configFile == "" {
+		log.Printf("Warning! Configuration file not set, nothing to reload")
+		return
+	}
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		log.Printf("Error! Configuration reload failed, keeping current configuration:\n%v", err)
+		return
+	}
+	if err := checkSchedulerArgs(cfg.Tsc.TrvModels); err != nil {
+		log.Printf("Error! Configuration reload failed, keeping current configuration:\n%v", err)
+		return
+	}
+	latitude, longitude := configuredCoordinates(cfg.Tsc)
+	if err := checkSolarSchedules(mergeSchedulersConfigs(cfg.Tsc.Schedulers, schedulerArgs), latitude, longitude, time.Now()); err != nil {
+		log.Printf("Error! Configuration reload failed, keeping current configuration:\n%v", err)
+		return
+	}
+
+	previousBroker, previousState, previousOutdoorSensor := *mqttBroker, *stateFile, *outdoorSensorTopic
+	mu.Lock()
+	previousSchedulers := temperatureSchedulers
+	applyConfig(cfg)
+	if err := setInstallationLocation(*timeZone); err != nil {
+		log.Printf("Error! Can't apply time zone %s: %v", *timeZone, err)
+	}
+	var added, removed, regrouped schedulersConfigs
+	for _, previous := range previousSchedulers {
+		if !containsScheduler(temperatureSchedulers, previous.Topic) {
+			scheduledSetpointGauge.Delete(previous.Topic)
+			removed = append(removed, previous)
+		}
+	}
+	for _, current := range temperatureSchedulers {
+		if !containsScheduler(previousSchedulers, current.Topic) {
+			added = append(added, current)
+		}
+		for _, previous := range previousSchedulers {
+			if previous.Topic == current.Topic && !sameMembers(previous, current) {
+				// TRVs or sensors of the zone changed, subscriptions are renewed
+				regrouped = append(regrouped, previous)
+				added = append(added, current)
+			}
+		}
+	}
+	mu.Unlock()
+
+	// floating times of the calendars are read in the installation time zone
+	if err := setCalendars(cfg.Tsc.Calendars); err != nil {
+		log.Printf("Error! Calendars reload failed:\n%v", config.WithPath("tsc", err))
+	}
+
+	for _, scheduler := range removed {
+		forgetOverride(scheduler.Topic)
+		forgetZone(scheduler)
+		forgetHold(scheduler.Topic)
+		forgetRoomProfile(scheduler.Topic)
+		forgetExceptions(scheduler.Topic)
+		forgetOptimumStart(scheduler.Topic)
+	}
+	for _, scheduler := range regrouped {
+		forgetZone(scheduler)
+	}
+	if client.IsConnected() {
+		unsubscribeSchedulers(client, append(removed, regrouped...))
+		subscribeSchedulers(client, added)
+	}
+
+	if *mqttBroker != previousBroker {
+		log.Printf("Warning! MQTT broker change (%s --> %s) requires restart", previousBroker, *mqttBroker)
+	}
+	if *stateFile != previousState {
+		log.Printf("Warning! State file change (%s --> %s) requires restart", previousState, *stateFile)
+	}
+	if *outdoorSensorTopic != previousOutdoorSensor {
+		log.Printf("Warning! Outdoor sensor topic change (%s --> %s) requires restart", previousOutdoorSensor, *outdoorSensorTopic)
+	}
+	log.Printf("Configuration reloaded, schedulers: %v", getSchedulers())
+}
+
+// Get coordinates of the configuration, coordinates set on the command line take precedence
+func configuredCoordinates(cfg TscConfig) (string, string) {
+	value := func(name string, arg string, configured *float64) string {
+		switch {
+		case argFlags.IsSet(name):
+			return arg
+		case configured == nil:
+			return ""
+		}
+		return strconv.FormatFloat(*configured, 'f', -1, 64)
+	}
+	return value("latitude", *latitudeArg, cfg.Latitude), value("longitude", *longitudeArg, cfg.Longitude)
+}
+
+// Merge scheduler configs, overrides replace configs with the same topic
+func mergeSchedulersConfigs(configs schedulersConfigs, overrides schedulersConfigs) schedulersConfigs {
+	merged := append(schedulersConfigs{}, configs...)
+	for _, override := range overrides {
+		replaced := false
+		for i := range merged {
+			if merged[i].Topic == override.Topic {
+				merged[i] = override
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, override)
+		}
+	}
+	return merged
+}
+
+// Check if scheduler of the topic is configured
+func containsScheduler(schedulers schedulersConfigs, topic string) bool {
+	for _, scheduler := range schedulers {
+		if scheduler.Topic == topic {
+			return true
+		}
+	}
+	return false
+}
+
+// Get TRV model, configured values complement (or replace) values of the model known by the sensors package
+func getTrvModel(name string, configured map[string]sensors.TrvModel) (sensors.TrvModel, error) {
+	if name == "" {
+		name = sensors.DefaultTrvModel
+	}
+	model, err := sensors.GetTrvModel(name)
+	custom, exist := configured[name]
+	if !exist {
+		return model, err
+	}
+	if custom.SetpointStep != 0 {
+		model.SetpointStep = custom.SetpointStep
+	}
+	if custom.MinSetpoint != 0 {
+		model.MinSetpoint = custom.MinSetpoint
+	}
+	if custom.MaxSetpoint != 0 {
+		model.MaxSetpoint = custom.MaxSetpoint
+	}
+	return model, nil
+}
+
+// Get TRV model of the scheduler, models are validated at (re)load
+func getSchedulerTrvModel(scheduler TemperatureScheduler) sensors.TrvModel {
+	trvModelsMu.Lock()
+	configured := trvModels
+	trvModelsMu.Unlock()
+	model, _ := getTrvModel(scheduler.TrvModel, configured)
+	return model
+}
+
+// Check --scheduler args against TRV models of the configuration file, file schedulers are checked at load
+func checkSchedulerArgs(models map[string]sensors.TrvModel) error {
+	var errs config.Errors
+	for i, scheduler := range schedulerArgs {
+		if invalidSchedulerArgs[i] {
+			continue
+		}
+		errs.Append(config.WithPath(fmt.Sprintf("--scheduler[%d]", i), checkScheduler(scheduler, models)))
+	}
+	return errs.Err()
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+)
+
+func TestLoadExampleConfig(t *testing.T) {
+	cfg, err := loadConfig("../../config.example.yaml")
+	if err != nil {
+		log.Fatalf("loadConfig failed: %v", err)
+	}
+	if len(cfg.Tsc.Schedulers) != 3 || cfg.Tsc.Schedulers[0].TimeTable[0].Start != 79200 || cfg.Tsc.Schedulers[0].TimeTable[0].Temperature != 18 ||
+		len(cfg.Tsc.Schedulers[2].Trvs) != 2 {
+		log.Fatalf("loadConfig returned unexpected schedulers: %v", cfg.Tsc.Schedulers)
+	}
+}
+
+func TestMergeSchedulersConfigs(t *testing.T) {
+	configs := schedulersConfigs{{Topic: "trv1", DefaultTemperature: 20}, {Topic: "trv2", DefaultTemperature: 20}}
+	overrides := schedulersConfigs{{Topic: "trv2", DefaultTemperature: 22}}
+
+	merged := mergeSchedulersConfigs(configs, overrides)
+	if len(merged) != 2 || merged[0].DefaultTemperature != 20 || merged[1].DefaultTemperature != 22 {
+		log.Fatalf("mergeSchedulersConfigs failed: %v", merged)
+	}
+}
+
+func TestTimeZoneValidation(t *testing.T) {
+	var cfg Config
+	err := config.DecodeYAML([]byte("tsc:\n  time-zone: Europe/Nowhere\n  schedulers:\n    - topic: trv\n      defaultTemperature: 20\n      timeTable: []\n      timeZone: Mars/Base\n"), &cfg)
+	if err == nil || !strings.Contains(err.Error(), "tsc.time-zone") || !strings.Contains(err.Error(), "tsc.schedulers[0].timeZone") {
+		log.Fatalf("invalid time zones should be reported, got: %v", err)
+	}
+}
+
+func TestTrvModelValidation(t *testing.T) {
+	var cfg Config
+	err := config.DecodeYAML([]byte("tsc:\n  trv-models:\n    custom-trv: {step: 1}\n  schedulers:\n    - {topic: trv1, defaultTemperature: 20.5, timeTable: [], trvModel: custom-trv}\n    - {topic: trv2, defaultTemperature: 20, timeTable: [], trvModel: unknown-trv}\n"), &cfg)
+	if err == nil || strings.Contains(err.Error(), "schedulers[0]") || !strings.Contains(err.Error(), "tsc.schedulers[1].trvModel") {
+		log.Fatalf("unknown TRV model should be reported, got: %v", err)
+	}
+}
+
+func TestRunValidate(t *testing.T) {
+	var output strings.Builder
+	if code := runValidate(&output, schedulersConfigs{{Topic: "trv"}}, nil); code != 0 || output.String() != "Configuration is valid, 1 scheduler(s)\n" {
+		log.Fatalf("runValidate of valid configuration = %d, %q", code, output.String())
+	}
+
+	output.Reset()
+	scheduler := TemperatureScheduler{Topic: "trv", DefaultTemperature: 20, TimeTable: []TimeTable{{Start: 79200, End: 21600, Temperature: 18}, {Start: 18000, End: 25200, Temperature: 18}}}
+	code := runValidate(&output, schedulersConfigs{scheduler}, config.WithPath("schedulers[0]", checkScheduler(scheduler, nil)))
+	if code != 1 || !strings.Contains(output.String(), "schedulers[0].timeTable[0]: 22:00-06:00 overlaps timeTable[1] 05:00-07:00\n") {
+		log.Fatalf("runValidate of invalid configuration = %d, %q", code, output.String())
+	}
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/pkg/sensors"
+	"github.com/jacfal.io/homeaut/pkg/store"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	exceptionTopicSuffix = "/tsc/exception"
+	dateLayout           = "2006-01-02"
+)
+
+// Exception replaces the weekly schedule of the scheduler on whole days, eg. holidays or one-off days
+//
+// The days use either a day program of the scheduler, a profile of the scheduler or a constant temperature.
+type Exception store.Exception
+
+// exceptionCommand is the payload of the exception command topic, an exception or {"remove": "<name>"}
+type exceptionCommand struct {
+	Exception
+	Remove string `json:"remove,omitempty"` // name of the exception to remove
+}
+
+func exceptionTopic(topic string) string {
+	return topic + exceptionTopicSuffix
+}
+
+func (e *Exception) Validate() error {
+	var errs config.Errors
+	from, err := time.Parse(dateLayout, e.From)
+	if err != nil {
+		errs.Append(config.FieldErr("from", fmt.Errorf("invalid date %q, expected YYYY-MM-DD", e.From)))
+	}
+	if e.To != "" {
+		if to, err := time.Parse(dateLayout, e.To); err != nil {
+			errs.Append(config.FieldErr("to", fmt.Errorf("invalid date %q, expected YYYY-MM-DD", e.To)))
+		} else if to.Before(from) {
+			errs.Append(config.FieldErr("to", fmt.Errorf("%s is before from %s", e.To, e.From)))
+		}
+	}
+
+	set := 0
+	for _, value := range []bool{e.Program != "", e.Profile != "", e.Temperature != nil} {
+		if value {
+			set++
+		}
+	}
+	if set != 1 {
+		errs.Append(errors.New("exactly one of program, profile or temperature must be set"))
+	}
+	return errs.Err()
+}
+
+// Get last day of the exception
+func (e Exception) lastDay() string {
+	if e.To == "" {
+		return e.From
+	}
+	return e.To
+}
+
+// Check if the exception covers the day of given time
+func (e Exception) covers(t time.Time) bool {
+	date := t.Format(dateLayout)
+	return date >= e.From && date <= e.lastDay()
+}
+
+// Format exception for status and preview, eg. christmas (2023-12-23 - 2024-01-02)
+func (e Exception) String() string {
+	days := e.From
+	if e.lastDay() != e.From {
+		days = fmt.Sprintf("%s - %s", e.From, e.lastDay())
+	}
+	if e.Name == "" {
+		return days
+	}
+	return fmt.Sprintf("%s (%s)", e.Name, days)
+}
+
+// Get exceptions of the scheduler, runtime exceptions precede the configured ones
+func getExceptions(scheduler TemperatureScheduler) []Exception {
+	var exceptions []Exception
+	stateStore.View(func(state *store.State) {
+		for _, exception := range state.Exceptions[scheduler.Topic] {
+			exceptions = append(exceptions, Exception(exception))
+		}
+	})
+	return append(exceptions, scheduler.Exceptions...)
+}
+
+// Get exception of the scheduler covering the day of given time, the first one wins
+//
+//	in: t - time in the scheduler time zone
+func getActiveException(scheduler TemperatureScheduler, t time.Time) (Exception, bool) {
+	for _, exception := range getExceptions(scheduler) {
+		if exception.covers(t) {
+			return exception, true
+		}
+	}
+	return Exception{}, false
+}
+
+// Get time table of the exception active at given time
+//
+//	in: t - time in the scheduler time zone
+func getExceptionTimeTable(scheduler TemperatureScheduler, exception Exception, t time.Time) (TimeTable, bool) {
+	switch {
+	case exception.Temperature != nil:
+		// all day
+		return TimeTable{Temperature: *exception.Temperature}, true
+	case exception.Program != "":
+		for _, timeTable := range scheduler.Programs[exception.Program].TimeTable {
+			// days of the program don't apply
+			timeTable.Days = 0
+			if resolved, active := activeTimeTable(timeTable, t); active {
+				return resolved, true
+			}
+		}
+	case exception.Profile != "":
+		profile := scheduler.Profiles[exception.Profile]
+		return getActiveEntry(TemperatureScheduler{TimeTable: profile.TimeTable, Programs: profile.Programs}, t)
+	}
+	return TimeTable{}, false
+}
+
+// Get default temperature of the exception days
+func getExceptionDefaultTemperature(scheduler TemperatureScheduler, exception Exception) float64 {
+	if profile, exist := scheduler.Profiles[exception.Profile]; exist {
+		return profile.DefaultTemperature
+	}
+	return profileScheduler(scheduler).DefaultTemperature
+}
+
+// Check program, profile and temperature of the exception against the scheduler
+func checkException(scheduler TemperatureScheduler, exception Exception, model sensors.TrvModel) error {
+	var errs config.Errors
+	if _, exist := scheduler.Programs[exception.Program]; exception.Program != "" && !exist {
+		errs.Append(config.FieldErr("program", fmt.Errorf("unknown program %s", exception.Program)))
+	}
+	if _, exist := scheduler.Profiles[exception.Profile]; exception.Profile != "" && !exist {
+		errs.Append(config.FieldErr("profile", fmt.Errorf("unknown profile %s", exception.Profile)))
+	}
+	if exception.Temperature != nil {
+		if err := checkSetpointLimit(*exception.Temperature, model); err != nil {
+			errs.Append(config.FieldErr("temperature", err))
+		}
+	}
+	return errs.Err()
+}
+
+// Check configured exceptions of the scheduler, exceptions must not overlap
+func checkExceptions(scheduler TemperatureScheduler, model sensors.TrvModel) error {
+	var errs config.Errors
+	for i, exception := range scheduler.Exceptions {
+		path := fmt.Sprintf("exceptions[%d]", i)
+		errs.Append(config.WithPath(path, checkException(scheduler, exception, model)))
+		for j, other := range scheduler.Exceptions[:i] {
+			if exception.From <= other.lastDay() && other.From <= exception.lastDay() {
+				errs.Append(config.FieldErr(path, fmt.Errorf("%s overlaps exceptions[%d] %s", exception, j, other)))
+			}
+		}
+	}
+	return errs.Err()
+}
+
+// Remove runtime exceptions ended before the day of given time
+//
+//	out: number of removed exceptions
+func pruneExceptions(schedulers schedulersConfigs, now time.Time) int {
+	pruned := 0
+	stateStore.Update(func(state *store.State) bool {
+		for _, scheduler := range schedulers {
+			today := scheduleTime(scheduler, now).Format(dateLayout)
+			var kept []store.Exception
+			for _, exception := range state.Exceptions[scheduler.Topic] {
+				if Exception(exception).lastDay() < today {
+					log.Printf("Exception %s of %s ended", Exception(exception), scheduler.Topic)
+					pruned++
+					continue
+				}
+				kept = append(kept, exception)
+			}
+			if len(kept) == 0 {
+				delete(state.Exceptions, scheduler.Topic)
+			} else {
+				state.Exceptions[scheduler.Topic] = kept
+			}
+		}
+		return pruned > 0
+	})
+	return pruned
+}
+
+// Parse exception command
+//
+//	out: exception to add; name of the exception to remove; error
+func parseExceptionCommand(payload []byte) (Exception, string, error) {
+	var command exceptionCommand
+	decoder := json.NewDecoder(strings.NewReader(string(payload)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&command); err != nil {
+		return Exception{}, "", fmt.Errorf("invalid exception command: %w", err)
+	}
+	if command.Remove != "" {
+		return Exception{}, command.Remove, nil
+	}
+	if err := command.Exception.Validate(); err != nil {
+		return Exception{}, "", err
+	}
+	return command.Exception, "", nil
+}
+
+func onExceptionMessageReceived(client MQTT.Client, msg MQTT.Message) {
+	applyExceptionCommand(client, strings.TrimSuffix(msg.Topic(), exceptionTopicSuffix), msg.Payload(), time.Now())
+}
+
+// Add or remove runtime exception of the scheduler, empty payload removes all of them
+func applyExceptionCommand(client MQTT.Client, topic string, payload []byte, now time.Time) {
+	scheduler, exist := getScheduler(topic)
+	if !exist {
+		log.Printf("Warning! Exception for unknown scheduler %s ignored", topic)
+		return
+	}
+
+	if len(strings.TrimSpace(string(payload))) == 0 {
+		log.Printf("Exceptions of %s removed", topic)
+		forgetExceptions(topic)
+		updateScheduler(client, scheduler, now, false)
+		return
+	}
+	exception, remove, err := parseExceptionCommand(payload)
+	if err == nil && remove == "" {
+		err = checkException(scheduler, exception, getSchedulerTrvModel(scheduler))
+	}
+	if err != nil {
+		log.Printf("Error! Exception of %s rejected: %v", topic, err)
+		return
+	}
+
+	removed := false
+	stateStore.Update(func(state *store.State) bool {
+		// exception with the same name is replaced
+		var kept []store.Exception
+		for _, current := range state.Exceptions[topic] {
+			if remove != "" && current.Name == remove || remove == "" && exception.Name != "" && current.Name == exception.Name {
+				removed = true
+				continue
+			}
+			kept = append(kept, current)
+		}
+		if remove != "" && !removed {
+			return false
+		}
+		if remove == "" {
+			kept = append(kept, store.Exception(exception))
+		}
+		if len(kept) == 0 {
+			delete(state.Exceptions, topic)
+		} else {
+			state.Exceptions[topic] = kept
+		}
+		return true
+	})
+	if remove != "" && !removed {
+		log.Printf("Warning! Exception %s of %s doesn't exist, nothing removed", remove, topic)
+		return
+	}
+	if remove != "" {
+		log.Printf("Exception %s of %s removed", remove, topic)
+	} else {
+		log.Printf("Exception %s of %s added", exception, topic)
+	}
+	updateScheduler(client, scheduler, now, false)
+}
+
+// Remove runtime exceptions of the topic
+func forgetExceptions(topic string) {
+	stateStore.Update(func(state *store.State) bool {
+		delete(state.Exceptions, topic)
+		return true
+	})
+}
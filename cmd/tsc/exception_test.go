@@ -0,0 +1,133 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/pkg/mqtttest"
+	"github.com/jacfal.io/homeaut/pkg/store"
+)
+
+func TestExceptions(t *testing.T) {
+	away := 16.0
+	scheduler := TemperatureScheduler{
+		Topic:              "exception-trv",
+		DefaultTemperature: 21,
+		Programs: map[string]DayProgram{
+			"workday": {TimeTable: []TimeTable{{Start: 79200, End: 21600, Temperature: 18}}},
+			"weekend": {TimeTable: []TimeTable{{Start: 82800, End: 30600, Temperature: 17}}},
+		},
+		Profiles: map[string]Profile{"eco": {DefaultTemperature: 19}},
+		Exceptions: []Exception{
+			{Name: "christmas", From: "2023-12-23", To: "2024-01-02", Program: "weekend"},
+			{Name: "holiday", From: "2023-08-01", To: "2023-08-14", Temperature: &away},
+			{From: "2023-05-02", Profile: "eco"},
+		},
+	}
+
+	tests := []struct {
+		time        time.Time
+		temperature float64
+		exception   string
+	}{
+		{time.Date(2023, 12, 22, 7, 0, 0, 0, time.Local), 21, ""},                                      // Friday, workday program
+		{time.Date(2023, 12, 27, 7, 0, 0, 0, time.Local), 17, "christmas (2023-12-23 - 2024-01-02)"},   // Wednesday, weekend program
+		{time.Date(2023, 12, 27, 22, 30, 0, 0, time.Local), 21, "christmas (2023-12-23 - 2024-01-02)"}, // weekend program starts at 23:00
+		{time.Date(2024, 1, 3, 7, 0, 0, 0, time.Local), 21, ""},
+		{time.Date(2023, 8, 7, 23, 0, 0, 0, time.Local), 16, "holiday (2023-08-01 - 2023-08-14)"},
+		{time.Date(2023, 5, 2, 12, 0, 0, 0, time.Local), 19, "2023-05-02"},
+		{time.Date(2023, 5, 3, 12, 0, 0, 0, time.Local), 21, ""},
+	}
+	for _, tt := range tests {
+		if temperature := getTemperatureAtTime(scheduler, tt.time); temperature != tt.temperature {
+			log.Fatalf("getTemperatureAtTime(%v) = %v, want %v", tt.time, temperature, tt.temperature)
+		}
+		if status := getSchedulerStatus(scheduler, tt.time); status.Exception != tt.exception {
+			log.Fatalf("status exception at %v = %q, want %q", tt.time, status.Exception, tt.exception)
+		}
+	}
+
+	changes := previewSchedules(schedulersConfigs{scheduler}, time.Date(2023, 7, 31, 12, 0, 0, 0, time.Local), time.Date(2023, 8, 2, 0, 0, 0, 0, time.Local))
+	if len(changes) < 3 || changes[2].Temperature != 16 || changes[2].Source != "exception holiday (2023-08-01 - 2023-08-14)" {
+		log.Fatalf("preview should show the upcoming exception: %+v", changes)
+	}
+}
+
+func TestExceptionCommand(t *testing.T) {
+	scheduler := TemperatureScheduler{Topic: "exception-command-trv", DefaultTemperature: 21, Programs: map[string]DayProgram{"weekend": {TimeTable: []TimeTable{{Start: 0, End: 0, Temperature: 19}}}}}
+	mu.Lock()
+	previousSchedulers := temperatureSchedulers
+	temperatureSchedulers = schedulersConfigs{scheduler}
+	lastTemperatures[scheduler.Topic] = 21
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		temperatureSchedulers = previousSchedulers
+		delete(lastTemperatures, scheduler.Topic)
+		mu.Unlock()
+		forgetExceptions(scheduler.Topic)
+	}()
+
+	client := mqtttest.NewClient()
+	now := time.Date(2023, 8, 1, 12, 0, 0, 0, time.Local)
+	applyExceptionCommand(client, scheduler.Topic, []byte(`{"name": "holiday", "from": "2023-08-01", "to": "2023-08-14", "temperature": 16}`), now)
+	if published := client.PublishedTo(heatingSetpointTopic(scheduler.Topic)); len(published) != 1 || published[0] != "16" {
+		log.Fatalf("exception of today should be published: %v", published)
+	}
+	applyExceptionCommand(client, scheduler.Topic, []byte(`{"name": "holiday", "from": "2023-08-01", "to": "2023-08-14", "program": "weekend"}`), now)
+	applyExceptionCommand(client, scheduler.Topic, []byte(`{"from": "2023-09-01", "program": "unknown"}`), now)
+	applyExceptionCommand(client, scheduler.Topic, []byte(`{"from": "2023-09-01", "to": "2023-08-01", "temperature": 16}`), now)
+	if exceptions := getExceptions(scheduler); len(exceptions) != 1 || exceptions[0].Program != "weekend" {
+		log.Fatalf("exception with the same name should be replaced, invalid ones rejected: %+v", exceptions)
+	}
+
+	applyExceptionCommand(client, scheduler.Topic, []byte(`{"from": "2023-08-20", "temperature": 18}`), now)
+	if pruned := pruneExceptions(schedulersConfigs{scheduler}, time.Date(2023, 8, 15, 0, 0, 0, 0, time.Local)); pruned != 1 {
+		log.Fatalf("ended exception should be pruned, got %d", pruned)
+	}
+	var exceptions []store.Exception
+	stateStore.View(func(state *store.State) {
+		exceptions = state.Exceptions[scheduler.Topic]
+	})
+	if len(exceptions) != 1 || exceptions[0].From != "2023-08-20" {
+		log.Fatalf("upcoming exception should be kept: %+v", exceptions)
+	}
+
+	// removal of unknown exception changes nothing
+	client.Reset()
+	applyExceptionCommand(client, scheduler.Topic, []byte(`{"remove": "unnamed"}`), now)
+	if exceptions := getExceptions(scheduler); len(exceptions) != 1 || len(client.Published) != 0 {
+		log.Fatalf("unknown exception shouldn't be removed: %+v, published: %v", exceptions, client.Published)
+	}
+
+	applyExceptionCommand(client, scheduler.Topic, []byte(``), now)
+	applyExceptionCommand(client, scheduler.Topic, []byte(`{"name": "trip", "from": "2023-09-01", "temperature": 16}`), now)
+	applyExceptionCommand(client, scheduler.Topic, []byte(`{"remove": "trip"}`), now)
+	stateStore.View(func(state *store.State) {
+		_, exist := state.Exceptions[scheduler.Topic]
+		if exist {
+			log.Fatal("removal of the last exception should remove the topic from the state")
+		}
+	})
+	if exceptions := getExceptions(scheduler); len(exceptions) != 0 {
+		log.Fatalf("empty command should remove all exceptions: %+v", exceptions)
+	}
+}
+
+func TestExceptionValidation(t *testing.T) {
+	var cfg Config
+	err := config.DecodeYAML([]byte("tsc:\n  schedulers:\n    - topic: trv\n      defaultTemperature: 20\n      timeTable: []\n      exceptions:\n        - {from: 2023-12-23, to: 2024-01-02, program: weekend}\n        - {from: 2023-12-31, temperature: 18}\n        - {from: 2023-13-01, temperature: 18, profile: away}\n"), &cfg)
+	for _, expected := range []string{
+		"tsc.schedulers[0].exceptions[0].program: unknown program weekend",
+		"tsc.schedulers[0].exceptions[1]: 2023-12-31 overlaps exceptions[0] 2023-12-23 - 2024-01-02",
+		`tsc.schedulers[0].exceptions[2].from: invalid date "2023-13-01"`,
+		"tsc.schedulers[0].exceptions[2]: exactly one of program, profile or temperature must be set",
+	} {
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			log.Fatalf("expected %q, got: %v", expected, err)
+		}
+	}
+}
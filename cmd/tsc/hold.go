@@ -0,0 +1,191 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/pkg/store"
+)
+
+// Manual hold policies of the scheduler
+const (
+	holdIgnore        = "ignore"          // manual changes are overwritten at the next schedule change
+	holdUntilNextSlot = "until-next-slot" // manual setpoint is kept until the scheduled temperature or slot changes
+	holdDuration      = "duration"        // manual setpoint is kept for manualHoldDuration
+	defaultHold       = holdUntilNextSlot
+)
+
+const (
+	// TRV state attributes of the setpoint and its origin
+	setpointAttribute             = "occupied_heating_setpoint"
+	setpointChangeSourceAttribute = "setpoint_change_source"
+	setpointChangeSourceManual    = "manual"
+
+	// until-next-slot hold of the schedule without changes ends after this time
+	maxHoldUntilNextSlot = 7 * 24 * time.Hour
+)
+
+// observedSetpoint is the last setpoint and its origin reported by the TRV
+type observedSetpoint struct {
+	source   string
+	setpoint float64
+}
+
+// key: TRV topic, guarded by mu
+var observedSetpoints = map[string]observedSetpoint{}
+
+// Get manual hold policy of the scheduler
+func getHoldPolicy(scheduler TemperatureScheduler) string {
+	if scheduler.ManualHold == "" {
+		return defaultHold
+	}
+	return scheduler.ManualHold
+}
+
+// Check manual hold policy of the scheduler
+func checkManualHold(scheduler TemperatureScheduler) error {
+	var errs config.Errors
+	switch scheduler.ManualHold {
+	case "", holdIgnore, holdUntilNextSlot:
+	case holdDuration:
+		if scheduler.ManualHoldDuration <= 0 {
+			errs.Append(config.FieldErr("manualHoldDuration", errors.New("must be set for duration hold")))
+		}
+	default:
+		errs.Append(config.FieldErr("manualHold", fmt.Errorf("unknown manual hold %q (use %s, %s or %s)", scheduler.ManualHold, holdIgnore, holdUntilNextSlot, holdDuration)))
+	}
+	if scheduler.ManualHoldDuration < 0 {
+		errs.Append(config.FieldErr("manualHoldDuration", errors.New("must not be negative")))
+	}
+	return errs.Err()
+}
+
+// Get end of the manual hold started at given time
+//
+// until-next-slot hold ends when the scheduled temperature or slot changes, at most after manualHoldDuration (if set)
+func getHoldEnd(scheduler TemperatureScheduler, now time.Time) time.Time {
+	now = now.Truncate(time.Second)
+	if getHoldPolicy(scheduler) == holdDuration {
+		return now.Add(scheduler.ManualHoldDuration.Duration())
+	}
+
+	limit := now.Add(maxHoldUntilNextSlot)
+	if scheduler.ManualHoldDuration > 0 {
+		limit = now.Add(scheduler.ManualHoldDuration.Duration())
+	}
+	slot := func(t time.Time) string {
+		slot := defaultSlot
+		if timeTable, active := getTimeTableAtTime(scheduler, t); active {
+			slot = formatSlot(timeTable)
+		}
+		// steps of a ramp don't end the hold
+		return fmt.Sprintf("%s %s", slot, formatSetpoint(getSlotTemperature(scheduler, t)))
+	}
+	// the slot changes at the schedule boundaries only, the schedule isn't walked minute by minute for days
+	if changedAt, changed := findNextChangeAt(now, scheduleBoundaries(scheduler, now, limit), slot); changed {
+		return changedAt
+	}
+	return limit
+}
+
+// Parse setpoint and its origin of the TRV state payload
+//
+//	out: setpoint; source, eg. manual; bool - false if the payload doesn't report the setpoint change source
+func parseSetpointChange(payload []byte) (float64, string, bool) {
+	var state map[string]interface{}
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return 0, "", false
+	}
+	setpoint, setpointOk := state[setpointAttribute].(float64)
+	source, sourceOk := state[setpointChangeSourceAttribute].(string)
+	return setpoint, source, setpointOk && sourceOk
+}
+
+// Record manual setpoint change reported on the TRV state topic as hold of the scheduler, change of any TRV of
+// the zone holds the whole zone
+//
+// The TRV repeats the last change source in every state report, so only a change of the reported setpoint or source
+// is a new manual change. The first report after start (eg. retained state) isn't taken as a change.
+//
+//	in: trv - topic of the reporting TRV
+//	out: bool - true if a hold was started
+func recordManualSetpoint(scheduler TemperatureScheduler, trv string, payload []byte, now time.Time) bool {
+	setpoint, source, ok := parseSetpointChange(payload)
+	if !ok {
+		return false
+	}
+
+	mu.Lock()
+	previous, exist := observedSetpoints[trv]
+	observedSetpoints[trv] = observedSetpoint{source: source, setpoint: setpoint}
+	mu.Unlock()
+	if !exist || source != setpointChangeSourceManual || previous == (observedSetpoint{source: source, setpoint: setpoint}) {
+		return false
+	}
+
+	if getHoldPolicy(scheduler) == holdIgnore {
+		log.Printf("Manual setpoint %s°C of %s ignored, the schedule is kept", formatSetpoint(setpoint), trv)
+		return false
+	}
+	if err := checkSetpointLimit(setpoint, getSchedulerTrvModel(scheduler)); err != nil {
+		log.Printf("Warning! Manual setpoint of %s ignored: %v", scheduler.Topic, err)
+		return false
+	}
+	hold := store.Hold{Temperature: setpoint, Until: getHoldEnd(scheduler, now), Created: now}
+	log.Printf("Manual setpoint %s°C of %s held until %s", formatSetpoint(setpoint), scheduler.Topic, hold.Until.Format(time.RFC3339))
+	stateStore.Update(func(state *store.State) bool {
+		state.Holds[scheduler.Topic] = hold
+		return true
+	})
+	return true
+}
+
+// Get manual hold of the scheduler active at given time
+func getActiveHold(topic string, now time.Time) (store.Hold, bool) {
+	var hold store.Hold
+	var exist bool
+	stateStore.View(func(state *store.State) {
+		hold, exist = state.Holds[topic]
+	})
+	if !exist || !hold.Until.After(now) {
+		return store.Hold{}, false
+	}
+	return hold, true
+}
+
+// Remove expired manual holds
+//
+//	out: topics of the expired holds
+func pruneHolds(now time.Time) []string {
+	var expired []string
+	stateStore.Update(func(state *store.State) bool {
+		for topic, hold := range state.Holds {
+			if !hold.Until.After(now) {
+				log.Printf("Manual hold of %s to %s°C expired, returning to the schedule", topic, formatSetpoint(hold.Temperature))
+				delete(state.Holds, topic)
+				expired = append(expired, topic)
+			}
+		}
+		return len(expired) > 0
+	})
+	return expired
+}
+
+// Remove manual hold of the topic
+func forgetHold(topic string) {
+	stateStore.Update(func(state *store.State) bool {
+		delete(state.Holds, topic)
+		return true
+	})
+}
+
+// Forget setpoint reported by the TRV of the removed scheduler
+func forgetObservedSetpoint(topic string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(observedSetpoints, topic)
+}
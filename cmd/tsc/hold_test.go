@@ -0,0 +1,127 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/mqtttest"
+	"github.com/jacfal.io/homeaut/utils"
+)
+
+func TestGetHoldEnd(t *testing.T) {
+	scheduler := TemperatureScheduler{Topic: "trv", DefaultTemperature: 21, TimeTable: []TimeTable{{Start: 79200, End: 21600, Temperature: 18}}}
+	now := time.Date(2023, 2, 4, 12, 0, 30, 0, time.Local)
+
+	if end := getHoldEnd(scheduler, now); !end.Equal(time.Date(2023, 2, 4, 22, 0, 0, 0, time.Local)) {
+		log.Fatalf("until-next-slot hold should end at the next slot, got %v", end)
+	}
+	scheduler.ManualHoldDuration = utils.Duration(2 * time.Hour)
+	if end := getHoldEnd(scheduler, now); !end.Equal(now.Add(2 * time.Hour)) {
+		log.Fatalf("until-next-slot hold should be limited by the hold duration, got %v", end)
+	}
+	scheduler.ManualHold, scheduler.ManualHoldDuration = holdDuration, utils.Duration(12*time.Hour)
+	if end := getHoldEnd(scheduler, now); !end.Equal(now.Add(12 * time.Hour)) {
+		log.Fatalf("duration hold should end after the hold duration, got %v", end)
+	}
+
+	// boundaries of day programs are found to the second
+	scheduler = TemperatureScheduler{Topic: "trv", DefaultTemperature: 21, Programs: map[string]DayProgram{
+		"workday": {TimeTable: []TimeTable{{Start: 21615, End: 28800, Temperature: 22}}},
+	}}
+	if end := getHoldEnd(scheduler, now); !end.Equal(time.Date(2023, 2, 6, 6, 0, 15, 0, time.Local)) {
+		log.Fatalf("hold should end at the slot of the next workday, got %v", end)
+	}
+
+	if end := getHoldEnd(TemperatureScheduler{Topic: "trv", DefaultTemperature: 21}, now); !end.Equal(now.Add(maxHoldUntilNextSlot)) {
+		log.Fatalf("hold of the schedule without changes should end after %v, got %v", maxHoldUntilNextSlot, end)
+	}
+}
+
+func TestCheckManualHold(t *testing.T) {
+	if err := checkManualHold(TemperatureScheduler{ManualHold: holdIgnore}); err != nil {
+		log.Fatalf("ignore hold should be valid: %v", err)
+	}
+	if err := checkManualHold(TemperatureScheduler{ManualHold: holdDuration}); err == nil || !strings.Contains(err.Error(), "manualHoldDuration: must be set") {
+		log.Fatalf("duration hold without duration should be reported, got: %v", err)
+	}
+	if err := checkManualHold(TemperatureScheduler{ManualHold: "forever"}); err == nil || !strings.Contains(err.Error(), `manualHold: unknown manual hold "forever"`) {
+		log.Fatalf("unknown hold should be reported, got: %v", err)
+	}
+}
+
+func TestManualSetpointHold(t *testing.T) {
+	scheduler := TemperatureScheduler{Topic: "manual-trv", DefaultTemperature: 21, TimeTable: []TimeTable{{Start: 79200, End: 21600, Temperature: 18}}}
+	mu.Lock()
+	previousSchedulers := temperatureSchedulers
+	temperatureSchedulers = schedulersConfigs{scheduler}
+	lastTemperatures[scheduler.Topic] = 21
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		temperatureSchedulers = previousSchedulers
+		delete(lastTemperatures, scheduler.Topic)
+		mu.Unlock()
+		forgetHold(scheduler.Topic)
+		forgetObservedSetpoint(scheduler.Topic)
+		forgetConfirmation(scheduler.Topic)
+	}()
+
+	client := mqtttest.NewClient()
+	setTopic := heatingSetpointTopic(scheduler.Topic)
+	now := time.Date(2023, 2, 4, 12, 0, 0, 0, time.Local)
+
+	// first report (eg. retained state) only initializes, repeated reports aren't new changes
+	manual := []byte(`{"occupied_heating_setpoint": 23, "setpoint_change_source": "manual", "local_temperature": 20.5}`)
+	if recordManualSetpoint(scheduler, scheduler.Topic, manual, now) {
+		log.Fatal("first report shouldn't start a hold")
+	}
+	if recordManualSetpoint(scheduler, scheduler.Topic, []byte(`{"occupied_heating_setpoint": 21, "setpoint_change_source": "externally"}`), now) {
+		log.Fatal("external setpoint change shouldn't start a hold")
+	}
+	if !recordManualSetpoint(scheduler, scheduler.Topic, manual, now) {
+		log.Fatal("manual setpoint change should start a hold")
+	}
+	if recordManualSetpoint(scheduler, scheduler.Topic, manual, now.Add(time.Minute)) {
+		log.Fatal("repeated report shouldn't start a hold again")
+	}
+
+	// the schedule keeps the manual setpoint until the next slot
+	updateScheduler(client, scheduler, now, false)
+	if published := client.PublishedTo(setTopic); len(published) != 1 || published[0] != "23" {
+		log.Fatalf("manual setpoint should be kept: %v", published)
+	}
+	status := getSchedulerStatus(scheduler, now)
+	if status.ManualHold == nil || status.ManualHold.Temperature != 23 || !status.ManualHold.Until.Equal(time.Date(2023, 2, 4, 22, 0, 0, 0, time.Local)) {
+		log.Fatalf("status should show the manual hold: %+v", status)
+	}
+	updateScheduler(client, scheduler, now.Add(time.Minute), false)
+	slotStart := time.Date(2023, 2, 4, 22, 0, 0, 0, time.Local)
+	if expired := pruneHolds(slotStart); len(expired) != 1 || expired[0] != scheduler.Topic {
+		log.Fatalf("pruneHolds() = %v", expired)
+	}
+	updateScheduler(client, scheduler, slotStart, false)
+	if published := client.PublishedTo(setTopic); len(published) != 2 || published[1] != "18" {
+		log.Fatalf("schedule should be restored at the next slot: %v", published)
+	}
+
+	// override command cancels the hold
+	client.Reset()
+	subscribeSchedulers(client, schedulersConfigs{scheduler})
+	client.Deliver(scheduler.Topic, `{"occupied_heating_setpoint": 24, "setpoint_change_source": "manual"}`)
+	if _, active := getActiveHold(scheduler.Topic, time.Now()); !active {
+		log.Fatal("manual setpoint delivered on the state topic should start a hold")
+	}
+	applyOverrideCommand(client, scheduler.Topic, []byte(`{"temperature": 20, "duration": "1h"}`), time.Now())
+	if _, active := getActiveHold(scheduler.Topic, time.Now()); active {
+		log.Fatal("override command should cancel the hold")
+	}
+	forgetOverride(scheduler.Topic)
+
+	// manual changes are overwritten by the schedule with the ignore policy
+	scheduler.ManualHold = holdIgnore
+	if recordManualSetpoint(scheduler, scheduler.Topic, []byte(`{"occupied_heating_setpoint": 25, "setpoint_change_source": "manual"}`), now) {
+		log.Fatal("manual setpoint change should be ignored")
+	}
+}
@@ -5,23 +5,81 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"os"
+	"sync"
 	"time"
+	_ "time/tzdata" // time zones don't depend on the system database
 
 	"github.com/go-co-op/gocron"
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/pkg/sensors"
+	"github.com/jacfal.io/homeaut/pkg/status"
+	"github.com/jacfal.io/homeaut/pkg/store"
 	"github.com/jacfal.io/homeaut/utils"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 )
 
+const (
+	defaultShutdownTimeout = 30 * time.Second
+	defaultMqttClientID    = "tsc"
+)
+
 var (
+	// configured schedulers (configuration file merged with --scheduler args), guarded by mu
 	temperatureSchedulers schedulersConfigs
 
+	shutdownTimeout = defaultShutdownTimeout
+	mqttClientID    = defaultMqttClientID
+	mqttUsername    string
+	mqttPassword    string
+	argFlags        *config.Flags
+
+	// TRV models of the configuration file, complement models known by the sensors package
+	trvModels   map[string]sensors.TrvModel
+	trvModelsMu sync.Mutex
+
+	// persisted last published temperatures
+	stateStore = store.NewMemoryStore()
+
+	// serializes scheduler updates of the ticker and override commands
+	updateMu sync.Mutex
+
+	// retained scheduler status documents
+	statusPublisher = status.NewPublisher()
+
 	// input args
-	mqttBroker = flag.String("broker", "tcp://localhost:1883", "MQTT broker connection string")
+	configFile         = flag.String("config", "", "Configuration file (YAML or JSON), command line args take precedence")
+	serviceTopic       = flag.String("service-topic", "go-home/tsc", "Topic prefix of the service availability (<service-topic>/availability)")
+	metricsListen      = flag.String("metrics-listen", "", "Address of the Prometheus metrics endpoint, eg. ':9102' (empty = disabled)")
+	apiListen          = flag.String("api-listen", "", "Address of the HTTP API switching profiles, eg. 'localhost:9112' (empty = disabled)")
+	activeProfile      = flag.String("profile", "", "Active heating profile unless switched at runtime (empty = default)")
+	stateFile          = flag.String("state", "", "State file keeping last published temperatures over restarts (empty = memory only)")
+	watchConfig        = flag.Duration("watch-config", 0, "Reload configuration file when it changes, checked on this interval (0 = reload on SIGHUP only)")
+	timeZone           = flag.String("time-zone", "", "IANA time zone of the schedules, eg. 'Europe/Prague' (empty = process local time zone)")
+	latitudeArg        = flag.String("latitude", "", "Latitude of the installation for sunrise and sunset times, eg. '50.08' (empty = not set)")
+	longitudeArg       = flag.String("longitude", "", "Longitude of the installation for sunrise and sunset times, eg. '14.44' (empty = not set)")
+	outdoorSensorTopic = flag.String("outdoor-sensor-topic", "", "Outdoor temperature sensor topic, heating rates of optimum start are learned against it (empty = not used)")
+	outdoorSensorModel = flag.String("outdoor-sensor-model", "", "Outdoor sensor payload decoder (empty = default sensor model)")
+	reassertInterval   = flag.Duration("reassert-interval", time.Hour, "Publish current setpoint again when last publish is older (0 = disabled)")
+	confirmTimeout     = flag.Duration("confirm-timeout", 2*time.Minute, "Publish setpoint again when the TRV doesn't report it on its state topic in this time (0 = disabled)")
+	confirmRetries     = flag.Int("confirm-retries", 3, "Number of publish retries of the setpoint not confirmed by the TRV")
+	previewDays        = flag.Int("days", 7, "Preview: number of days to preview")
+	previewFrom        = flag.String("from", "", "Preview: start date (2006-01-02) or RFC 3339 time (empty = now)")
+	previewFormat      = flag.String("format", previewFormatTable, "Preview: output format (table, json, csv)")
+	mqttBroker         = flag.String("broker", "tcp://localhost:1883", "MQTT broker connection string")
+	schedulerArgs      schedulersConfigs
 )
 
 type schedulersConfigs []TemperatureScheduler
 
+// errors of --scheduler args, reported together with other configuration problems
+var schedulerArgsErrors config.Errors
+
+// indexes of --scheduler args failed to parse, not checked further
+var invalidSchedulerArgs = map[int]bool{}
+
 func (i *schedulersConfigs) String() string {
 	return "my string representation"
 }
@@ -29,42 +87,172 @@ func (i *schedulersConfigs) String() string {
 func (i *schedulersConfigs) Set(value string) error {
 	result, err := parseTimeTable(value)
 	if err != nil {
-		log.Fatalf("Can't parse scheduler config: %v", err)
+		// invalid scheduler is kept, so indexes of args match, tsc doesn't start with invalid args
+		schedulerArgsErrors.Append(config.WithPath(fmt.Sprintf("--scheduler[%d]", len(*i)), err))
+		invalidSchedulerArgs[len(*i)] = true
 	}
 	*i = append(*i, result)
 	return nil
 }
 
-func checkAndUpdate(client MQTT.Client, schedulers schedulersConfigs) {
-	for _, scheduler := range schedulers {
-		update, temperature := temperatureUpdateNeeded(scheduler, time.Now())
-		if update {
-			heatingSetpointTopic := fmt.Sprintf("%s/set/occupied_heating_setpoint_scheduled", scheduler.Topic)
-			log.Printf("Updating %s to %d°C", heatingSetpointTopic, temperature)
-			if token := client.Publish(heatingSetpointTopic, 0, false, fmt.Sprintf("%d", temperature)); token.Wait() && token.Error() != nil {
-				log.Printf("Error publishing to topic %s: %v", heatingSetpointTopic, token.Error())
-			} else {
-				log.Printf("Published temperature %d°C to topic %s", temperature, heatingSetpointTopic)
-			}
+// Get configured schedulers
+func getSchedulers() schedulersConfigs {
+	mu.Lock()
+	defer mu.Unlock()
+	return temperatureSchedulers
+}
+
+// Get configured scheduler of the topic
+func getScheduler(topic string) (TemperatureScheduler, bool) {
+	for _, scheduler := range getSchedulers() {
+		if scheduler.Topic == topic {
+			return scheduler, true
+		}
+	}
+	return TemperatureScheduler{}, false
+}
+
+func checkAndUpdate(client MQTT.Client) {
+	tickStart := time.Now()
+	defer func() {
+		tickDurationHistogram.Observe(time.Since(tickStart).Seconds())
+	}()
+
+	pruneOverrides(tickStart)
+	pruneHolds(tickStart)
+	pruneExceptions(getSchedulers(), tickStart)
+	refreshCalendars()
+	for _, scheduler := range getSchedulers() {
+		updateScheduler(client, scheduler, time.Now(), false)
+	}
+}
+
+// Publish temperature of the scheduler when it changed, wasn't confirmed by the TRV or is due to re-assert, and its status
+//
+//	in: force - publish temperature even if it didn't change
+func updateScheduler(client MQTT.Client, scheduler TemperatureScheduler, now time.Time, force bool) {
+	updateMu.Lock()
+	defer updateMu.Unlock()
+
+	updatePreheat(scheduler, now)
+	update, temperature := temperatureUpdateNeeded(scheduler, now)
+	var unconfirmed []string
+	if !update {
+		unconfirmed = getUnconfirmedTrvs(scheduler, now)
+	}
+	retry := len(unconfirmed) > 0
+	if !update && !force && !retry && reassertNeeded(scheduler.Topic, now) {
+		log.Printf("Re-asserting setpoint of %s", scheduler.Topic)
+		force = true
+	}
+	if (force || retry) && !update {
+		temperature = getTargetTemperature(scheduler, now)
+		mu.Lock()
+		lastTemperatures[scheduler.Topic] = temperature
+		mu.Unlock()
+		update = true
+	}
+	scheduledSetpointGauge.Set(getTemperatureAtTime(scheduler, now), scheduler.Topic)
+	if update {
+		trvs := scheduler.trvTopics()
+		if retry && !force {
+			// TRVs that confirmed the setpoint aren't set again
+			trvs = unconfirmed
+		}
+		if publishSetpoint(client, scheduler, trvs, temperature, now, retry) {
+			recordSetpoint(scheduler.Topic, temperature, now)
+			startWarmUp(scheduler, temperature, now)
 		}
 	}
+	publishSchedulerStatus(client, scheduler, now)
 }
 
 func main() {
 	log.Printf("=== Starting TRV temperature scheduler ===")
 
-	flag.Var(&temperatureSchedulers, "scheduler", "Scheduler configuration (use format json formatted string: '{\"topic\": \"topic1\", \"defaultTemperature\": 22, \"timeTable\": [{\"start\": \"22:30\", \"end\": \"05:30\", \"temperature\": 18}]}'))")
+	flag.Var(&schedulerArgs, "scheduler", "Scheduler configuration (use format json formatted string: '{\"topic\": \"topic1\", \"defaultTemperature\": 22, \"timeTable\": [{\"start\": \"22:30\", \"end\": \"05:30\", \"temperature\": 18}]}'))")
+	command, err := parseCommand()
+	if err != nil {
+		log.Fatalf("Error! %v", err)
+	}
 	flag.Parse()
 
+	// report all configuration problems at once
+	argFlags = config.CommandLineFlags()
+	configErrors := schedulerArgsErrors
+	temperatureSchedulers = schedulerArgs
+	var calendarConfigs []Calendar
+	if *configFile != "" {
+		cfg, err := loadConfig(*configFile)
+		if err != nil {
+			configErrors.Append(err)
+		} else {
+			applyConfig(cfg)
+			calendarConfigs = cfg.Tsc.Calendars
+		}
+	}
+	configErrors.Append(checkSchedulerArgs(trvModels))
+	if err := setInstallationLocation(*timeZone); err != nil {
+		configErrors.Append(config.FieldErr("--time-zone", err))
+	}
+	// floating times of the calendars are read in the installation time zone
+	configErrors.Append(config.WithPath("tsc", setCalendars(calendarConfigs)))
+	if err := checkProfileName(*activeProfile, temperatureSchedulers); err != nil {
+		configErrors.Append(config.FieldErr("--profile", err))
+	}
+	configErrors.Append(checkSolarSchedules(temperatureSchedulers, *latitudeArg, *longitudeArg, time.Now()))
+	if command == commandValidate {
+		os.Exit(runValidate(os.Stdout, temperatureSchedulers, configErrors.Err()))
+	}
+	if command == commandPreview {
+		if err := configErrors.Err(); err != nil {
+			os.Exit(runValidate(os.Stderr, temperatureSchedulers, err))
+		}
+		// overrides of the state are previewed, the state isn't changed
+		if *stateFile != "" {
+			if stateStore, err = store.Open(*stateFile); err != nil {
+				log.Fatalf("Error! %v", err)
+			}
+		}
+		os.Exit(runPreview(os.Stdout, os.Stderr, temperatureSchedulers, *previewFrom, *previewDays, *previewFormat))
+	}
+	if err := configErrors.Err(); err != nil {
+		log.Fatalf("Error! Invalid configuration:\n%v", err)
+	}
+
 	log.Printf("Schedulers: %v", temperatureSchedulers)
 	log.Printf("MQTT broker host: %s", *mqttBroker)
+	log.Printf("Time zone: %s", installationLocation())
 
-	// check schedulers overlaps
-	for _, temperatureScheduler := range temperatureSchedulers {
-		checkTimeTableOverlap(temperatureScheduler)
+	if *stateFile != "" {
+		var err error
+		if stateStore, err = store.Open(*stateFile); err != nil {
+			log.Fatalf("Error! %v", err)
+		}
+		stateStore.AutoFlush(context.Background(), time.Minute)
 	}
+	restoreState()
 
-	connOpts := MQTT.NewClientOptions().AddBroker(*mqttBroker).SetClientID("tsc").SetCleanSession(true)
+	connOpts := MQTT.NewClientOptions().AddBroker(*mqttBroker).SetClientID(mqttClientID).SetCleanSession(true)
+	connOpts.SetUsername(mqttUsername).SetPassword(mqttPassword)
+	// override commands publish from the message handler
+	connOpts.SetOrderMatters(false)
+	status.SetWill(connOpts, *serviceTopic)
+	connOpts.OnConnect = func(c MQTT.Client) {
+		if err := status.PublishAvailability(c, *serviceTopic, status.Online); err != nil {
+			log.Printf("Error publishing availability: %v", err)
+		}
+		statusPublisher.Reset()
+		subscribeSchedulers(c, getSchedulers())
+		subscribeProfileCommand(c)
+		subscribeOutdoorSensor(c)
+		publishProfiles(c)
+
+		// TRVs may have missed publishes while tsc or the broker was down
+		for _, scheduler := range getSchedulers() {
+			updateScheduler(c, scheduler, time.Now(), true)
+		}
+	}
 	client := MQTT.NewClient(connOpts)
 	if token := client.Connect(); token.Wait() && token.Error() != nil {
 		log.Fatalf("Error, broker connection failed: %s", token.Error())
@@ -72,15 +260,48 @@ func main() {
 		log.Printf("Connected to the MQTT broker")
 	}
 
-	scheduler := gocron.NewScheduler(time.UTC)
-	scheduler.Every(1).Minute().Do(checkAndUpdate, client, temperatureSchedulers)
+	scheduler := gocron.NewScheduler(installationLocation())
+	scheduler.Every(1).Minute().Do(checkAndUpdate, client)
 	scheduler.StartAsync()
 
-	wait := utils.GracefulShutdown(context.Background(), 30*time.Second, map[string]utils.Operation{
+	// reload configuration on SIGHUP or configuration file change
+	utils.WatchReload(context.Background(), *configFile, *watchConfig, func() {
+		reloadConfig(client)
+	})
+
+	cleanUpOps := map[string]utils.Operation{
 		"close-mqtt": func(ctx context.Context) error {
-			client.Disconnect(0)
-			return nil
+			defer client.Disconnect(250)
+			return status.PublishAvailability(client, *serviceTopic, status.Offline)
 		},
-	})
+		"flush-state": func(ctx context.Context) error {
+			return stateStore.Flush()
+		},
+	}
+
+	// HTTP endpoints, metrics and API share the server when listening on the same address
+	httpMuxes := map[string]*http.ServeMux{}
+	getHTTPMux := func(addr string) *http.ServeMux {
+		if _, exist := httpMuxes[addr]; !exist {
+			httpMuxes[addr] = http.NewServeMux()
+		}
+		return httpMuxes[addr]
+	}
+	if *metricsListen != "" {
+		registerRuntimeMetrics(client)
+		getHTTPMux(*metricsListen).Handle("/metrics", metricsRegistry.Handler())
+	}
+	if *apiListen != "" {
+		api := &profileAPI{client: client}
+		getHTTPMux(*apiListen).Handle(profileAPIPath, api)
+		getHTTPMux(*apiListen).Handle(profileAPIPath+"/", api)
+		getHTTPMux(*apiListen).Handle(optimumStartAPIPath, optimumStartAPI{})
+		getHTTPMux(*apiListen).Handle(optimumStartAPIPath+"/", optimumStartAPI{})
+	}
+	for addr, httpMux := range httpMuxes {
+		cleanUpOps["close-http-"+addr] = utils.StartHTTPServer(addr, httpMux)
+	}
+
+	wait := utils.GracefulShutdown(context.Background(), shutdownTimeout, cleanUpOps)
 	<-wait
 }
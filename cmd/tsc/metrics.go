@@ -0,0 +1,31 @@
+package main
+
+import (
+	"github.com/jacfal.io/homeaut/pkg/metrics"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+var (
+	metricsRegistry = metrics.NewRegistry()
+
+	scheduledSetpointGauge = metricsRegistry.NewGauge("tsc_scheduled_setpoint_celsius", "Setpoint currently scheduled for the TRV.", "topic")
+	publishCounter         = metricsRegistry.NewCounter("tsc_publish_total", "Setpoint publishes to the TRV by result.", "topic", "result")
+	tickDurationHistogram  = metricsRegistry.NewHistogram("tsc_tick_duration_seconds", "Duration of the scheduler tick evaluating all schedulers.", []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5})
+)
+
+// Register metrics computed on scrape
+func registerRuntimeMetrics(client MQTT.Client) {
+	metricsRegistry.NewGaugeFunc("tsc_mqtt_connected", "Whether the MQTT broker is connected (1) or not (0).", nil, func(emit func(value float64, labelValues ...string)) {
+		if client.IsConnected() {
+			emit(1)
+		} else {
+			emit(0)
+		}
+	})
+}
@@ -0,0 +1,391 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/pkg/sensors"
+	"github.com/jacfal.io/homeaut/pkg/store"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// TRV state attribute of the room temperature, used when the scheduler doesn't have a sensor
+	roomTemperatureAttribute = "local_temperature"
+
+	// warm-ups smaller than this aren't learned nor started ahead, °C
+	minWarmUpRise = 0.5
+	// the room reached the setpoint when it's at most this below, °C
+	warmUpTolerance = 0.2
+	// warm-up not finished in this time isn't learned, eg. window open or heating off
+	maxWarmUpDuration = 8 * time.Hour
+	// number of the latest warm-ups kept per room
+	warmUpsKept = 30
+	// heating rate is predicted from at least this number of warm-ups
+	minWarmUps = 3
+	// outdoor temperatures of the warm-ups must spread at least this to fit the rate to them, °C
+	minOutdoorSpread = 3
+	// predicted heating rate doesn't go below this, °C per hour
+	minHeatingRate = 0.1
+
+	// readings older than this aren't used
+	maxRoomReadingAge    = time.Hour
+	maxOutdoorReadingAge = 3 * time.Hour
+)
+
+type temperatureReading struct {
+	temperature float64
+	time        time.Time
+}
+
+// warmUp is the room heating up to a higher setpoint published to the TRV
+type warmUp struct {
+	started time.Time
+	from    float64 // room temperature at the start
+	target  float64
+	outdoor *float64
+}
+
+// preheat is the setpoint of the next slot published ahead, so the room reaches it at the slot start
+type preheat struct {
+	temperature float64
+	started     time.Time
+	at          time.Time // start of the slot
+}
+
+// heatingModel is the learned heating rate of the room, published by the API
+type heatingModel struct {
+	Topic       string         `json:"topic"`
+	MaxLead     string         `json:"maxLead"`               // maximum lead time of the optimum start
+	HeatingRate *float64       `json:"heatingRate,omitempty"` // predicted at the current outdoor temperature, °C per hour
+	Intercept   *float64       `json:"intercept,omitempty"`   // heating rate at 0°C outdoor, when fitted to outdoor temperatures
+	Slope       *float64       `json:"slope,omitempty"`       // change of the heating rate per outdoor °C
+	Room        *float64       `json:"roomTemperature,omitempty"`
+	Outdoor     *float64       `json:"outdoorTemperature,omitempty"`
+	Preheat     *override      `json:"preheat,omitempty"` // setpoint of the next slot published ahead, until the slot starts
+	WarmUps     []store.WarmUp `json:"warmUps"`
+}
+
+var (
+	// key: scheduler topic, guarded by optimumMu
+	roomTemperatures = map[string]temperatureReading{}
+	warmUps          = map[string]warmUp{}
+	preheats         = map[string]preheat{}
+
+	outdoorTemperature *temperatureReading
+	optimumMu          sync.Mutex
+)
+
+// Check optimum start settings of the scheduler
+func checkOptimumStart(scheduler TemperatureScheduler) error {
+	var errs config.Errors
+	if scheduler.OptimumStartMaxLead < 0 {
+		errs.Append(config.FieldErr("optimumStartMaxLead", errors.New("must not be negative")))
+	}
+	if scheduler.SensorModel != "" {
+		if _, err := sensors.GetDecoder(scheduler.SensorModel); err != nil {
+			errs.Append(config.FieldErr("sensorModel", err))
+		}
+	}
+	return errs.Err()
+}
+
+// Get room temperature reported by the TRV state payload
+func parseRoomTemperature(payload []byte) (float64, bool) {
+	var state map[string]interface{}
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return 0, false
+	}
+	temperature, ok := state[roomTemperatureAttribute].(float64)
+	return temperature, ok
+}
+
+// Get schedulers measuring room temperature by the sensor topic
+func getSensorSchedulers(topic string) schedulersConfigs {
+	var schedulers schedulersConfigs
+	for _, scheduler := range getSchedulers() {
+		for _, sensor := range scheduler.sensorTopics() {
+			if sensor == topic {
+				schedulers = append(schedulers, scheduler)
+				break
+			}
+		}
+	}
+	return schedulers
+}
+
+func onRoomSensorMessageReceived(schedulers schedulersConfigs, msg MQTT.Message) {
+	now := time.Now()
+	for _, scheduler := range schedulers {
+		data, err := sensors.DecodePayload(scheduler.SensorModel, string(msg.Payload()))
+		if err != nil {
+			log.Printf("Error! Room sensor %s of %s: %v", msg.Topic(), scheduler.Topic, err)
+			continue
+		}
+		recordZoneTemperature(scheduler, msg.Topic(), float64(data.GetTemperature()), now)
+	}
+}
+
+// Record room temperature and learn the warm-up when the room reached the setpoint
+func recordRoomTemperature(topic string, temperature float64, now time.Time) {
+	optimumMu.Lock()
+	defer optimumMu.Unlock()
+	roomTemperatures[topic] = temperatureReading{temperature: temperature, time: now}
+
+	current, exist := warmUps[topic]
+	if !exist {
+		return
+	}
+	if elapsed := now.Sub(current.started); elapsed > maxWarmUpDuration {
+		log.Printf("Warning! %s didn't reach %s°C in %s, warm-up not learned", topic, formatSetpoint(current.target), maxWarmUpDuration)
+		delete(warmUps, topic)
+	} else if temperature >= current.target-warmUpTolerance && elapsed > 0 {
+		delete(warmUps, topic)
+		rise := temperature - current.from
+		learned := store.WarmUp{Time: now, Rise: rise, Rate: rise / elapsed.Hours(), Outdoor: current.outdoor}
+		log.Printf("Warm-up of %s learned: %.1f°C in %s (%.2f°C/h)", topic, rise, elapsed.Round(time.Minute), learned.Rate)
+		stateStore.Update(func(state *store.State) bool {
+			learnedWarmUps := append(state.WarmUps[topic], learned)
+			if len(learnedWarmUps) > warmUpsKept {
+				learnedWarmUps = learnedWarmUps[len(learnedWarmUps)-warmUpsKept:]
+			}
+			state.WarmUps[topic] = learnedWarmUps
+			return true
+		})
+	}
+}
+
+func onOutdoorSensorMessageReceived(client MQTT.Client, msg MQTT.Message) {
+	data, err := sensors.DecodePayload(*outdoorSensorModel, string(msg.Payload()))
+	if err != nil {
+		log.Printf("Error! Outdoor sensor %s: %v", msg.Topic(), err)
+		return
+	}
+	recordOutdoorTemperature(float64(data.GetTemperature()), time.Now())
+}
+
+func recordOutdoorTemperature(temperature float64, now time.Time) {
+	optimumMu.Lock()
+	defer optimumMu.Unlock()
+	outdoorTemperature = &temperatureReading{temperature: temperature, time: now}
+}
+
+// Subscribe outdoor temperature sensor (--outdoor-sensor-topic)
+func subscribeOutdoorSensor(client MQTT.Client) {
+	if *outdoorSensorTopic == "" {
+		return
+	}
+	if token := client.Subscribe(*outdoorSensorTopic, 0, onOutdoorSensorMessageReceived); token.Wait() && token.Error() != nil {
+		log.Printf("Error! Topic %s subscription failed: %s", *outdoorSensorTopic, token.Error())
+	} else {
+		log.Printf("Topic %s subscribed", *outdoorSensorTopic)
+	}
+}
+
+// Get room and outdoor temperatures not older than their limits, guarded by optimumMu
+func getReadings(topic string, now time.Time) (*float64, *float64) {
+	var room, outdoor *float64
+	if reading, exist := roomTemperatures[topic]; exist && now.Sub(reading.time) <= maxRoomReadingAge {
+		temperature := reading.temperature
+		room = &temperature
+	}
+	if outdoorTemperature != nil && now.Sub(outdoorTemperature.time) <= maxOutdoorReadingAge {
+		temperature := outdoorTemperature.temperature
+		outdoor = &temperature
+	}
+	return room, outdoor
+}
+
+// Start learning warm-up of the room to the published setpoint, other setpoints end the warm-up
+func startWarmUp(scheduler TemperatureScheduler, target float64, now time.Time) {
+	if scheduler.OptimumStartMaxLead <= 0 {
+		return
+	}
+	optimumMu.Lock()
+	defer optimumMu.Unlock()
+	if current, exist := warmUps[scheduler.Topic]; exist && current.target == target {
+		// re-asserted or retried setpoint
+		return
+	}
+	delete(warmUps, scheduler.Topic)
+	room, outdoor := getReadings(scheduler.Topic, now)
+	if room == nil || target-*room < minWarmUpRise {
+		return
+	}
+	warmUps[scheduler.Topic] = warmUp{started: now, from: *room, target: target, outdoor: outdoor}
+}
+
+// Fit heating rate of the warm-ups to the outdoor temperature, rate = intercept + slope * outdoor
+//
+//	out: intercept; slope; bool - false if there aren't enough warm-ups with spread outdoor temperatures
+func fitHeatingRate(learned []store.WarmUp) (float64, float64, bool) {
+	var n, sumX, sumY, sumXX, sumXY float64
+	minX, maxX := math.Inf(1), math.Inf(-1)
+	for _, current := range learned {
+		if current.Outdoor == nil {
+			continue
+		}
+		x, y := *current.Outdoor, current.Rate
+		n++
+		sumX, sumY, sumXX, sumXY = sumX+x, sumY+y, sumXX+x*x, sumXY+x*y
+		minX, maxX = math.Min(minX, x), math.Max(maxX, x)
+	}
+	if n < minWarmUps || maxX-minX < minOutdoorSpread {
+		return 0, 0, false
+	}
+	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	return (sumY - slope*sumX) / n, slope, true
+}
+
+// Predict heating rate of the room, fitted to the outdoor temperature when known, average of the warm-ups otherwise
+//
+//	out: °C per hour; bool - false if there aren't enough warm-ups
+func predictHeatingRate(learned []store.WarmUp, outdoor *float64) (float64, bool) {
+	if len(learned) < minWarmUps {
+		return 0, false
+	}
+	if intercept, slope, fitted := fitHeatingRate(learned); fitted && outdoor != nil {
+		return math.Max(intercept+slope**outdoor, minHeatingRate), true
+	}
+	sum := 0.0
+	for _, current := range learned {
+		sum += current.Rate
+	}
+	return math.Max(sum/float64(len(learned)), minHeatingRate), true
+}
+
+func getWarmUps(topic string) []store.WarmUp {
+	var learned []store.WarmUp
+	stateStore.View(func(state *store.State) {
+		learned = append(learned, state.WarmUps[topic]...)
+	})
+	return learned
+}
+
+// Start heating up to the setpoint of the next slot when the room needs it to reach the setpoint at the slot start
+//
+// Only rising setpoints start ahead, at most optimumStartMaxLead. Started preheat is kept until the slot starts.
+func updatePreheat(scheduler TemperatureScheduler, now time.Time) {
+	if scheduler.OptimumStartMaxLead <= 0 {
+		return
+	}
+	scheduled := getTemperatureAtTime(scheduler, now)
+	optimumMu.Lock()
+	current, started := preheats[scheduler.Topic]
+	room, outdoor := getReadings(scheduler.Topic, now)
+	optimumMu.Unlock()
+	if started && now.Before(current.at) && current.temperature > scheduled && getTemperatureAtTime(scheduler, current.at) == current.temperature {
+		return
+	}
+	if started {
+		optimumMu.Lock()
+		delete(preheats, scheduler.Topic)
+		optimumMu.Unlock()
+	}
+
+	rate, predicted := predictHeatingRate(getWarmUps(scheduler.Topic), outdoor)
+	if room == nil || !predicted {
+		return
+	}
+	maxLead := scheduler.OptimumStartMaxLead.Duration()
+	from := now.Truncate(time.Second)
+	at, changed := findNextChange(from, from.Add(maxLead+time.Second), func(t time.Time) string {
+		return formatSetpoint(getTemperatureAtTime(scheduler, t))
+	})
+	if !changed {
+		return
+	}
+	next := getTemperatureAtTime(scheduler, at)
+	if next <= scheduled || next-*room < minWarmUpRise {
+		return
+	}
+	// the scheduler runs every minute
+	lead := time.Duration((next - *room) / rate * float64(time.Hour)).Round(time.Minute)
+	if lead > maxLead {
+		lead = maxLead
+	}
+	if now.Before(at.Add(-lead)) {
+		return
+	}
+
+	log.Printf("Optimum start of %s: heating from %.1f°C to %s°C at %.2f°C/h, %s before %s", scheduler.Topic, *room,
+		formatSetpoint(next), rate, at.Sub(now).Round(time.Minute), at.Format("15:04"))
+	optimumMu.Lock()
+	preheats[scheduler.Topic] = preheat{temperature: next, started: now, at: at}
+	optimumMu.Unlock()
+}
+
+// Get setpoint of the next slot started ahead by updatePreheat
+//
+//	in: scheduled - scheduled temperature at given time
+//	out: temperature; bool - false if the scheduled temperature applies
+func getPreheatTemperature(scheduler TemperatureScheduler, scheduled float64, now time.Time) (float64, bool) {
+	current, active := getActivePreheat(scheduler.Topic, now)
+	if !active || current.temperature <= scheduled {
+		return 0, false
+	}
+	return current.temperature, true
+}
+
+// Get preheat of the scheduler active at given time
+func getActivePreheat(topic string, now time.Time) (preheat, bool) {
+	optimumMu.Lock()
+	defer optimumMu.Unlock()
+	current, exist := preheats[topic]
+	return current, exist && !now.Before(current.started) && now.Before(current.at)
+}
+
+// Get learned heating model of the scheduler
+func getHeatingModel(scheduler TemperatureScheduler, now time.Time) heatingModel {
+	model := heatingModel{Topic: scheduler.Topic, MaxLead: scheduler.OptimumStartMaxLead.String(), WarmUps: getWarmUps(scheduler.Topic)}
+	if model.WarmUps == nil {
+		model.WarmUps = []store.WarmUp{}
+	}
+	optimumMu.Lock()
+	model.Room, model.Outdoor = getReadings(scheduler.Topic, now)
+	optimumMu.Unlock()
+	if rate, predicted := predictHeatingRate(model.WarmUps, model.Outdoor); predicted {
+		model.HeatingRate = &rate
+	}
+	if intercept, slope, fitted := fitHeatingRate(model.WarmUps); fitted {
+		model.Intercept, model.Slope = &intercept, &slope
+	}
+	if current, active := getActivePreheat(scheduler.Topic, now); active {
+		model.Preheat = &override{Temperature: current.temperature, Until: current.at}
+	}
+	return model
+}
+
+// Get learned heating models of the schedulers with optimum start, sorted by topic
+func getHeatingModels(now time.Time) []heatingModel {
+	models := []heatingModel{}
+	for _, scheduler := range getSchedulers() {
+		if scheduler.OptimumStartMaxLead > 0 {
+			models = append(models, getHeatingModel(scheduler, now))
+		}
+	}
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].Topic < models[j].Topic
+	})
+	return models
+}
+
+// Forget readings, warm-ups and preheat of the removed scheduler, learned warm-ups included
+func forgetOptimumStart(topic string) {
+	optimumMu.Lock()
+	delete(roomTemperatures, topic)
+	delete(warmUps, topic)
+	delete(preheats, topic)
+	optimumMu.Unlock()
+	stateStore.Update(func(state *store.State) bool {
+		delete(state.WarmUps, topic)
+		return true
+	})
+}
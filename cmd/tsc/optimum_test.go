@@ -0,0 +1,179 @@
+package main
+
+import (
+	"log"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/mqtttest"
+	"github.com/jacfal.io/homeaut/pkg/store"
+	"github.com/jacfal.io/homeaut/utils"
+)
+
+func TestCheckOptimumStart(t *testing.T) {
+	if err := checkOptimumStart(TemperatureScheduler{OptimumStartMaxLead: utils.Duration(2 * time.Hour), SensorModel: "sonoff-snzb-02"}); err != nil {
+		log.Fatalf("optimum start should be valid: %v", err)
+	}
+	err := checkOptimumStart(TemperatureScheduler{OptimumStartMaxLead: utils.Duration(-time.Hour), SensorModel: "thermometer"})
+	if err == nil || !strings.Contains(err.Error(), "optimumStartMaxLead: must not be negative") || !strings.Contains(err.Error(), "sensorModel:") {
+		log.Fatalf("invalid optimum start should be reported, got: %v", err)
+	}
+}
+
+func TestPredictHeatingRate(t *testing.T) {
+	outdoor := func(temperature float64) *float64 { return &temperature }
+	learned := []store.WarmUp{{Rate: 1}, {Rate: 2}}
+	if _, predicted := predictHeatingRate(learned, nil); predicted {
+		log.Fatal("rate shouldn't be predicted from too few warm-ups")
+	}
+	learned = append(learned, store.WarmUp{Rate: 3})
+	if rate, predicted := predictHeatingRate(learned, outdoor(0)); !predicted || rate != 2 {
+		log.Fatalf("rate without outdoor temperatures should be the average, got %v", rate)
+	}
+
+	// rate = 2 + 0.1 * outdoor
+	learned = []store.WarmUp{{Rate: 1, Outdoor: outdoor(-10)}, {Rate: 2, Outdoor: outdoor(0)}, {Rate: 3, Outdoor: outdoor(10)}}
+	if intercept, slope, fitted := fitHeatingRate(learned); !fitted || math.Abs(intercept-2) > 1e-9 || math.Abs(slope-0.1) > 1e-9 {
+		log.Fatalf("fitHeatingRate() = %v, %v, %v", intercept, slope, fitted)
+	}
+	if rate, _ := predictHeatingRate(learned, outdoor(5)); math.Abs(rate-2.5) > 1e-9 {
+		log.Fatalf("rate should be fitted to the outdoor temperature, got %v", rate)
+	}
+	if rate, _ := predictHeatingRate(learned, outdoor(-30)); rate != minHeatingRate {
+		log.Fatalf("rate should be at least %v, got %v", minHeatingRate, rate)
+	}
+	if rate, _ := predictHeatingRate(learned, nil); rate != 2 {
+		log.Fatalf("rate without outdoor temperature should be the average, got %v", rate)
+	}
+	learned[0].Outdoor, learned[2].Outdoor = outdoor(-1), outdoor(1)
+	if _, _, fitted := fitHeatingRate(learned); fitted {
+		log.Fatal("rate shouldn't be fitted to close outdoor temperatures")
+	}
+}
+
+func TestOptimumStart(t *testing.T) {
+	// 21°C from 06:00 to 22:00, 17°C otherwise
+	scheduler := TemperatureScheduler{
+		Topic:               "optimum-trv",
+		DefaultTemperature:  17,
+		TimeTable:           []TimeTable{{Start: 21600, End: 79200, Temperature: 21}},
+		SensorTopic:         "optimum-sensor",
+		OptimumStartMaxLead: utils.Duration(3 * time.Hour),
+	}
+	mu.Lock()
+	previousSchedulers := temperatureSchedulers
+	temperatureSchedulers = schedulersConfigs{scheduler}
+	lastTemperatures[scheduler.Topic] = 17
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		temperatureSchedulers = previousSchedulers
+		delete(lastTemperatures, scheduler.Topic)
+		mu.Unlock()
+		forgetOptimumStart(scheduler.Topic)
+		forgetConfirmation(scheduler.Topic)
+		forgetObservedSetpoint(scheduler.Topic)
+		stateStore.Update(func(state *store.State) bool {
+			delete(state.Setpoints, scheduler.Topic)
+			return true
+		})
+	}()
+
+	client := mqtttest.NewClient()
+	setTopic := heatingSetpointTopic(scheduler.Topic)
+	day := time.Date(2023, 2, 4, 0, 0, 0, 0, time.Local)
+
+	// nothing learned yet, the schedule applies
+	recordRoomTemperature(scheduler.Topic, 17, day.Add(4*time.Hour))
+	updateScheduler(client, scheduler, day.Add(4*time.Hour), false)
+	if published := client.PublishedTo(setTopic); len(published) != 0 {
+		log.Fatalf("setpoint shouldn't start ahead without learned warm-ups: %v", published)
+	}
+
+	// warm-ups of 2°C per hour are learned from the published setpoints
+	for i := 0; i < minWarmUps; i++ {
+		start := day.AddDate(0, 0, -i-1).Add(6 * time.Hour)
+		recordRoomTemperature(scheduler.Topic, 17, start)
+		startWarmUp(scheduler, 21, start)
+		recordRoomTemperature(scheduler.Topic, 19, start.Add(time.Hour))
+		recordRoomTemperature(scheduler.Topic, 20.8, start.Add(114*time.Minute))
+	}
+	if learned := getWarmUps(scheduler.Topic); len(learned) != minWarmUps || math.Abs(learned[0].Rate-2) > 1e-9 || math.Abs(learned[0].Rise-3.8) > 1e-9 {
+		log.Fatalf("warm-ups should be learned: %+v", learned)
+	}
+
+	// 4°C at 2°C per hour starts 2 hours ahead
+	recordRoomTemperature(scheduler.Topic, 17, day.Add(3*time.Hour+59*time.Minute))
+	updateScheduler(client, scheduler, day.Add(3*time.Hour+59*time.Minute), false)
+	if published := client.PublishedTo(setTopic); len(published) != 0 {
+		log.Fatalf("setpoint shouldn't start more than 2 hours ahead: %v", published)
+	}
+	updateScheduler(client, scheduler, day.Add(4*time.Hour), false)
+	if published := client.PublishedTo(setTopic); len(published) != 1 || published[0] != "21" {
+		log.Fatalf("setpoint of the next slot should start 2 hours ahead: %v", published)
+	}
+	status := getSchedulerStatus(scheduler, day.Add(4*time.Hour))
+	if status.Temperature != 17 || status.Preheat == nil || status.Preheat.Temperature != 21 || !status.Preheat.Until.Equal(day.Add(6*time.Hour)) {
+		log.Fatalf("status should show the preheat: %+v", status)
+	}
+	if source := getSetpointSource(scheduler, day.Add(5*time.Hour)); source != "preheat" {
+		log.Fatalf("preview source should be preheat, got %s", source)
+	}
+
+	// preheat is kept until the slot starts, even if the room warmed up
+	recordRoomTemperature(scheduler.Topic, 20, day.Add(5*time.Hour))
+	updateScheduler(client, scheduler, day.Add(5*time.Hour), false)
+	updateScheduler(client, scheduler, day.Add(6*time.Hour), false)
+	for _, published := range client.PublishedTo(setTopic) {
+		if published != "21" {
+			log.Fatalf("preheat should continue to the slot: %v", client.PublishedTo(setTopic))
+		}
+	}
+	if _, active := getActivePreheat(scheduler.Topic, day.Add(6*time.Hour)); active {
+		log.Fatal("preheat should end at the slot start")
+	}
+
+	// override wins over the preheat
+	applyOverrideCommand(client, scheduler.Topic, []byte(`{"temperature": 19, "duration": "1h"}`), day.Add(23*time.Hour))
+	defer forgetOverride(scheduler.Topic)
+	if temperature := getTargetTemperature(scheduler, day.Add(23*time.Hour)); temperature != 19 {
+		log.Fatalf("override should win over the schedule, got %v", temperature)
+	}
+}
+
+func TestRoomSensorTemperature(t *testing.T) {
+	scheduler := TemperatureScheduler{Topic: "sensor-trv", DefaultTemperature: 20, SensorTopic: "sensor-room"}
+	mu.Lock()
+	previousSchedulers := temperatureSchedulers
+	temperatureSchedulers = schedulersConfigs{scheduler, {Topic: "trv-temperature-trv", DefaultTemperature: 20}}
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		temperatureSchedulers = previousSchedulers
+		mu.Unlock()
+		forgetOptimumStart(scheduler.Topic)
+		forgetOptimumStart("trv-temperature-trv")
+		forgetZone(scheduler)
+		forgetZone(TemperatureScheduler{Topic: "trv-temperature-trv"})
+	}()
+
+	client := mqtttest.NewClient()
+	subscribeSchedulers(client, temperatureSchedulers)
+	client.Deliver("sensor-room", `{"temperature": 19.5, "humidity": 40}`)
+	client.Deliver(scheduler.Topic, `{"local_temperature": 22}`)
+	client.Deliver("trv-temperature-trv", `{"local_temperature": 18.5}`)
+
+	now := time.Now()
+	optimumMu.Lock()
+	room, _ := getReadings(scheduler.Topic, now)
+	trvRoom, _ := getReadings("trv-temperature-trv", now)
+	optimumMu.Unlock()
+	if room == nil || *room != 19.5 {
+		log.Fatalf("room temperature should come from the sensor, got %v", room)
+	}
+	if trvRoom == nil || *trvRoom != 18.5 {
+		log.Fatalf("room temperature should come from the TRV without sensor, got %v", trvRoom)
+	}
+}
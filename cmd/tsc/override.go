@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/store"
+	"github.com/jacfal.io/homeaut/utils"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+const overrideTopicSuffix = "/tsc/override"
+
+// overrideCommand is the payload of the override command topic, eg. {"temperature": 24, "duration": "2h"}
+type overrideCommand struct {
+	Temperature *float64       `json:"temperature"`
+	Until       *time.Time     `json:"until"`    // RFC 3339 time the override ends
+	Duration    utils.Duration `json:"duration"` // override length, alternative to until
+	Cancel      bool           `json:"cancel"`   // cancel active override, returns to the schedule
+}
+
+func overrideTopic(topic string) string {
+	return topic + overrideTopicSuffix
+}
+
+// Parse override command, empty payload cancels the override
+//
+//	out: override; bool - true if the override is canceled; error
+func parseOverride(payload []byte, now time.Time) (store.Override, bool, error) {
+	if len(strings.TrimSpace(string(payload))) == 0 {
+		return store.Override{}, true, nil
+	}
+
+	var command overrideCommand
+	decoder := json.NewDecoder(strings.NewReader(string(payload)))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&command); err != nil {
+		return store.Override{}, false, fmt.Errorf("invalid override command: %w", err)
+	}
+	if command.Cancel {
+		return store.Override{}, true, nil
+	}
+
+	if command.Temperature == nil {
+		return store.Override{}, false, errors.New("override temperature is missing")
+	}
+	var until time.Time
+	switch {
+	case command.Until != nil && command.Duration != 0:
+		return store.Override{}, false, errors.New("override accepts either until or duration, not both")
+	case command.Until != nil:
+		until = *command.Until
+	case command.Duration > 0:
+		until = now.Add(command.Duration.Duration())
+	default:
+		return store.Override{}, false, errors.New("override until or duration is missing")
+	}
+	if !until.After(now) {
+		return store.Override{}, false, fmt.Errorf("override ends in the past (%s)", until.Format(time.RFC3339))
+	}
+	return store.Override{Temperature: *command.Temperature, Until: until, Created: now}, false, nil
+}
+
+// Get override of the scheduler active at given time
+func getActiveOverride(topic string, now time.Time) (store.Override, bool) {
+	var override store.Override
+	var exist bool
+	stateStore.View(func(state *store.State) {
+		override, exist = state.Overrides[topic]
+	})
+	if !exist || !override.Until.After(now) {
+		return store.Override{}, false
+	}
+	return override, true
+}
+
+// Get temperature the TRV should have at given time, manual hold wins over active override and the schedule,
+// rising setpoint of the schedule may start ahead (optimum start)
+//
+//	out: temperature rounded to the setpoint step of the TRV model
+func getTargetTemperature(scheduler TemperatureScheduler, now time.Time) float64 {
+	temperature := getTemperatureAtTime(scheduler, now)
+	if preheat, active := getPreheatTemperature(scheduler, temperature, now); active {
+		temperature = preheat
+	}
+	if override, active := getActiveOverride(scheduler.Topic, now); active {
+		temperature = override.Temperature
+	}
+	if hold, active := getActiveHold(scheduler.Topic, now); active {
+		temperature = hold.Temperature
+	}
+	return getSchedulerTrvModel(scheduler).RoundSetpoint(temperature)
+}
+
+// Remove expired overrides
+//
+//	out: topics of the expired overrides
+func pruneOverrides(now time.Time) []string {
+	var expired []string
+	stateStore.Update(func(state *store.State) bool {
+		for topic, override := range state.Overrides {
+			if !override.Until.After(now) {
+				log.Printf("Override of %s to %.1f°C expired, returning to the schedule", topic, override.Temperature)
+				delete(state.Overrides, topic)
+				expired = append(expired, topic)
+			}
+		}
+		return len(expired) > 0
+	})
+	return expired
+}
+
+// Remove override of the topic
+func forgetOverride(topic string) {
+	stateStore.Update(func(state *store.State) bool {
+		delete(state.Overrides, topic)
+		return true
+	})
+}
+
+func onOverrideMessageReceived(client MQTT.Client, msg MQTT.Message) {
+	applyOverrideCommand(client, strings.TrimSuffix(msg.Topic(), overrideTopicSuffix), msg.Payload(), time.Now())
+}
+
+// Store or cancel override of the scheduler and publish the resulting temperature right away
+func applyOverrideCommand(client MQTT.Client, topic string, payload []byte, now time.Time) {
+	scheduler, exist := getScheduler(topic)
+	if !exist {
+		log.Printf("Warning! Override for unknown scheduler %s ignored", topic)
+		return
+	}
+
+	override, cancel, err := parseOverride(payload, now)
+	if err != nil {
+		log.Printf("Error! Override of %s rejected: %v", topic, err)
+		return
+	}
+	if !cancel {
+		if err := checkSetpointLimit(override.Temperature, getSchedulerTrvModel(scheduler)); err != nil {
+			log.Printf("Error! Override of %s rejected: %v", topic, err)
+			return
+		}
+	}
+	// the command is newer than the manual setpoint on the TRV
+	forgetHold(topic)
+	if cancel {
+		log.Printf("Override of %s canceled, returning to the schedule", topic)
+		forgetOverride(topic)
+	} else {
+		log.Printf("Override of %s to %.1f°C until %s", topic, override.Temperature, override.Until.Format(time.RFC3339))
+		stateStore.Update(func(state *store.State) bool {
+			state.Overrides[topic] = override
+			return true
+		})
+	}
+	updateScheduler(client, scheduler, now, true)
+}
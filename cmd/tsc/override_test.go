@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/mqtttest"
+)
+
+func TestParseOverride(t *testing.T) {
+	now := time.Date(2023, 2, 4, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		payload string
+		cancel  bool
+		until   time.Time
+		err     bool
+	}{
+		{payload: `{"temperature": 24, "duration": "2h"}`, until: now.Add(2 * time.Hour)},
+		{payload: `{"temperature": 24, "duration": 1800}`, until: now.Add(30 * time.Minute)},
+		{payload: `{"temperature": 24, "until": "2023-02-04T18:00:00Z"}`, until: time.Date(2023, 2, 4, 18, 0, 0, 0, time.UTC)},
+		{payload: ``, cancel: true},
+		{payload: `{"cancel": true}`, cancel: true},
+		{payload: `{"duration": "2h"}`, err: true},
+		{payload: `{"temperature": 24}`, err: true},
+		{payload: `{"temperature": 24, "duration": "2h", "until": "2023-02-04T18:00:00Z"}`, err: true},
+		{payload: `{"temperature": 24, "until": "2023-02-04T11:00:00Z"}`, err: true},
+		{payload: `{"temperature": 24, "duration": "2h", "unknown": 1}`, err: true},
+		{payload: `24`, err: true},
+	}
+
+	for _, tt := range tests {
+		override, cancel, err := parseOverride([]byte(tt.payload), now)
+		if (err != nil) != tt.err || cancel != tt.cancel {
+			log.Fatalf("parseOverride(%s) = %v, %v, %v", tt.payload, override, cancel, err)
+		}
+		if !tt.err && !tt.cancel && (override.Temperature != 24 || !override.Until.Equal(tt.until) || !override.Created.Equal(now)) {
+			log.Fatalf("parseOverride(%s) = %+v", tt.payload, override)
+		}
+	}
+}
+
+func TestApplyOverrideCommand(t *testing.T) {
+	scheduler := TemperatureScheduler{Topic: "override-trv", DefaultTemperature: 21}
+	mu.Lock()
+	previousSchedulers := temperatureSchedulers
+	temperatureSchedulers = schedulersConfigs{scheduler}
+	lastTemperatures[scheduler.Topic] = 21
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		temperatureSchedulers = previousSchedulers
+		delete(lastTemperatures, scheduler.Topic)
+		mu.Unlock()
+		forgetOverride(scheduler.Topic)
+	}()
+
+	client := mqtttest.NewClient()
+	setTopic := "override-trv/set/occupied_heating_setpoint_scheduled"
+	now := time.Date(2023, 2, 4, 12, 0, 0, 0, time.UTC)
+	applyOverrideCommand(client, scheduler.Topic, []byte(`{"temperature": 24, "duration": "2h"}`), now)
+	if published := client.PublishedTo(setTopic); len(published) != 1 || published[0] != "24" {
+		log.Fatalf("override wasn't published: %v", published)
+	}
+
+	var status schedulerStatus
+	statuses := client.PublishedTo(schedulerStatusTopic(scheduler.Topic))
+	if err := json.Unmarshal([]byte(statuses[len(statuses)-1]), &status); err != nil {
+		log.Fatal(err)
+	}
+	if status.Temperature != 21 || status.Override == nil || status.Override.Temperature != 24 || !status.Override.Until.Equal(now.Add(2*time.Hour)) {
+		log.Fatalf("status doesn't show the override: %+v", status)
+	}
+
+	// override wins over the schedule until it expires
+	if update, _ := temperatureUpdateNeeded(scheduler, now.Add(time.Hour)); update {
+		log.Fatalf("active override should keep the temperature")
+	}
+	expiry := now.Add(2 * time.Hour)
+	if expired := pruneOverrides(expiry); len(expired) != 1 || expired[0] != scheduler.Topic {
+		log.Fatalf("pruneOverrides() = %v", expired)
+	}
+	updateScheduler(client, scheduler, expiry, false)
+	if published := client.PublishedTo(setTopic); len(published) != 2 || published[1] != "21" {
+		log.Fatalf("schedule wasn't restored after override expiry: %v", published)
+	}
+
+	// unknown schedulers and invalid commands are ignored
+	client.Reset()
+	applyOverrideCommand(client, "unknown-trv", []byte(`{"temperature": 24, "duration": "2h"}`), now)
+	applyOverrideCommand(client, scheduler.Topic, []byte(`{"temperature": 24}`), now)
+	applyOverrideCommand(client, scheduler.Topic, []byte(`{"temperature": 45, "duration": "2h"}`), now)
+	if len(client.Published) != 0 {
+		log.Fatalf("invalid overrides shouldn't publish: %v", client.Published)
+	}
+}
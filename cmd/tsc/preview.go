@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	previewFormatTable = "table"
+	previewFormatJSON  = "json"
+	previewFormatCSV   = "csv"
+)
+
+// previewChange is a setpoint change of the schedule preview
+type previewChange struct {
+	Time        time.Time `json:"time"`
+	Topic       string    `json:"topic"`
+	Temperature float64   `json:"temperature"`
+	Source      string    `json:"source"` // manual, override, calendar, exception, default or time table slot, eg. 22:00-06:00
+}
+
+// Get source of the setpoint at given time
+func getSetpointSource(scheduler TemperatureScheduler, t time.Time) string {
+	if _, active := getActiveHold(scheduler.Topic, t); active {
+		return "manual"
+	}
+	if _, active := getActiveOverride(scheduler.Topic, t); active {
+		return "override"
+	}
+	if _, active := getPreheatTemperature(scheduler, getTemperatureAtTime(scheduler, t), t); active {
+		return "preheat"
+	}
+	source := defaultSlot
+	if timeTable, active := getTimeTableAtTime(scheduler, t); active {
+		source = formatSlot(timeTable)
+	}
+	if event, active := getActiveCalendarEvent(scheduler, scheduleTime(scheduler, t)); active && event.Temperature != nil {
+		return fmt.Sprintf("calendar %s", event.Summary)
+	} else if active {
+		return fmt.Sprintf("calendar %s %s", event.Summary, source)
+	}
+	if exception, active := getActiveException(scheduler, scheduleTime(scheduler, t)); active && exception.Temperature != nil {
+		source = fmt.Sprintf("exception %s", exception)
+	} else if active {
+		source = fmt.Sprintf("exception %s %s", exception, source)
+	}
+	return source
+}
+
+// Walk time forward minute by minute and collect setpoint changes of the schedulers, including overrides of the state
+//
+//	in: from - first listed setpoints; until - end of the preview (exclusive)
+func previewSchedules(schedulers schedulersConfigs, from time.Time, until time.Time) []previewChange {
+	var changes []previewChange
+	from = from.Truncate(time.Second)
+	for _, scheduler := range schedulers {
+		location := installationLocation()
+		if schedulerLocation, exist := schedulerLocation(scheduler); exist {
+			location = schedulerLocation
+		}
+		change := func(t time.Time, temperature float64) {
+			changes = append(changes, previewChange{Time: t.In(location), Topic: scheduler.Topic, Temperature: temperature, Source: getSetpointSource(scheduler, t)})
+		}
+
+		change(from, getTargetTemperature(scheduler, from))
+		target := func(t time.Time) string {
+			return formatSetpoint(getTargetTemperature(scheduler, t))
+		}
+		for t := from; ; {
+			changedAt, changed := findNextChange(t, until, target)
+			if !changed {
+				break
+			}
+			change(changedAt, getTargetTemperature(scheduler, changedAt))
+			t = changedAt
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Time.Before(changes[j].Time)
+	})
+	return changes
+}
+
+// Write preview in given format (table, json or csv)
+func writePreview(w io.Writer, changes []previewChange, format string) error {
+	switch format {
+	case previewFormatTable:
+		table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(table, "TIME\tTOPIC\tTEMPERATURE\tSOURCE")
+		for _, change := range changes {
+			fmt.Fprintf(table, "%s\t%s\t%s\t%s\n", change.Time.Format("2006-01-02 Mon 15:04:05 MST"), change.Topic, formatSetpoint(change.Temperature), change.Source)
+		}
+		return table.Flush()
+	case previewFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		if changes == nil {
+			changes = []previewChange{}
+		}
+		return encoder.Encode(changes)
+	case previewFormatCSV:
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"time", "topic", "temperature", "source"})
+		for _, change := range changes {
+			writer.Write([]string{change.Time.Format(time.RFC3339), change.Topic, formatSetpoint(change.Temperature), change.Source})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unknown preview format %q (formats: %s, %s, %s)", format, previewFormatTable, previewFormatJSON, previewFormatCSV)
+	}
+}
+
+// Parse start of the preview, date (midnight in the installation time zone) or RFC 3339 time, empty means now
+func parsePreviewFrom(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return now.Truncate(time.Minute), nil
+	}
+	if from, err := time.ParseInLocation("2006-01-02", value, installationLocation()); err == nil {
+		return from, nil
+	}
+	from, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid preview start %q, expected date (2006-01-02) or RFC 3339 time", value)
+	}
+	return from, nil
+}
+
+// Print setpoint changes of the schedulers for the following days
+//
+//	out: exit code, 1 when preview fails
+func runPreview(w io.Writer, errOut io.Writer, schedulers schedulersConfigs, from string, days int, format string) int {
+	start, err := parsePreviewFrom(from, time.Now())
+	if err != nil {
+		fmt.Fprintf(errOut, "Error! %v\n", err)
+		return 1
+	} else if days < 1 {
+		fmt.Fprintf(errOut, "Error! Preview days must be positive, got %d\n", days)
+		return 1
+	}
+
+	until := start.In(installationLocation()).AddDate(0, 0, days)
+	if err := writePreview(w, previewSchedules(schedulers, start, until), format); err != nil {
+		fmt.Fprintf(errOut, "Error! %v\n", err)
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/store"
+)
+
+func TestPreviewSchedules(t *testing.T) {
+	scheduler := TemperatureScheduler{
+		Topic:              "preview-trv",
+		DefaultTemperature: 21,
+		TimeTable:          []TimeTable{{Start: 9000, End: 21600, Temperature: 18}, {Start: 43230, End: 46800, Temperature: 22.5}}, // 02:30 - 06:00, 12:00:30 - 13:00
+		TimeZone:           "Europe/Prague",
+	}
+	prague, _ := loadLocation("Europe/Prague")
+
+	// DST starts on 2023-03-26, 02:30 doesn't exist, slot starts at the clock jump
+	from := time.Date(2023, 3, 26, 0, 0, 0, 0, prague)
+	changes := previewSchedules(schedulersConfigs{scheduler}, from, from.AddDate(0, 0, 1))
+	expected := []string{
+		"2023-03-26 00:00:00 CET 21 default",
+		"2023-03-26 03:00:00 CEST 18 02:30-06:00",
+		"2023-03-26 06:00:00 CEST 21 default",
+		"2023-03-26 12:00:30 CEST 22.5 12:00:30-13:00",
+		"2023-03-26 13:00:00 CEST 21 default",
+	}
+	assertPreview(changes, expected)
+
+	// override of the state is previewed until it expires
+	overrideUntil := time.Date(2023, 3, 26, 8, 15, 0, 0, prague)
+	stateStore.Update(func(state *store.State) bool {
+		state.Overrides[scheduler.Topic] = store.Override{Temperature: 24, Until: overrideUntil}
+		return true
+	})
+	defer forgetOverride(scheduler.Topic)
+	changes = previewSchedules(schedulersConfigs{scheduler}, time.Date(2023, 3, 26, 5, 0, 0, 0, prague), time.Date(2023, 3, 26, 12, 0, 0, 0, prague))
+	assertPreview(changes, []string{
+		"2023-03-26 05:00:00 CEST 24 override",
+		"2023-03-26 08:15:00 CEST 21 default",
+	})
+}
+
+func assertPreview(changes []previewChange, expected []string) {
+	result := make([]string, len(changes))
+	for i, change := range changes {
+		result[i] = strings.Join([]string{change.Time.Format("2006-01-02 15:04:05 MST"), formatSetpoint(change.Temperature), change.Source}, " ")
+	}
+	if strings.Join(result, "\n") != strings.Join(expected, "\n") {
+		log.Fatalf("previewSchedules failed, expected:\n%s\ngot:\n%s", strings.Join(expected, "\n"), strings.Join(result, "\n"))
+	}
+}
+
+func TestWritePreview(t *testing.T) {
+	changes := []previewChange{{Time: time.Date(2023, 2, 4, 22, 0, 0, 0, time.UTC), Topic: "trv", Temperature: 18.5, Source: "22:00-06:00"}}
+	expected := map[string]string{
+		previewFormatTable: "TIME                         TOPIC  TEMPERATURE  SOURCE\n2023-02-04 Sat 22:00:00 UTC  trv    18.5         22:00-06:00\n",
+		previewFormatJSON:  "[\n  {\n    \"time\": \"2023-02-04T22:00:00Z\",\n    \"topic\": \"trv\",\n    \"temperature\": 18.5,\n    \"source\": \"22:00-06:00\"\n  }\n]\n",
+		previewFormatCSV:   "time,topic,temperature,source\n2023-02-04T22:00:00Z,trv,18.5,22:00-06:00\n",
+	}
+	for format, output := range expected {
+		var buffer bytes.Buffer
+		if err := writePreview(&buffer, changes, format); err != nil || buffer.String() != output {
+			log.Fatalf("writePreview(%s) = %v, got:\n%s", format, err, buffer.String())
+		}
+	}
+	if err := writePreview(&bytes.Buffer{}, changes, "xml"); err == nil {
+		log.Fatal("writePreview should fail for unknown format")
+	}
+}
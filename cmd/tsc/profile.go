@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/pkg/sensors"
+	"github.com/jacfal.io/homeaut/pkg/status"
+	"github.com/jacfal.io/homeaut/pkg/store"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	// profile of the scheduler's own default temperature and time tables
+	defaultProfile = "default"
+
+	profileTopicSuffix = "/tsc/profile"
+)
+
+// Profile is a named heating profile of the scheduler (eg. away, eco, vacation) replacing its schedule when active
+type Profile struct {
+	DefaultTemperature float64               `json:"defaultTemperature"`
+	TimeTable          []TimeTable           `json:"timeTable,omitempty"`
+	Programs           map[string]DayProgram `json:"programs,omitempty"`
+}
+
+func (p *Profile) Validate() error {
+	return validatePrograms(p.Programs)
+}
+
+// profilesStatus is the retained document of the active profiles
+type profilesStatus struct {
+	Profile string            `json:"profile"`         // global profile
+	Rooms   map[string]string `json:"rooms,omitempty"` // key: TRV topic, profile of the room overriding the global one
+}
+
+// Topic of the global profile command, payload is the profile name
+func profileCommandTopic(serviceTopic string) string {
+	return serviceTopic + "/profile/set"
+}
+
+// Topic of the retained active profiles document
+func profileStatusTopic(serviceTopic string) string {
+	return serviceTopic + "/profile"
+}
+
+// Topic of the room profile command, payload is the profile name, empty payload returns to the global profile
+func roomProfileTopic(topic string) string {
+	return topic + profileTopicSuffix
+}
+
+func normalizeProfile(name string) string {
+	if name == "" {
+		return defaultProfile
+	}
+	return name
+}
+
+// Get global profile, profile switched at runtime wins over --profile
+func getGlobalProfile() string {
+	var profile string
+	stateStore.View(func(state *store.State) {
+		profile = state.Profile
+	})
+	if profile == "" {
+		profile = *activeProfile
+	}
+	return normalizeProfile(profile)
+}
+
+// Get profile active for the scheduler, room profile wins over the global one
+func getActiveProfile(topic string) string {
+	var profile string
+	var exist bool
+	stateStore.View(func(state *store.State) {
+		profile, exist = state.Profiles[topic]
+	})
+	if exist {
+		return normalizeProfile(profile)
+	}
+	return getGlobalProfile()
+}
+
+// Get scheduler with schedule of its active profile, schedulers without the profile keep their own schedule
+func profileScheduler(scheduler TemperatureScheduler) TemperatureScheduler {
+	if len(scheduler.Profiles) == 0 {
+		return scheduler
+	}
+	profile, exist := scheduler.Profiles[getActiveProfile(scheduler.Topic)]
+	if !exist {
+		return scheduler
+	}
+	scheduler.DefaultTemperature = profile.DefaultTemperature
+	scheduler.TimeTable = profile.TimeTable
+	scheduler.Programs = profile.Programs
+	return scheduler
+}
+
+// Check time tables and setpoint limits of the scheduler profiles
+func checkProfiles(scheduler TemperatureScheduler, model sensors.TrvModel) error {
+	var errs config.Errors
+	names := make([]string, 0, len(scheduler.Profiles))
+	for name := range scheduler.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		path := fmt.Sprintf("profiles.%s", name)
+		if name == defaultProfile {
+			errs.Append(config.FieldErr(path, fmt.Errorf("profile %s is the scheduler's own schedule", defaultProfile)))
+			continue
+		}
+		profile := scheduler.Profiles[name]
+		profileScheduler := TemperatureScheduler{Topic: scheduler.Topic, DefaultTemperature: profile.DefaultTemperature, TimeTable: profile.TimeTable, Programs: profile.Programs}
+		errs.Append(config.WithPath(path, checkTimeTableOverlap(profileScheduler)))
+		errs.Append(config.WithPath(path, checkSetpointLimits(profileScheduler, model)))
+	}
+	return errs.Err()
+}
+
+// Check profile is the default profile or defined by any of the schedulers
+func checkProfileName(name string, schedulers schedulersConfigs) error {
+	if normalizeProfile(name) == defaultProfile {
+		return nil
+	}
+	for _, scheduler := range schedulers {
+		if _, exist := scheduler.Profiles[name]; exist {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown profile %q, not defined by any scheduler", name)
+}
+
+// Switch global profile, or profile of the room when topic is set, and publish the resulting temperatures
+//
+//	in: topic - scheduler topic, empty for the global profile; name - profile, empty returns the room to the global profile
+func switchProfile(client MQTT.Client, topic string, name string, now time.Time) error {
+	var affected schedulersConfigs
+	if topic == "" {
+		if err := checkProfileName(name, getSchedulers()); err != nil {
+			return err
+		}
+		log.Printf("Switching profile to %s", normalizeProfile(name))
+		stateStore.Update(func(state *store.State) bool {
+			state.Profile = normalizeProfile(name)
+			return true
+		})
+		affected = getSchedulers()
+	} else {
+		scheduler, exist := getScheduler(topic)
+		if !exist {
+			return fmt.Errorf("unknown scheduler %s", topic)
+		}
+		if _, defined := scheduler.Profiles[name]; name != "" && name != defaultProfile && !defined {
+			return fmt.Errorf("unknown profile %q of scheduler %s", name, topic)
+		}
+		if name == "" {
+			log.Printf("Profile of %s returned to the global profile", topic)
+		} else {
+			log.Printf("Switching profile of %s to %s", topic, name)
+		}
+		stateStore.Update(func(state *store.State) bool {
+			if name == "" {
+				delete(state.Profiles, topic)
+			} else {
+				state.Profiles[topic] = name
+			}
+			return true
+		})
+		affected = schedulersConfigs{scheduler}
+	}
+
+	for _, scheduler := range affected {
+		// the switch is newer than the manual setpoint on the TRV
+		forgetHold(scheduler.Topic)
+		updateScheduler(client, scheduler, now, false)
+	}
+	publishProfiles(client)
+	return nil
+}
+
+// Get active profiles, global and room profiles
+func getProfilesStatus() profilesStatus {
+	profiles := profilesStatus{Profile: getGlobalProfile()}
+	stateStore.View(func(state *store.State) {
+		for topic, profile := range state.Profiles {
+			if profiles.Rooms == nil {
+				profiles.Rooms = map[string]string{}
+			}
+			profiles.Rooms[topic] = profile
+		}
+	})
+	return profiles
+}
+
+// Announce active profiles on the retained profile topic
+func publishProfiles(client MQTT.Client) {
+	topic := profileStatusTopic(*serviceTopic)
+	if err := statusPublisher.Publish(client, topic, getProfilesStatus()); err != nil {
+		log.Printf("Error publishing profiles to topic %s: %v", topic, err)
+	}
+}
+
+// Parse profile command, payload is the profile name or {"profile": "away"}
+func parseProfileCommand(payload []byte) (string, error) {
+	trimmed := strings.TrimSpace(string(payload))
+	if !strings.HasPrefix(trimmed, "{") {
+		return strings.Trim(trimmed, `"`), nil
+	}
+	var command struct {
+		Profile string `json:"profile"`
+	}
+	decoder := json.NewDecoder(strings.NewReader(trimmed))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&command); err != nil {
+		return "", fmt.Errorf("invalid profile command: %w", err)
+	}
+	return command.Profile, nil
+}
+
+func onProfileMessageReceived(client MQTT.Client, msg MQTT.Message) {
+	topic := ""
+	if strings.HasSuffix(msg.Topic(), profileTopicSuffix) {
+		topic = strings.TrimSuffix(msg.Topic(), profileTopicSuffix)
+	}
+	name, err := parseProfileCommand(msg.Payload())
+	if err == nil {
+		err = switchProfile(client, topic, name, time.Now())
+	}
+	if err != nil {
+		log.Printf("Error! Profile switch rejected: %v", err)
+	}
+}
+
+// Subscribe global profile command topic
+func subscribeProfileCommand(client MQTT.Client) {
+	topic := profileCommandTopic(*serviceTopic)
+	if token := client.Subscribe(topic, status.QOS, onProfileMessageReceived); token.Wait() && token.Error() != nil {
+		log.Printf("Error! Topic %s subscription failed: %s", topic, token.Error())
+	} else {
+		log.Printf("Topic %s subscribed", topic)
+	}
+}
+
+// Forget room profile of the removed scheduler
+func forgetRoomProfile(topic string) {
+	stateStore.Update(func(state *store.State) bool {
+		delete(state.Profiles, topic)
+		return true
+	})
+}
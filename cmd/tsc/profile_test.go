@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/pkg/mqtttest"
+	"github.com/jacfal.io/homeaut/pkg/store"
+)
+
+func TestSwitchProfile(t *testing.T) {
+	livingroom := TemperatureScheduler{
+		Topic:              "profile-livingroom",
+		DefaultTemperature: 21,
+		TimeTable:          []TimeTable{{Start: 79200, End: 21600, Temperature: 18}},
+		Profiles: map[string]Profile{
+			"away": {DefaultTemperature: 16},
+			"eco":  {DefaultTemperature: 19, TimeTable: []TimeTable{{Start: 75600, End: 21600, Temperature: 17}}},
+		},
+	}
+	bathroom := TemperatureScheduler{Topic: "profile-bathroom", DefaultTemperature: 23, Profiles: map[string]Profile{"away": {DefaultTemperature: 15}}}
+	mu.Lock()
+	previousSchedulers := temperatureSchedulers
+	temperatureSchedulers = schedulersConfigs{livingroom, bathroom}
+	lastTemperatures[livingroom.Topic], lastTemperatures[bathroom.Topic] = 21, 23
+	mu.Unlock()
+	defer func() {
+		mu.Lock()
+		temperatureSchedulers = previousSchedulers
+		delete(lastTemperatures, livingroom.Topic)
+		delete(lastTemperatures, bathroom.Topic)
+		mu.Unlock()
+		stateStore.Update(func(state *store.State) bool {
+			state.Profile = ""
+			delete(state.Profiles, livingroom.Topic)
+			return true
+		})
+	}()
+
+	client := mqtttest.NewClient()
+	now := time.Date(2023, 2, 4, 12, 0, 0, 0, time.Local)
+	if err := switchProfile(client, "", "away", now); err != nil {
+		log.Fatalf("switchProfile() failed: %v", err)
+	}
+	if published := client.PublishedTo(heatingSetpointTopic(livingroom.Topic)); len(published) != 1 || published[0] != "16" {
+		log.Fatalf("away profile of the livingroom should be published: %v", published)
+	}
+	if published := client.PublishedTo(heatingSetpointTopic(bathroom.Topic)); len(published) != 1 || published[0] != "15" {
+		log.Fatalf("away profile of the bathroom should be published: %v", published)
+	}
+	if published := client.PublishedTo("go-home/tsc/profile"); len(published) != 1 || published[0] != `{"profile":"away"}` {
+		log.Fatalf("active profile should be announced: %v", published)
+	}
+
+	// room profile wins over the global profile
+	client.Reset()
+	subscribeSchedulers(client, schedulersConfigs{livingroom})
+	client.Deliver("profile-livingroom/tsc/profile", "eco")
+	if temperature := getTemperatureAtTime(livingroom, now.Add(9*time.Hour)); temperature != 17 {
+		log.Fatalf("eco profile time table should be active in the livingroom, got %v", temperature)
+	}
+	if status := getSchedulerStatus(livingroom, now); status.Profile != "eco" || status.Temperature != 19 {
+		log.Fatalf("status should show the room profile: %+v", status)
+	}
+	if published := client.PublishedTo("go-home/tsc/profile"); len(published) != 1 || published[0] != `{"profile":"away","rooms":{"profile-livingroom":"eco"}}` {
+		log.Fatalf("room profile should be announced: %v", published)
+	}
+
+	// unknown profiles are rejected, empty room profile returns to the global profile
+	if err := switchProfile(client, "", "party", now); err == nil {
+		log.Fatal("unknown profile should be rejected")
+	}
+	if err := switchProfile(client, bathroom.Topic, "eco", now); err == nil {
+		log.Fatal("profile not defined by the scheduler should be rejected")
+	}
+	if err := switchProfile(client, livingroom.Topic, "", now); err != nil || getActiveProfile(livingroom.Topic) != "away" {
+		log.Fatalf("room should return to the global profile: %v", err)
+	}
+	if err := switchProfile(client, "", defaultProfile, now); err != nil || getTemperatureAtTime(livingroom, now) != 21 {
+		log.Fatalf("default profile should return to the scheduler's own schedule: %v", err)
+	}
+
+	// HTTP API
+	api := &profileAPI{client: client}
+	request := func(method string, path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodPut, "/api/profile", `{"profile": "away"}`, http.StatusOK},
+		{http.MethodPut, "/api/profile", `{"profile": "party"}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/profile", `{}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/profile/profile-livingroom", `{"profile": "eco"}`, http.StatusOK},
+		{http.MethodPut, "/api/profile/unknown-room", `{"profile": "eco"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/profile", `{"profile": "away"}`, http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if got := request(tt.method, tt.path, tt.body); got.Code != tt.status {
+			log.Fatalf("%s %s = %d, want %d (%s)", tt.method, tt.path, got.Code, tt.status, got.Body.String())
+		}
+	}
+	var profiles profilesStatus
+	if err := json.Unmarshal(request(http.MethodDelete, "/api/profile/profile-livingroom", "").Body.Bytes(), &profiles); err != nil {
+		log.Fatal(err)
+	}
+	if profiles.Profile != "away" || len(profiles.Rooms) != 0 {
+		log.Fatalf("DELETE should return the room to the global profile: %+v", profiles)
+	}
+}
+
+func TestProfileValidation(t *testing.T) {
+	var cfg Config
+	err := config.DecodeYAML([]byte("tsc:\n  schedulers:\n    - topic: trv\n      defaultTemperature: 20\n      timeTable: []\n      profiles:\n        away:\n          defaultTemperature: 2\n        eco:\n          defaultTemperature: 18\n          timeTable:\n            - {start: \"22:00\", end: \"06:00\", temperature: 17}\n            - {start: \"05:00\", end: \"07:00\", temperature: 17}\n"), &cfg)
+	if err == nil || !strings.Contains(err.Error(), "tsc.schedulers[0].profiles.away.defaultTemperature") || !strings.Contains(err.Error(), "tsc.schedulers[0].profiles.eco.timeTable[0]: 22:00-06:00 overlaps") {
+		log.Fatalf("invalid profiles should be reported, got: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/utils"
+)
+
+// Ramp reaches temperature of the time table gradually from the slot start, eg. 22°C in 0.5°C steps within
+// 45 minutes, so the TRV doesn't open fully and overshoot
+type Ramp struct {
+	Duration utils.Duration `json:"duration"` // the temperature is reached by the end of the ramp
+	Step     float64        `json:"step"`     // °C
+}
+
+func (r *Ramp) Validate() error {
+	var errs config.Errors
+	if r.Duration <= 0 {
+		errs.Append(config.FieldErr("duration", errors.New("must be positive")))
+	}
+	if r.Step <= 0 {
+		errs.Append(config.FieldErr("step", errors.New("must be positive")))
+	}
+	return errs.Err()
+}
+
+func (r Ramp) String() string {
+	return fmt.Sprintf("%s in %s°C steps", r.Duration, formatSetpoint(r.Step))
+}
+
+// Check ramp of the time table ends within the slot, solar slots change every day and aren't checked
+func checkRamp(timeTable TimeTable) error {
+	if timeTable.Ramp == nil || timeTable.solar() {
+		return nil
+	}
+	start, end := timeTableSpan(timeTable)
+	if timeTable.Ramp.Duration.Duration() > time.Duration(end-start)*time.Second {
+		return fmt.Errorf("duration %s is longer than the slot %s", timeTable.Ramp.Duration, formatSlot(timeTable))
+	}
+	return nil
+}
+
+// Get time elapsed since start of the active time table
+//
+//	in: time - time in the scheduler time zone
+func rampElapsed(timeTable TimeTable, time time.Time) int64 {
+	elapsed := getSecondsOfDay(time) - timeTable.Start
+	if elapsed < 0 {
+		// interval started yesterday
+		elapsed += secondsPerDay
+	}
+	return elapsed
+}
+
+// Get temperature of the ramping time table at given time, the ramp starts at the temperature scheduled before the
+// slot and steps toward the temperature of the slot, the first step at the slot start, evenly until the ramp ends
+//
+//	in: timeTable - active time table; time - time in the scheduler time zone
+func rampTemperature(scheduler TemperatureScheduler, timeTable TimeTable, time time.Time) float64 {
+	elapsed := rampElapsed(timeTable, time)
+	duration := timeTable.Ramp.Duration.Duration().Seconds()
+	if float64(elapsed) >= duration {
+		return timeTable.Temperature
+	}
+	from := getSlotTemperature(scheduler, time.Add(-secondsDuration(elapsed+1)))
+	difference := timeTable.Temperature - from
+	steps := math.Ceil(math.Abs(difference) / timeTable.Ramp.Step)
+	if steps <= 1 {
+		return timeTable.Temperature
+	}
+	step := math.Floor(float64(elapsed)/duration*steps) + 1
+	return from + math.Copysign(math.Min(step*timeTable.Ramp.Step, math.Abs(difference)), difference)
+}
+
+// Get ramp in progress at given time
+//
+//	out: temperature the ramp reaches and end of the ramp; bool - false if no ramp is in progress
+func getActiveRamp(scheduler TemperatureScheduler, now time.Time) (override, bool) {
+	timeTable, active, _ := resolveSchedule(scheduler, now)
+	if !active || timeTable.Ramp == nil {
+		return override{}, false
+	}
+	now = now.Truncate(time.Second)
+	end := now.Add(timeTable.Ramp.Duration.Duration() - secondsDuration(rampElapsed(timeTable, scheduleTime(scheduler, now))))
+	if !now.Before(end) || getTemperatureAtTime(scheduler, now) == timeTable.Temperature {
+		return override{}, false
+	}
+	return override{Temperature: timeTable.Temperature, Until: end}, true
+}
+
+func secondsDuration(seconds int64) time.Duration {
+	return time.Duration(seconds) * time.Second
+}
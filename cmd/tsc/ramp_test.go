@@ -0,0 +1,122 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/utils"
+)
+
+func TestParseRamp(t *testing.T) {
+	scheduler, err := parseTimeTable(`{"topic": "trv", "defaultTemperature": 18, "timeTable": [
+		{"start": "06:00", "end": "08:00", "temperature": 22, "ramp": {"duration": "45m", "step": 0.5}}
+	]}`)
+	if err != nil {
+		log.Fatalf("parseTimeTable failed: %v", err)
+	}
+	if ramp := scheduler.TimeTable[0].Ramp; ramp == nil || ramp.Duration != utils.Duration(45*time.Minute) || ramp.Step != 0.5 {
+		log.Fatalf("unexpected ramp: %+v", ramp)
+	}
+
+	for value, expected := range map[string]string{
+		`{"duration": "45m"}`:                `timeTable[0].ramp.step: must be positive`,
+		`{"duration": 0, "step": 0.5}`:       `timeTable[0].ramp.duration: must be positive`,
+		`{"duration": "3h", "step": 0.5}`:    `timeTable[0].ramp: duration 3h0m0s is longer than the slot 06:00-08:00`,
+		`{"duration": "45m", "steps": 0.5}`:  `timeTable[0].ramp.steps: unknown field`,
+		`{"duration": "45m", "step": "0.5"}`: `timeTable[0].ramp.step:`,
+	} {
+		_, err := parseTimeTable(`{"topic": "trv", "timeTable": [{"start": "06:00", "end": "08:00", "temperature": 22, "ramp": ` + value + `}]}`)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			log.Fatalf("expected error %q for ramp %s, got: %v", expected, value, err)
+		}
+	}
+}
+
+func TestRampTemperature(t *testing.T) {
+	scheduler := TemperatureScheduler{
+		Topic:              "ramp-trv",
+		DefaultTemperature: 18,
+		TimeZone:           "Europe/Prague",
+		TimeTable: []TimeTable{
+			{Start: 21600, End: 28800, Temperature: 22, Ramp: &Ramp{Duration: utils.Duration(45 * time.Minute), Step: 0.5}},
+			{Start: 28800, End: 36000, Temperature: 20.5, Ramp: &Ramp{Duration: utils.Duration(time.Hour), Step: 1}},
+		},
+	}
+	prague, _ := loadLocation("Europe/Prague")
+	day := time.Date(2023, 2, 4, 0, 0, 0, 0, prague)
+
+	// 8 steps of 0.5°C every 5m37.5s from 18°C, 2 steps of 1°C every 30 minutes from 22°C
+	tests := []struct {
+		time        time.Duration
+		temperature float64
+	}{
+		{6*time.Hour - time.Second, 18},
+		{6 * time.Hour, 18.5},
+		{6*time.Hour + 5*time.Minute + 37*time.Second, 18.5},
+		{6*time.Hour + 5*time.Minute + 38*time.Second, 19},
+		{6*time.Hour + 40*time.Minute, 22},
+		{7 * time.Hour, 22},
+		{8 * time.Hour, 21},
+		{8*time.Hour + 30*time.Minute, 20.5},
+		{10 * time.Hour, 18},
+	}
+	for _, tt := range tests {
+		if temperature := getTemperatureAtTime(scheduler, day.Add(tt.time)); temperature != tt.temperature {
+			log.Fatalf("getTemperatureAtTime(%v) = %v, want %v", day.Add(tt.time), temperature, tt.temperature)
+		}
+	}
+
+	status := getSchedulerStatus(scheduler, day.Add(6*time.Hour+10*time.Minute))
+	if status.Temperature != 19 || status.Slot != "06:00-08:00" || status.Ramp == nil || status.Ramp.Temperature != 22 ||
+		!status.Ramp.Until.Equal(day.Add(6*time.Hour+45*time.Minute)) {
+		log.Fatalf("status should show the ramp: %+v", status)
+	}
+	if status := getSchedulerStatus(scheduler, day.Add(6*time.Hour+40*time.Minute)); status.Ramp != nil {
+		log.Fatalf("reached ramp shouldn't be shown: %+v", status.Ramp)
+	}
+
+	// every step is published
+	changes := previewSchedules(schedulersConfigs{scheduler}, day.Add(8*time.Hour-time.Minute), day.Add(9*time.Hour))
+	assertPreview(changes, []string{
+		"2023-02-04 07:59:00 CET 22 06:00-08:00",
+		"2023-02-04 08:00:00 CET 21 08:00-10:00",
+		"2023-02-04 08:30:00 CET 20.5 08:00-10:00",
+	})
+
+	// steps of the ramp don't end the manual hold
+	if end := getHoldEnd(scheduler, day.Add(6*time.Hour+10*time.Minute)); !end.Equal(day.Add(8 * time.Hour)) {
+		log.Fatalf("hold should end at the next slot, got %v", end)
+	}
+}
+
+func TestRampUpdates(t *testing.T) {
+	scheduler := TemperatureScheduler{
+		Topic:              "ramp-update-trv",
+		DefaultTemperature: 18,
+		TimeTable:          []TimeTable{{Start: 21600, End: 28800, Temperature: 20, Ramp: &Ramp{Duration: utils.Duration(30 * time.Minute), Step: 1}}},
+	}
+	defer func() {
+		mu.Lock()
+		delete(lastTemperatures, scheduler.Topic)
+		mu.Unlock()
+	}()
+	day := time.Date(2023, 2, 4, 0, 0, 0, 0, time.Local)
+
+	temperatureUpdateNeeded(scheduler, day.Add(5*time.Hour))
+	for _, tt := range []struct {
+		time        time.Duration
+		update      bool
+		temperature float64
+	}{
+		{6 * time.Hour, true, 19},
+		{6*time.Hour + 10*time.Minute, false, 0},
+		{6*time.Hour + 15*time.Minute, true, 20},
+		{6*time.Hour + 30*time.Minute, false, 0},
+	} {
+		if update, temperature := temperatureUpdateNeeded(scheduler, day.Add(tt.time)); update != tt.update || temperature != tt.temperature {
+			log.Fatalf("temperatureUpdateNeeded(%v) = %v, %v, want %v, %v", tt.time, update, temperature, tt.update, tt.temperature)
+		}
+	}
+}
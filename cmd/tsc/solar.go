@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/pkg/solar"
+)
+
+const (
+	sunriseEvent = "sunrise"
+	sunsetEvent  = "sunset"
+
+	// days solar entries are checked for overlaps, sunrise and sunset repeat yearly
+	solarCheckDays = 366
+)
+
+// SolarTime is a time of day relative to sunrise or sunset, eg. sunrise-00:30 or sunset+01:00
+type SolarTime struct {
+	Event  string // sunrise or sunset
+	Offset int64  // seconds, negative before the event
+}
+
+type sunTimes struct {
+	sunrise time.Time
+	sunset  time.Time
+	ok      bool // false on polar day or night
+}
+
+// coordinates of the installation, degrees
+type coordinates struct {
+	latitude  float64 // north positive
+	longitude float64 // east positive
+}
+
+type sunKey struct {
+	date string
+	coordinates
+}
+
+var (
+	sunCache   = map[sunKey]sunTimes{}
+	sunCacheMu sync.Mutex
+)
+
+// Parse solar time, eg. sunrise, sunrise-00:30 or sunset+01:15:30
+//
+//	out: solar time; bool - false if the value isn't a solar time (eg. 22:00); error
+func parseSolarTime(value string) (*SolarTime, bool, error) {
+	var event string
+	for _, current := range []string{sunriseEvent, sunsetEvent} {
+		if strings.HasPrefix(value, current) {
+			event = current
+		}
+	}
+	if event == "" {
+		return nil, false, nil
+	}
+
+	offset := strings.TrimPrefix(value, event)
+	if offset == "" {
+		return &SolarTime{Event: event}, true, nil
+	}
+	sign := int64(1)
+	switch offset[0] {
+	case '-':
+		sign = -1
+	case '+':
+	default:
+		return nil, true, fmt.Errorf("invalid solar time %q, expected eg. sunrise-00:30 or sunset+01:00", value)
+	}
+	seconds, err := parseTimeOfDay(offset[1:])
+	if err != nil || seconds >= secondsPerDay {
+		return nil, true, fmt.Errorf("invalid offset of solar time %q, expected HH:MM or HH:MM:SS", value)
+	}
+	return &SolarTime{Event: event, Offset: sign * seconds}, true, nil
+}
+
+func (s SolarTime) String() string {
+	switch {
+	case s.Offset < 0:
+		return fmt.Sprintf("%s-%s", s.Event, formatSecondsFromMidnight(-s.Offset))
+	case s.Offset > 0:
+		return fmt.Sprintf("%s+%s", s.Event, formatSecondsFromMidnight(s.Offset))
+	}
+	return s.Event
+}
+
+// Check if start or end of the time table is a solar time
+func (t TimeTable) solar() bool {
+	return t.SolarStart != nil || t.SolarEnd != nil
+}
+
+// Parse latitude and longitude of the installation
+//
+//	out: coordinates; bool - false if the coordinates aren't set; error
+func parseCoordinates(latitudeValue string, longitudeValue string) (coordinates, bool, error) {
+	if latitudeValue == "" && longitudeValue == "" {
+		return coordinates{}, false, nil
+	}
+	var errs config.Errors
+	latitude, err := strconv.ParseFloat(latitudeValue, 64)
+	if err != nil || latitude < -90 || latitude > 90 {
+		errs.Append(config.FieldErr("latitude", fmt.Errorf("invalid latitude %q, expected degrees -90 to 90", latitudeValue)))
+	}
+	longitude, err := strconv.ParseFloat(longitudeValue, 64)
+	if err != nil || longitude < -180 || longitude > 180 {
+		errs.Append(config.FieldErr("longitude", fmt.Errorf("invalid longitude %q, expected degrees -180 to 180", longitudeValue)))
+	}
+	if err := errs.Err(); err != nil {
+		return coordinates{}, false, err
+	}
+	return coordinates{latitude: latitude, longitude: longitude}, true, nil
+}
+
+// Get coordinates of the installation (--latitude, --longitude)
+//
+//	out: coordinates; bool - false if the coordinates aren't set
+func installationCoordinates() (coordinates, bool) {
+	installation, configured, err := parseCoordinates(*latitudeArg, *longitudeArg)
+	if err != nil {
+		// validated at (re)load
+		return coordinates{}, false
+	}
+	return installation, configured
+}
+
+// Get sunrise and sunset of the day at the coordinates
+//
+//	out: sunrise; sunset; bool - false if the sun doesn't rise or set that day
+func getSunTimes(location coordinates, day time.Time) (time.Time, time.Time, bool) {
+	key := sunKey{date: day.Format(dateLayout), coordinates: location}
+	sunCacheMu.Lock()
+	defer sunCacheMu.Unlock()
+	times, exist := sunCache[key]
+	if !exist {
+		year, month, date := day.Date()
+		times.sunrise, times.sunset, times.ok = solar.Sun(year, month, date, location.latitude, location.longitude)
+		sunCache[key] = times
+	}
+	return times.sunrise, times.sunset, times.ok
+}
+
+// Get seconds from midnight of the solar time on the day, in time zone of the day, rounded to minutes
+func (s SolarTime) resolve(location coordinates, day time.Time) (int64, bool) {
+	sunrise, sunset, ok := getSunTimes(location, day)
+	if !ok {
+		return 0, false
+	}
+	event := sunrise
+	if s.Event == sunsetEvent {
+		event = sunset
+	}
+	return getSecondsOfDay(event.Add(time.Duration(s.Offset) * time.Second).Round(time.Minute).In(day.Location())), true
+}
+
+// Get time table with solar times resolved for the day at the installation coordinates,
+// eg. sunrise-00:30-08:00 --> 06:42-08:00
+//
+//	out: resolved time table; bool - false if the coordinates aren't set or the sun doesn't rise or set that day
+func resolveSolarTimeTable(timeTable TimeTable, day time.Time) (TimeTable, bool) {
+	location, configured := installationCoordinates()
+	if !configured {
+		return TimeTable{}, false
+	}
+	return resolveSolarTimeTableAt(timeTable, location, day)
+}
+
+// Get time table with solar times resolved for the day at the coordinates
+func resolveSolarTimeTableAt(timeTable TimeTable, location coordinates, day time.Time) (TimeTable, bool) {
+	for _, current := range []struct {
+		solar   *SolarTime
+		seconds *int64
+	}{{timeTable.SolarStart, &timeTable.Start}, {timeTable.SolarEnd, &timeTable.End}} {
+		if current.solar == nil {
+			continue
+		}
+		seconds, ok := current.solar.resolve(location, day)
+		if !ok {
+			return TimeTable{}, false
+		}
+		*current.seconds = seconds
+	}
+	timeTable.SolarStart, timeTable.SolarEnd = nil, nil
+	return timeTable, true
+}
+
+// Check solar times of the schedulers, coordinates must be set and entries must not overlap on any day of the next
+// year
+func checkSolarSchedules(schedulers schedulersConfigs, latitude string, longitude string, now time.Time) error {
+	var errs config.Errors
+	installation, configured, err := parseCoordinates(latitude, longitude)
+	errs.Append(err)
+	for _, scheduler := range schedulers {
+		timeTables := map[string]TemperatureScheduler{"": scheduler}
+		for name, profile := range scheduler.Profiles {
+			timeTables[fmt.Sprintf("profiles.%s", name)] = TemperatureScheduler{TimeTable: profile.TimeTable, Programs: profile.Programs}
+		}
+		paths := make([]string, 0, len(timeTables))
+		for path := range timeTables {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			entries := getScheduleEntries(timeTables[path])
+			solarEntries := false
+			for _, entry := range entries {
+				solarEntries = solarEntries || entry.solar()
+			}
+			switch {
+			case !solarEntries:
+			case err != nil:
+				// coordinates reported above
+			case !configured:
+				errs.Append(config.FieldErr(scheduler.Topic, errors.New("latitude and longitude must be set for sunrise and sunset times")))
+			default:
+				location := installationLocation()
+				if schedulerLocation, exist := schedulerLocation(scheduler); exist {
+					location = schedulerLocation
+				}
+				errs.Append(config.WithPath(scheduler.Topic, config.WithPath(path, checkSolarOverlaps(entries, installation, now.In(location)))))
+			}
+		}
+	}
+	return errs.Err()
+}
+
+// Check entries with solar times don't overlap other entries, times of each day are resolved
+//
+//	in: from - first checked day
+//	out: config.Errors naming both entries, the first day of the overlap and their times that day,
+//	     eg. timeTable[0]: sunset-22:00 overlaps timeTable[1] 18:00-19:00 on 2023-09-23 (18:59-22:00 and 18:00-19:00)
+func checkSolarOverlaps(entries []scheduleEntry, location coordinates, from time.Time) error {
+	// interval of the entry started days after the first day, in seconds from midnight of the first day
+	interval := func(entry scheduleEntry, first time.Time, days int) (TimeTable, int64, int64, bool) {
+		day := first.AddDate(0, 0, days)
+		if !entry.Days.Contains(day.Weekday()) {
+			return TimeTable{}, 0, 0, false
+		}
+		resolved, ok := resolveSolarTimeTableAt(entry.TimeTable, location, day)
+		if !ok {
+			return TimeTable{}, 0, 0, false
+		}
+		start, end := timeTableSpan(resolved)
+		return resolved, start + int64(days)*secondsPerDay, end + int64(days)*secondsPerDay, true
+	}
+
+	var errs config.Errors
+	first := time.Date(from.Year(), from.Month(), from.Day(), 12, 0, 0, 0, from.Location())
+	for i, entry := range entries {
+		for _, other := range entries[i+1:] {
+			if !entry.solar() && !other.solar() {
+				// checked for every week by checkTimeTableOverlap
+				continue
+			}
+		days:
+			for days := 0; days < solarCheckDays; days++ {
+				day := first.AddDate(0, 0, days)
+				// intervals last a day at most, intervals of the day overlap intervals started the same or the next day
+				for _, pair := range [][2]int{{0, 0}, {0, 1}, {1, 0}} {
+					resolved, start1, end1, ok1 := interval(entry, day, pair[0])
+					resolvedOther, start2, end2, ok2 := interval(other, day, pair[1])
+					if ok1 && ok2 && start1 < end2 && start2 < end1 {
+						errs.Append(config.FieldErr(entry.Path, fmt.Errorf("%s overlaps %s %s on %s (%s and %s)", formatSlot(entry.TimeTable),
+							other.Path, formatSlot(other.TimeTable), day.Format(dateLayout), formatSlot(resolved), formatSlot(resolvedOther))))
+						break days
+					}
+				}
+			}
+		}
+	}
+	return errs.Err()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+// set coordinates of Prague for the test
+func setPragueCoordinates() func() {
+	*latitudeArg, *longitudeArg = "50.0755", "14.4378"
+	return func() {
+		*latitudeArg, *longitudeArg = "", ""
+	}
+}
+
+func TestParseSolarTimeTable(t *testing.T) {
+	scheduler, err := parseTimeTable(`{"topic": "trv", "defaultTemperature": 20, "timeTable": [
+		{"start": "sunrise-00:30", "end": "08:00", "temperature": 22},
+		{"start": "sunset", "end": "sunset+01:15:30", "temperature": 23}
+	]}`)
+	if err != nil {
+		log.Fatalf("parseTimeTable failed: %v", err)
+	}
+	if solarStart := scheduler.TimeTable[0].SolarStart; solarStart == nil || *solarStart != (SolarTime{Event: sunriseEvent, Offset: -1800}) || scheduler.TimeTable[0].End != 28800 {
+		log.Fatalf("unexpected solar start: %+v", scheduler.TimeTable[0])
+	}
+	if slot := formatSlot(scheduler.TimeTable[1]); slot != "sunset-sunset+01:15:30" {
+		log.Fatalf("unexpected slot of solar times: %s", slot)
+	}
+
+	for value, expected := range map[string]string{
+		"sunrise-1h":    `invalid offset of solar time "sunrise-1h"`,
+		"sunset*2":      `invalid solar time "sunset*2"`,
+		"sunrise+24:00": `invalid offset of solar time "sunrise+24:00"`,
+	} {
+		_, err := parseTimeTable(`{"topic": "trv", "timeTable": [{"start": "` + value + `", "end": "08:00", "temperature": 22}]}`)
+		if err == nil || !strings.Contains(err.Error(), "timeTable[0].start: "+expected) {
+			log.Fatalf("expected error %q, got: %v", expected, err)
+		}
+	}
+}
+
+func TestSolarSchedule(t *testing.T) {
+	defer setPragueCoordinates()()
+	scheduler := TemperatureScheduler{
+		Topic:              "solar-trv",
+		DefaultTemperature: 20,
+		TimeZone:           "Europe/Prague",
+		TimeTable: []TimeTable{
+			{Start: 0, End: 28800, Temperature: 22, SolarStart: &SolarTime{Event: sunriseEvent, Offset: -1800}},
+			{Start: 0, End: 79200, Temperature: 18, SolarStart: &SolarTime{Event: sunsetEvent}},
+		},
+	}
+	prague, _ := loadLocation("Europe/Prague")
+
+	// sunrise is at 07:58 in December and at 04:52 in June, sunset at 16:02 and 21:15
+	tests := []struct {
+		time        time.Time
+		temperature float64
+	}{
+		{time.Date(2023, 12, 21, 7, 27, 0, 0, prague), 20},
+		{time.Date(2023, 12, 21, 7, 28, 0, 0, prague), 22},
+		{time.Date(2023, 12, 21, 16, 2, 0, 0, prague), 18},
+		{time.Date(2023, 6, 21, 4, 22, 0, 0, prague), 22},
+		{time.Date(2023, 6, 21, 21, 0, 0, 0, prague), 20},
+	}
+	for _, tt := range tests {
+		if temperature := getTemperatureAtTime(scheduler, tt.time); temperature != tt.temperature {
+			log.Fatalf("getTemperatureAtTime(%v) = %v, want %v", tt.time, temperature, tt.temperature)
+		}
+	}
+	if status := getSchedulerStatus(scheduler, time.Date(2023, 12, 21, 7, 30, 0, 0, prague)); status.Slot != "07:28-08:00" {
+		log.Fatalf("status should show resolved slot, got %s", status.Slot)
+	}
+
+	// every day shows its own times
+	changes := previewSchedules(schedulersConfigs{scheduler}, time.Date(2023, 12, 21, 12, 0, 0, 0, prague), time.Date(2023, 12, 22, 12, 0, 0, 0, prague))
+	assertPreview(changes, []string{
+		"2023-12-21 12:00:00 CET 20 default",
+		"2023-12-21 16:02:00 CET 18 16:02-22:00",
+		"2023-12-21 22:00:00 CET 20 default",
+		"2023-12-22 07:29:00 CET 22 07:29-08:00",
+		"2023-12-22 08:00:00 CET 20 default",
+	})
+}
+
+func TestCheckSolarSchedules(t *testing.T) {
+	scheduler := TemperatureScheduler{
+		Topic: "solar-trv",
+		TimeTable: []TimeTable{
+			{Start: 0, End: 79200, Temperature: 18, SolarStart: &SolarTime{Event: sunsetEvent}},
+			{Start: 64800, End: 68400, Temperature: 22}, // 18:00 - 19:00
+		},
+		TimeZone: "Europe/Prague",
+	}
+	from := time.Date(2023, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	err := checkSolarSchedules(schedulersConfigs{scheduler}, "", "", from)
+	if err == nil || !strings.Contains(err.Error(), "solar-trv: latitude and longitude must be set for sunrise and sunset times") {
+		log.Fatalf("missing coordinates should be reported, got: %v", err)
+	}
+	err = checkSolarSchedules(schedulersConfigs{scheduler}, "95", "x", from)
+	if err == nil || !strings.Contains(err.Error(), `latitude: invalid latitude "95"`) || !strings.Contains(err.Error(), `longitude: invalid longitude "x"`) {
+		log.Fatalf("invalid coordinates should be reported, got: %v", err)
+	}
+
+	// sunset comes before 19:00 in autumn
+	err = checkSolarSchedules(schedulersConfigs{scheduler}, "50.0755", "14.4378", from)
+	if err == nil || !strings.Contains(err.Error(), "solar-trv.timeTable[0]: sunset-22:00 overlaps timeTable[1] 18:00-19:00 on 2023-09-23 (18:59-22:00 and 18:00-19:00)") {
+		log.Fatalf("overlap of solar entries should be reported, got: %v", err)
+	}
+	scheduler.TimeTable[1].Start, scheduler.TimeTable[1].End = 50400, 54000 // 14:00 - 15:00
+	if err := checkSolarSchedules(schedulersConfigs{scheduler}, "50.0755", "14.4378", from); err != nil {
+		log.Fatalf("entries don't overlap, got: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/store"
+)
+
+// Restore last published temperatures, so slot changes during downtime are published right after start
+func restoreState() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	stateStore.View(func(state *store.State) {
+		for topic, setpoint := range state.Setpoints {
+			log.Printf("Restoring temperature state for topic %s, value: %.1f (%s)", topic, setpoint.Temperature, setpoint.Time.Format(time.RFC3339))
+			lastTemperatures[topic] = setpoint.Temperature
+		}
+	})
+}
+
+// Persist temperature published to the TRV
+func recordSetpoint(topic string, temperature float64, now time.Time) {
+	stateStore.Update(func(state *store.State) bool {
+		state.Setpoints[topic] = store.Setpoint{Temperature: temperature, Time: now}
+		return true
+	})
+}
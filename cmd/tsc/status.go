@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/store"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+const defaultSlot = "default"
+
+// schedulerStatus is the retained status document of the scheduler
+type schedulerStatus struct {
+	Topic                string      `json:"topic"`
+	Temperature          float64     `json:"temperature"`         // scheduled temperature
+	Slot                 string      `json:"slot"`                // active time table slot, eg. 22:00-06:00
+	Profile              string      `json:"profile"`             // active heating profile
+	Exception            string      `json:"exception,omitempty"` // exception replacing the weekly schedule today
+	Calendar             string      `json:"calendar,omitempty"`  // summary of the active calendar event
+	PublishedTemperature *float64    `json:"publishedTemperature,omitempty"`
+	LastPublished        *time.Time  `json:"lastPublished,omitempty"`
+	Override             *override   `json:"override,omitempty"`            // active override, wins over the schedule
+	ManualHold           *override   `json:"manualHold,omitempty"`          // manual setpoint of the TRV kept by the schedule
+	Preheat              *override   `json:"preheat,omitempty"`             // setpoint of the next slot started ahead by optimum start
+	Ramp                 *override   `json:"ramp,omitempty"`                // temperature the slot ramps to and end of the ramp
+	HeatingRate          *float64    `json:"heatingRate,omitempty"`         // learned heating rate of the room, °C per hour
+	ReportedTemperature  *float64    `json:"reportedTemperature,omitempty"` // setpoint reported by the TRV
+	Confirmed            *bool       `json:"confirmed,omitempty"`           // TRV reports the published setpoint
+	Trvs                 []trvStatus `json:"trvs,omitempty"`                // setpoints reported by the zone members
+}
+
+type override struct {
+	Temperature float64   `json:"temperature"`
+	Until       time.Time `json:"until"`
+}
+
+func schedulerStatusTopic(topic string) string {
+	return topic + "/tsc/status"
+}
+
+// Format time table slot, eg. 22:00-06:00 or sunset-06:00 for solar times not resolved
+func formatSlot(timeTable TimeTable) string {
+	start, end := formatSecondsFromMidnight(timeTable.Start), formatSecondsFromMidnight(timeTable.End)
+	if timeTable.SolarStart != nil {
+		start = timeTable.SolarStart.String()
+	}
+	if timeTable.SolarEnd != nil {
+		end = timeTable.SolarEnd.String()
+	}
+	return fmt.Sprintf("%s-%s", start, end)
+}
+
+func formatSecondsFromMidnight(seconds int64) string {
+	if seconds%60 != 0 {
+		return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds%3600/60, seconds%60)
+	}
+	return fmt.Sprintf("%02d:%02d", seconds/3600, seconds%3600/60)
+}
+
+// Get status of the scheduler at given time
+func getSchedulerStatus(scheduler TemperatureScheduler, now time.Time) schedulerStatus {
+	schedulerStatus := schedulerStatus{
+		Topic:       scheduler.Topic,
+		Temperature: getTemperatureAtTime(scheduler, now),
+		Slot:        defaultSlot,
+		Profile:     getActiveProfile(scheduler.Topic),
+	}
+	if timeTable, active := getTimeTableAtTime(scheduler, now); active {
+		schedulerStatus.Slot = formatSlot(timeTable)
+	}
+
+	if event, exist := getActiveCalendarEvent(scheduler, scheduleTime(scheduler, now)); exist {
+		schedulerStatus.Calendar = event.Summary
+	}
+	if exception, exist := getActiveException(scheduler, scheduleTime(scheduler, now)); exist {
+		schedulerStatus.Exception = exception.String()
+	}
+
+	if active, exist := getActiveOverride(scheduler.Topic, now); exist {
+		schedulerStatus.Override = &override{Temperature: active.Temperature, Until: active.Until}
+	}
+
+	if hold, exist := getActiveHold(scheduler.Topic, now); exist {
+		schedulerStatus.ManualHold = &override{Temperature: hold.Temperature, Until: hold.Until}
+	}
+
+	if ramp, ramping := getActiveRamp(scheduler, now); ramping {
+		schedulerStatus.Ramp = &ramp
+	}
+
+	if scheduler.OptimumStartMaxLead > 0 {
+		model := getHeatingModel(scheduler, now)
+		schedulerStatus.Preheat, schedulerStatus.HeatingRate = model.Preheat, model.HeatingRate
+	}
+
+	if scheduler.zone() {
+		schedulerStatus.Trvs = getTrvsStatus(scheduler)
+	} else {
+		schedulerStatus.ReportedTemperature, schedulerStatus.Confirmed = getReportedSetpoint(scheduler.Topic)
+	}
+
+	stateStore.View(func(state *store.State) {
+		if setpoint, exist := state.Setpoints[scheduler.Topic]; exist {
+			temperature := setpoint.Temperature
+			lastPublished := setpoint.Time
+			schedulerStatus.PublishedTemperature = &temperature
+			schedulerStatus.LastPublished = &lastPublished
+		}
+	})
+	return schedulerStatus
+}
+
+// Publish status of the scheduler, unchanged status isn't published again
+func publishSchedulerStatus(client MQTT.Client, scheduler TemperatureScheduler, now time.Time) {
+	topic := schedulerStatusTopic(scheduler.Topic)
+	if err := statusPublisher.Publish(client, topic, getSchedulerStatus(scheduler, now)); err != nil {
+		log.Printf("Error publishing status to topic %s: %v", topic, err)
+	}
+}
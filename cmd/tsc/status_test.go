@@ -0,0 +1,33 @@
+package main
+
+import (
+	"log"
+	"testing"
+	"time"
+)
+
+func TestGetSchedulerStatus(t *testing.T) {
+	testScheduler := TemperatureScheduler{
+		Topic:              "myhome-kr/livingroom/danfoss-thermo-status",
+		DefaultTemperature: 22,
+		TimeTable: []TimeTable{
+			{
+				Start:       79200, // 22:00
+				End:         21600, // 06:00
+				Temperature: 18,
+			},
+		},
+	}
+
+	status := getSchedulerStatus(testScheduler, time.Date(2023, 2, 4, 23, 0, 0, 0, time.UTC))
+	if status.Temperature != 18 || status.Slot != "22:00-06:00" || status.LastPublished != nil {
+		log.Fatalf("getSchedulerStatus failed at night: %+v", status)
+	}
+
+	publishedAt := time.Date(2023, 2, 4, 12, 0, 0, 0, time.UTC)
+	recordSetpoint(testScheduler.Topic, 22, publishedAt)
+	status = getSchedulerStatus(testScheduler, time.Date(2023, 2, 4, 12, 0, 0, 0, time.UTC))
+	if status.Temperature != 22 || status.Slot != defaultSlot || *status.PublishedTemperature != 22 || !status.LastPublished.Equal(publishedAt) {
+		log.Fatalf("getSchedulerStatus failed at noon: %+v", status)
+	}
+}
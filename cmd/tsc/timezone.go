@@ -0,0 +1,97 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+var (
+	locationsMu sync.Mutex
+	locations   = map[string]*time.Location{}
+	// --time-zone resolved at (re)load, nil when not set, guarded by locationsMu
+	installationZone *time.Location
+)
+
+// Load IANA time zone, eg. Europe/Prague, empty name means the process local zone
+func loadLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+
+	locationsMu.Lock()
+	defer locationsMu.Unlock()
+	if location, exist := locations[name]; exist {
+		return location, nil
+	}
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, err
+	}
+	locations[name] = location
+	return location, nil
+}
+
+// Set time zone of the installation, empty name means the process local zone
+func setInstallationLocation(name string) error {
+	location, err := loadLocation(name)
+	if err != nil {
+		return err
+	}
+	if name == "" {
+		location = nil
+	}
+	locationsMu.Lock()
+	installationZone = location
+	locationsMu.Unlock()
+	return nil
+}
+
+// Get time zone of the installation (--time-zone), process local zone when not set
+func installationLocation() *time.Location {
+	locationsMu.Lock()
+	defer locationsMu.Unlock()
+	if installationZone == nil {
+		return time.Local
+	}
+	return installationZone
+}
+
+// Get time zone schedule of the scheduler is evaluated in
+//
+//	out: time zone; bool - false if no time zone is configured (time is evaluated in its own zone)
+func schedulerLocation(scheduler TemperatureScheduler) (*time.Location, bool) {
+	if scheduler.TimeZone == "" {
+		locationsMu.Lock()
+		defer locationsMu.Unlock()
+		return installationZone, installationZone != nil
+	}
+	location, err := loadLocation(scheduler.TimeZone)
+	if err != nil {
+		// validated at (re)load
+		return nil, false
+	}
+	return location, true
+}
+
+// Get wall clock time the schedule is evaluated at
+//
+// Wall clock never goes backwards: during the hour repeated when DST ends, the clock is held at the end of its first
+// pass (eg. 02:59), so slots started in the first pass keep going and slots ended don't start again. Hour skipped when
+// DST starts simply doesn't happen, slots starting in it start at the clock jump, slots lying in it are skipped.
+func scheduleTime(scheduler TemperatureScheduler, t time.Time) time.Time {
+	if location, exist := schedulerLocation(scheduler); exist {
+		t = t.In(location)
+	}
+
+	zoneStart, _ := t.ZoneBounds()
+	if zoneStart.IsZero() {
+		return t
+	}
+	beforeZone := zoneStart.Add(-time.Second).In(t.Location())
+	_, offset := t.Zone()
+	_, offsetBefore := beforeZone.Zone()
+	if shift := time.Duration(offsetBefore-offset) * time.Second; shift > 0 && t.Sub(zoneStart) < shift {
+		return beforeZone
+	}
+	return t
+}
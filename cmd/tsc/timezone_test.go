@@ -0,0 +1,98 @@
+package main
+
+import (
+	"log"
+	"testing"
+	"time"
+)
+
+func TestSchedulerTimeZone(t *testing.T) {
+	scheduler := TemperatureScheduler{
+		Topic:              "trv",
+		DefaultTemperature: 22,
+		TimeTable:          []TimeTable{{Start: 79200, End: 21600, Temperature: 18}}, // 22:00 - 06:00
+		TimeZone:           "Europe/Prague",
+	}
+
+	// 21:30 UTC is 22:30 in Prague (winter time)
+	if temperature := getTemperatureAtTime(scheduler, time.Date(2023, 2, 4, 21, 30, 0, 0, time.UTC)); temperature != 18 {
+		log.Fatalf("schedule should be evaluated in Europe/Prague, got: %v", temperature)
+	}
+	// 04:30 UTC is 06:30 in Prague (summer time)
+	if temperature := getTemperatureAtTime(scheduler, time.Date(2023, 7, 4, 4, 30, 0, 0, time.UTC)); temperature != 22 {
+		log.Fatalf("schedule should be evaluated in Europe/Prague summer time, got: %v", temperature)
+	}
+
+	// installation time zone applies to schedulers without time zone
+	locationsMu.Lock()
+	previous := installationZone
+	locationsMu.Unlock()
+	if err := setInstallationLocation("America/New_York"); err != nil {
+		log.Fatal(err)
+	}
+	defer func() {
+		locationsMu.Lock()
+		installationZone = previous
+		locationsMu.Unlock()
+	}()
+	scheduler.TimeZone = ""
+	if temperature := getTemperatureAtTime(scheduler, time.Date(2023, 2, 4, 3, 30, 0, 0, time.UTC)); temperature != 18 {
+		log.Fatalf("schedule should be evaluated in America/New_York, got: %v", temperature)
+	}
+}
+
+func TestDaylightSavingTime(t *testing.T) {
+	prague, err := loadLocation("Europe/Prague")
+	if err != nil {
+		log.Fatal(err)
+	}
+	startsAt := TemperatureScheduler{
+		Topic:              "trv",
+		DefaultTemperature: 22,
+		TimeTable:          []TimeTable{{Start: 9000, End: 21600, Temperature: 18}}, // 02:30 - 06:00
+		TimeZone:           "Europe/Prague",
+	}
+	endsAt := TemperatureScheduler{
+		Topic:              "trv",
+		DefaultTemperature: 22,
+		TimeTable:          []TimeTable{{Start: 79200, End: 9000, Temperature: 18}}, // 22:00 - 02:30
+		TimeZone:           "Europe/Prague",
+	}
+
+	tests := []struct {
+		name      string
+		scheduler TemperatureScheduler
+		time      time.Time
+		expected  float64
+	}{
+		// 2023-03-26 02:00 CET jumps to 03:00 CEST, 02:30 doesn't exist
+		{"spring, before jump", startsAt, time.Date(2023, 3, 26, 0, 59, 0, 0, time.UTC), 22},           // 01:59 CET
+		{"spring, slot starts at jump", startsAt, time.Date(2023, 3, 26, 1, 0, 0, 0, time.UTC), 18},    // 03:00 CEST
+		{"spring, slot continues", startsAt, time.Date(2023, 3, 26, 3, 0, 0, 0, time.UTC), 18},         // 05:00 CEST
+		{"spring, slot active before jump", endsAt, time.Date(2023, 3, 26, 0, 59, 0, 0, time.UTC), 18}, // 01:59 CET
+		{"spring, slot ends at jump", endsAt, time.Date(2023, 3, 26, 1, 0, 0, 0, time.UTC), 22},        // 03:00 CEST
+		// 2023-10-29 03:00 CEST goes back to 02:00 CET, 02:30 happens twice
+		{"autumn, before slot", startsAt, time.Date(2023, 10, 29, 0, 10, 0, 0, time.UTC), 22},                               // 02:10 CEST
+		{"autumn, slot starts at first 02:30", startsAt, time.Date(2023, 10, 29, 0, 30, 0, 0, time.UTC), 18},                // 02:30 CEST
+		{"autumn, slot keeps going in repeated hour", startsAt, time.Date(2023, 10, 29, 1, 10, 0, 0, time.UTC), 18},         // 02:10 CET
+		{"autumn, slot after repeated hour", startsAt, time.Date(2023, 10, 29, 2, 10, 0, 0, time.UTC), 18},                  // 03:10 CET
+		{"autumn, slot ends at first 02:30", endsAt, time.Date(2023, 10, 29, 0, 31, 0, 0, time.UTC), 22},                    // 02:31 CEST
+		{"autumn, ended slot doesn't restart in repeated hour", endsAt, time.Date(2023, 10, 29, 1, 10, 0, 0, time.UTC), 22}, // 02:10 CET
+	}
+
+	for _, tt := range tests {
+		if temperature := getTemperatureAtTime(tt.scheduler, tt.time); temperature != tt.expected {
+			log.Fatalf("%s (%s): expected %v, got %v", tt.name, tt.time.In(prague).Format("15:04 MST"), tt.expected, temperature)
+		}
+	}
+}
+
+func TestScheduleTimeRepeatedHour(t *testing.T) {
+	scheduler := TemperatureScheduler{TimeZone: "Europe/Prague"}
+	if wallClock := scheduleTime(scheduler, time.Date(2023, 10, 29, 1, 10, 0, 0, time.UTC)); wallClock.Format("15:04:05 MST") != "02:59:59 CEST" {
+		log.Fatalf("repeated hour should hold the clock at end of the first pass, got: %s", wallClock.Format("15:04:05 MST"))
+	}
+	if wallClock := scheduleTime(scheduler, time.Date(2023, 10, 29, 2, 0, 0, 0, time.UTC)); wallClock.Format("15:04 MST") != "03:00 CET" {
+		log.Fatalf("clock should continue after the repeated hour, got: %s", wallClock.Format("15:04 MST"))
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/status"
+	"github.com/jacfal.io/homeaut/pkg/store"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// TRV state attribute holding the scheduled setpoint
+const scheduledSetpointAttribute = "occupied_heating_setpoint_scheduled"
+
+// setpointConfirmation tracks read back of the setpoint published to the TRV
+type setpointConfirmation struct {
+	expected   float64
+	published  time.Time
+	confirmed  bool
+	retries    int
+	reported   *float64 // last setpoint reported by the TRV
+	reportedAt time.Time
+}
+
+// key: TRV topic, guarded by mu
+var confirmations = map[string]*setpointConfirmation{}
+
+func heatingSetpointTopic(topic string) string {
+	return topic + "/set/" + scheduledSetpointAttribute
+}
+
+// Expect the TRV to report published setpoint
+//
+//	in: retry - publish is a retry of unconfirmed setpoint
+func expectSetpoint(topic string, temperature float64, now time.Time, retry bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	confirmation, exist := confirmations[topic]
+	if !exist {
+		confirmation = &setpointConfirmation{}
+		confirmations[topic] = confirmation
+	}
+	if retry {
+		confirmation.retries++
+	} else {
+		confirmation.retries = 0
+	}
+	confirmation.expected = temperature
+	confirmation.published = now
+	confirmation.confirmed = false
+}
+
+// Record setpoint reported on the TRV state topic
+//
+//	out: bool - true if the payload reports the scheduled setpoint
+func recordReportedSetpoint(topic string, payload []byte, now time.Time) bool {
+	var state map[string]interface{}
+	if err := json.Unmarshal(payload, &state); err != nil {
+		return false
+	}
+	reported, ok := state[scheduledSetpointAttribute].(float64)
+	if !ok {
+		return false
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	confirmation, exist := confirmations[topic]
+	if !exist {
+		confirmation = &setpointConfirmation{confirmed: true}
+		confirmations[topic] = confirmation
+	}
+	confirmation.reported = &reported
+	confirmation.reportedAt = now
+	if confirmation.published.IsZero() {
+		return true
+	}
+	if math.Abs(reported-confirmation.expected) < 0.01 {
+		if !confirmation.confirmed {
+			log.Printf("TRV %s confirmed setpoint %s°C", topic, formatSetpoint(reported))
+		}
+		confirmation.confirmed = true
+		confirmation.retries = 0
+	} else if !confirmation.confirmed {
+		log.Printf("Warning! TRV %s reports setpoint %s°C, expected %s°C", topic, formatSetpoint(reported), formatSetpoint(confirmation.expected))
+	}
+	return true
+}
+
+// Check if unconfirmed setpoint should be published again, confirmation args are read under mu as the reload
+// applies them
+func setpointRetryNeeded(topic string, now time.Time) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	if *confirmTimeout <= 0 {
+		return false
+	}
+	confirmation, exist := confirmations[topic]
+	if !exist || confirmation.confirmed || now.Sub(confirmation.published) < *confirmTimeout {
+		return false
+	}
+	if confirmation.retries >= *confirmRetries {
+		if confirmation.retries == *confirmRetries {
+			log.Printf("Warning! TRV %s didn't confirm setpoint %s°C after %d retries, waiting for the next re-assertion", topic, formatSetpoint(confirmation.expected), confirmation.retries)
+			confirmation.retries++
+		}
+		return false
+	}
+	log.Printf("TRV %s didn't confirm setpoint %s°C, retrying", topic, formatSetpoint(confirmation.expected))
+	return true
+}
+
+// Check if the setpoint should be re-asserted, last publish is older than the re-assert interval
+func reassertNeeded(topic string, now time.Time) bool {
+	mu.Lock()
+	interval := *reassertInterval
+	mu.Unlock()
+	if interval <= 0 {
+		return false
+	}
+	var setpoint store.Setpoint
+	var exist bool
+	stateStore.View(func(state *store.State) {
+		setpoint, exist = state.Setpoints[topic]
+	})
+	return exist && now.Sub(setpoint.Time) >= interval
+}
+
+// Get setpoint last reported by the TRV and whether it confirms the published setpoint
+func getReportedSetpoint(topic string) (*float64, *bool) {
+	mu.Lock()
+	defer mu.Unlock()
+	confirmation, exist := confirmations[topic]
+	if !exist || confirmation.reported == nil {
+		return nil, nil
+	}
+	reported, confirmed := *confirmation.reported, confirmation.confirmed
+	return &reported, &confirmed
+}
+
+// Ask the TRV to report its scheduled setpoint
+func requestSetpointReadBack(client MQTT.Client, topic string) {
+	getTopic := topic + "/get"
+	payload := fmt.Sprintf(`{"%s": ""}`, scheduledSetpointAttribute)
+	if token := client.Publish(getTopic, 0, false, payload); token.Wait() && token.Error() != nil {
+		log.Printf("Error publishing to topic %s: %v", getTopic, token.Error())
+	}
+}
+
+// Subscribe override, profile and exception command, TRV state and room sensor topics of the schedulers, zones
+// subscribe state of their member TRVs
+func subscribeSchedulers(client MQTT.Client, schedulers schedulersConfigs) {
+	if len(schedulers) == 0 {
+		return
+	}
+	topicsToSubscribe := map[string]byte{}
+	for _, scheduler := range schedulers {
+		topicsToSubscribe[overrideTopic(scheduler.Topic)] = status.QOS
+		topicsToSubscribe[roomProfileTopic(scheduler.Topic)] = status.QOS
+		topicsToSubscribe[exceptionTopic(scheduler.Topic)] = status.QOS
+		for _, trv := range scheduler.trvTopics() {
+			topicsToSubscribe[trv] = status.QOS
+		}
+		for _, sensor := range scheduler.sensorTopics() {
+			topicsToSubscribe[sensor] = status.QOS
+		}
+	}
+	if token := client.SubscribeMultiple(topicsToSubscribe, onSchedulerMessageReceived); token.Wait() && token.Error() != nil {
+		log.Printf("Error! Topics %v subscription failed: %s", topicsToSubscribe, token.Error())
+	} else {
+		log.Printf("Topic %v subscribed", topicsToSubscribe)
+	}
+}
+
+// Unsubscribe override, profile and exception command, TRV state and room sensor topics of the schedulers
+func unsubscribeSchedulers(client MQTT.Client, schedulers schedulersConfigs) {
+	if len(schedulers) == 0 {
+		return
+	}
+	var topics []string
+	for _, scheduler := range schedulers {
+		topics = append(topics, overrideTopic(scheduler.Topic), roomProfileTopic(scheduler.Topic), exceptionTopic(scheduler.Topic))
+		topics = append(topics, scheduler.trvTopics()...)
+		for _, sensor := range scheduler.sensorTopics() {
+			if len(getSensorSchedulers(sensor)) == 0 {
+				topics = append(topics, sensor)
+			}
+		}
+	}
+	if token := client.Unsubscribe(topics...); token.Wait() && token.Error() != nil {
+		log.Printf("Error! Topics %v unsubscription failed: %s", topics, token.Error())
+	}
+}
+
+func onSchedulerMessageReceived(client MQTT.Client, msg MQTT.Message) {
+	if strings.HasSuffix(msg.Topic(), overrideTopicSuffix) {
+		onOverrideMessageReceived(client, msg)
+		return
+	}
+	if strings.HasSuffix(msg.Topic(), profileTopicSuffix) {
+		onProfileMessageReceived(client, msg)
+		return
+	}
+	if strings.HasSuffix(msg.Topic(), exceptionTopicSuffix) {
+		onExceptionMessageReceived(client, msg)
+		return
+	}
+	if schedulers := getSensorSchedulers(msg.Topic()); len(schedulers) > 0 {
+		onRoomSensorMessageReceived(schedulers, msg)
+		return
+	}
+	now := time.Now()
+	recordReportedSetpoint(msg.Topic(), msg.Payload(), now)
+	scheduler, exist := getTrvScheduler(msg.Topic())
+	if !exist {
+		return
+	}
+	if temperature, reported := parseRoomTemperature(msg.Payload()); reported && len(scheduler.sensorTopics()) == 0 {
+		recordZoneTemperature(scheduler, msg.Topic(), temperature, now)
+	}
+	if recordManualSetpoint(scheduler, msg.Topic(), msg.Payload(), now) {
+		updateScheduler(client, scheduler, now, false)
+	}
+}
+
+// Forget read back state of the removed scheduler
+func forgetConfirmation(topic string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(confirmations, topic)
+}
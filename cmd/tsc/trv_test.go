@@ -0,0 +1,69 @@
+package main
+
+import (
+	"log"
+	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/mqtttest"
+)
+
+func TestSetpointReadBack(t *testing.T) {
+	scheduler := TemperatureScheduler{Topic: "readback-trv", DefaultTemperature: 21}
+	defer func() {
+		mu.Lock()
+		delete(lastTemperatures, scheduler.Topic)
+		mu.Unlock()
+		forgetConfirmation(scheduler.Topic)
+	}()
+
+	client := mqtttest.NewClient()
+	subscribeSchedulers(client, schedulersConfigs{scheduler})
+	if _, subscribed := client.Subscriptions[scheduler.Topic]; !subscribed {
+		log.Fatalf("TRV state topic should be subscribed: %v", client.Subscriptions)
+	}
+
+	// startup publishes the current setpoint and asks the TRV to report it
+	now := time.Date(2023, 2, 4, 12, 0, 0, 0, time.UTC)
+	updateScheduler(client, scheduler, now, true)
+	if published := client.PublishedTo(heatingSetpointTopic(scheduler.Topic)); len(published) != 1 || published[0] != "21" {
+		log.Fatalf("current setpoint should be published at startup: %v", published)
+	}
+	if published := client.PublishedTo("readback-trv/get"); len(published) != 1 || published[0] != `{"occupied_heating_setpoint_scheduled": ""}` {
+		log.Fatalf("setpoint read back should be requested: %v", published)
+	}
+
+	// TRV reports other setpoint, publish is retried after the confirm timeout
+	recordReportedSetpoint(scheduler.Topic, []byte(`{"occupied_heating_setpoint_scheduled": 18, "local_temperature": 20.1}`), now.Add(10*time.Second))
+	if setpointRetryNeeded(scheduler.Topic, now.Add(time.Minute)) {
+		log.Fatal("retry shouldn't happen before the confirm timeout")
+	}
+	for i := 1; i <= *confirmRetries; i++ {
+		updateScheduler(client, scheduler, now.Add(time.Duration(i)**confirmTimeout), false)
+	}
+	if published := client.PublishedTo(heatingSetpointTopic(scheduler.Topic)); len(published) != 1+*confirmRetries {
+		log.Fatalf("unconfirmed setpoint should be retried %d times: %v", *confirmRetries, published)
+	}
+	if setpointRetryNeeded(scheduler.Topic, now.Add(time.Hour/2)) {
+		log.Fatal("retries should stop after confirm-retries")
+	}
+
+	// TRV confirms the setpoint
+	client.Deliver(scheduler.Topic, `{"occupied_heating_setpoint_scheduled": 21}`)
+	if reported, confirmed := getReportedSetpoint(scheduler.Topic); reported == nil || *reported != 21 || !*confirmed {
+		log.Fatalf("setpoint should be confirmed: %v, %v", reported, confirmed)
+	}
+	status := getSchedulerStatus(scheduler, now.Add(time.Hour/2))
+	if status.ReportedTemperature == nil || *status.ReportedTemperature != 21 || !*status.Confirmed {
+		log.Fatalf("status should show the confirmed setpoint: %+v", status)
+	}
+
+	// setpoint is re-asserted after the re-assert interval
+	client.Reset()
+	lastPublished := now.Add(time.Duration(*confirmRetries) * *confirmTimeout)
+	updateScheduler(client, scheduler, lastPublished.Add(*reassertInterval-time.Minute), false)
+	updateScheduler(client, scheduler, lastPublished.Add(*reassertInterval), false)
+	if published := client.PublishedTo(heatingSetpointTopic(scheduler.Topic)); len(published) != 1 || published[0] != "21" {
+		log.Fatalf("setpoint should be re-asserted once: %v", published)
+	}
+}
@@ -2,71 +2,258 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/pkg/sensors"
+	"github.com/jacfal.io/homeaut/utils"
 )
 
 var mu sync.Mutex
-var lastTemperatures = make(map[string]int)
+var lastTemperatures = make(map[string]float64)
 
 type TimeTable struct {
-	Start       int64 `json:"start"` // seconds from midnight
-	End         int64 `json:"end"`   // seconds from midnight
-	Temperature int   `json:"temperature"`
+	Start       int64      `json:"start"` // seconds from midnight
+	End         int64      `json:"end"`   // seconds from midnight
+	Temperature float64    `json:"temperature"`
+	Days        Weekdays   `json:"days,omitempty"` // days the interval starts on, empty = every day
+	SolarStart  *SolarTime `json:"-"`              // start relative to sunrise or sunset, resolved for each day
+	SolarEnd    *SolarTime `json:"-"`
+	Ramp        *Ramp      `json:"ramp,omitempty"` // temperature is reached gradually from the start
 }
 
 type TemperatureScheduler struct {
-	Topic              string      `json:"topic"`
-	DefaultTemperature int         `json:"defaultTemperature"`
-	TimeTable          []TimeTable `json:"timeTable"`
+	Topic               string                `json:"topic"`
+	DefaultTemperature  float64               `json:"defaultTemperature"`
+	TimeTable           []TimeTable           `json:"timeTable"`
+	Programs            map[string]DayProgram `json:"programs,omitempty"`            // day programs, eg. workday, weekend
+	TimeZone            string                `json:"timeZone,omitempty"`            // IANA time zone, installation time zone when empty
+	TrvModel            string                `json:"trvModel,omitempty"`            // setpoints are rounded to the step of the model
+	ManualHold          string                `json:"manualHold,omitempty"`          // ignore, until-next-slot (default) or duration
+	ManualHoldDuration  utils.Duration        `json:"manualHoldDuration,omitempty"`  // hold length, limits until-next-slot hold
+	Profiles            map[string]Profile    `json:"profiles,omitempty"`            // named profiles, eg. away, eco
+	Exceptions          []Exception           `json:"exceptions,omitempty"`          // days replacing the weekly schedule
+	SensorTopic         string                `json:"sensorTopic,omitempty"`         // room temperature sensor, TRV local_temperature when empty
+	SensorModel         string                `json:"sensorModel,omitempty"`         // sensor payload decoder, sensors.DefaultModel when empty
+	OptimumStartMaxLead utils.Duration        `json:"optimumStartMaxLead,omitempty"` // rising setpoints start at most this ahead, disabled when 0
+	Trvs                []string              `json:"trvs,omitempty"`                // TRVs of the zone, topic names the zone when set
+	GroupTopic          string                `json:"groupTopic,omitempty"`          // Zigbee2MQTT group of the zone TRVs, set by one publish
+	SensorTopics        []string              `json:"sensorTopics,omitempty"`        // more room sensors, room temperature is their mean
 }
 
 // Check if time table is in defined interval
+//
+// Intervals are half-open, 06:00 - 08:00 ends right before 08:00, so it can be followed by 08:00 - 10:00
 func timeTableInInterval(timeTable TimeTable, time time.Time) bool {
-	timeSeconds := getSecondsFromMidnight(time.Hour(), time.Minute())
+	timeSeconds := getSecondsOfDay(time)
+	start, end := timeTableSpan(timeTable)
+	// eg. 06:00 - 22:00, or 22:00 - 06:00 continuing after midnight
+	return timeSeconds >= start && timeSeconds < end || timeSeconds+secondsPerDay >= start && timeSeconds+secondsPerDay < end
+}
+
+// Get interval of the time table as [start, end) seconds from midnight of its day
+//
+//	out: start; end - after start, intervals crossing midnight end the next day (end > 86400),
+//	     equal start and end (eg. 00:00 - 00:00) is all day
+func timeTableSpan(timeTable TimeTable) (int64, int64) {
+	if timeTable.End <= timeTable.Start {
+		return timeTable.Start, timeTable.End + secondsPerDay
+	}
+	return timeTable.Start, timeTable.End
+}
+
+// Get schedule at given time, calendar events precede the exception of the day, exception precedes the weekly
+// schedule of the active profile, day programs precede every day entries
+//
+//	out: time table; bool - false if no time table is active; default temperature of the schedule
+func resolveSchedule(scheduler TemperatureScheduler, time time.Time) (TimeTable, bool, float64) {
+	time = scheduleTime(scheduler, time)
+	if event, exist := getActiveCalendarEvent(scheduler, time); exist {
+		return getCalendarTimeTable(scheduler, event, time)
+	}
+	if exception, exist := getActiveException(scheduler, time); exist {
+		timeTable, active := getExceptionTimeTable(scheduler, exception, time)
+		return timeTable, active, getExceptionDefaultTemperature(scheduler, exception)
+	}
+	scheduler = profileScheduler(scheduler)
+	timeTable, active := getActiveEntry(scheduler, time)
+	return timeTable, active, scheduler.DefaultTemperature
+}
+
+// Get entry of the scheduler time tables active at given time
+//
+//	in: time - time in the scheduler time zone
+func getActiveEntry(scheduler TemperatureScheduler, time time.Time) (TimeTable, bool) {
+	for _, timeTable := range schedulerEntries(scheduler) {
+		if resolved, active := activeTimeTable(timeTable, time); active {
+			return resolved, true
+		}
+	}
+	return TimeTable{}, false
+}
+
+// Get time table active at given time
+//
+//	out: time table; bool - false if no time table is active (default temperature applies)
+func getTimeTableAtTime(scheduler TemperatureScheduler, time time.Time) (TimeTable, bool) {
+	timeTable, active, _ := resolveSchedule(scheduler, time)
+	return timeTable, active
+}
+
+// Get configured temperature for given time, ramping time tables step toward their temperature
+func getTemperatureAtTime(scheduler TemperatureScheduler, time time.Time) float64 {
+	timeTable, active, defaultTemperature := resolveSchedule(scheduler, time)
+	if active && timeTable.Ramp != nil {
+		return rampTemperature(scheduler, timeTable, scheduleTime(scheduler, time))
+	} else if active {
+		return timeTable.Temperature
+	}
+	return defaultTemperature
+}
+
+// Get temperature of the slot active at given time, ramps aren't considered
+func getSlotTemperature(scheduler TemperatureScheduler, time time.Time) float64 {
+	timeTable, active, defaultTemperature := resolveSchedule(scheduler, time)
+	if active {
+		return timeTable.Temperature
+	}
+	return defaultTemperature
+}
+
+// Walk time forward minute by minute and find the first change of the value
+//
+//	in: from - start (whole seconds); until - end of the search (exclusive); value - eg. temperature at given time
+//	out: time of the change, exact to the second; bool - false if the value doesn't change until the end
+func findNextChange(from time.Time, until time.Time, value func(time.Time) string) (time.Time, bool) {
+	initial := value(from)
+	previous := from
+	for t := from.Truncate(time.Minute).Add(time.Minute); t.Before(until); t = t.Add(time.Minute) {
+		if value(t) != initial {
+			return bisectChange(previous, t, initial, value), true
+		}
+		previous = t
+	}
+	return time.Time{}, false
+}
+
+// Find the first change of the value at given times only, eg. at the schedule boundaries
+//
+//	in: from - start (whole seconds); times - ascending times after from; value - eg. slot at given time
+//	out: time of the change, exact to the second; bool - false if the value doesn't change at any of the times
+func findNextChangeAt(from time.Time, times []time.Time, value func(time.Time) string) (time.Time, bool) {
+	initial := value(from)
+	previous := from
+	for _, t := range times {
+		if value(t) != initial {
+			return bisectChange(previous, t, initial, value), true
+		}
+		previous = t
+	}
+	return time.Time{}, false
+}
 
-	if timeTable.Start == 0 && timeTable.End == 0 { // all day
-		return true
-	} else if timeTable.Start > timeTable.End { // eg. 22:00 - 06:00
-		return timeSeconds >= timeTable.Start && timeSeconds <= 86400 || timeSeconds >= 0 && timeSeconds <= timeTable.End
-	} else { // eg. 06:00 - 22:00
-		return timeSeconds >= timeTable.Start && timeSeconds <= timeTable.End
+// Find the exact second the value changed between low (initial value) and high (changed value)
+func bisectChange(low time.Time, high time.Time, initial string, value func(time.Time) string) time.Time {
+	for high.Sub(low) > time.Second {
+		middle := low.Add(high.Sub(low) / 2).Truncate(time.Second)
+		if value(middle) == initial {
+			low = middle
+		} else {
+			high = middle
+		}
 	}
+	return high
 }
 
-// Get configured temperature for given time
-func getTemperatureAtTime(scheduler TemperatureScheduler, time time.Time) int {
-	for _, timeTable := range scheduler.TimeTable {
-		if timeTableInInterval(timeTable, time) {
-			return timeTable.Temperature
+// Get times the schedule may change at in (from, until): starts and ends of the time tables and midnights of every
+// day in the scheduler time zone, starts and ends of the calendar events
+//
+//	out: times in ascending order
+func scheduleBoundaries(scheduler TemperatureScheduler, from time.Time, until time.Time) []time.Time {
+	location := from.Location()
+	if schedulerLocation, exist := schedulerLocation(scheduler); exist {
+		location = schedulerLocation
+	}
+	timeTables := append([]TimeTable{}, scheduler.TimeTable...)
+	for _, program := range scheduler.Programs {
+		timeTables = append(timeTables, program.TimeTable...)
+	}
+	for _, profile := range scheduler.Profiles {
+		timeTables = append(timeTables, profile.TimeTable...)
+		for _, program := range profile.Programs {
+			timeTables = append(timeTables, program.TimeTable...)
+		}
+	}
+
+	var boundaries []time.Time
+	add := func(t time.Time) {
+		if t = t.Truncate(time.Second); t.After(from) && t.Before(until) {
+			boundaries = append(boundaries, t)
+		}
+	}
+	start := from.In(location)
+	for day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, location); day.Before(until); day = day.AddDate(0, 0, 1) {
+		seconds := []int64{0}
+		for _, timeTable := range timeTables {
+			if !timeTable.solar() {
+				seconds = append(seconds, timeTable.Start, timeTable.End)
+				continue
+			}
+			// intervals started the previous day may end today
+			for _, resolvedDay := range []time.Time{day.AddDate(0, 0, -1), day} {
+				if resolved, ok := resolveSolarTimeTable(timeTable, resolvedDay); ok {
+					seconds = append(seconds, resolved.Start, resolved.End)
+				}
+			}
+		}
+		for _, second := range seconds {
+			add(time.Date(day.Year(), day.Month(), day.Day(), 0, 0, int(second), 0, location))
+		}
+	}
+	for _, boundary := range calendarBoundaries(from, until) {
+		add(boundary)
+	}
+
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i].Before(boundaries[j]) })
+	unique := boundaries[:0]
+	for i, boundary := range boundaries {
+		if i == 0 || !boundary.Equal(boundaries[i-1]) {
+			unique = append(unique, boundary)
 		}
 	}
-	return scheduler.DefaultTemperature
+	return unique
 }
 
 // Check if temperature update is needed
 //
 //	in: scheduler - temperature scheduler table
 //	out: bool - true if update is needed; tempature - temperature to set (0 if update not needed)
-func temperatureUpdateNeeded(scheduler TemperatureScheduler, time time.Time) (bool, int) {
+func temperatureUpdateNeeded(scheduler TemperatureScheduler, time time.Time) (bool, float64) {
 	mu.Lock()
 	defer mu.Unlock()
 
-	temperature := getTemperatureAtTime(scheduler, time)
+	temperature := getTargetTemperature(scheduler, time)
 	lastTemperature, exist := lastTemperatures[scheduler.Topic]
 	if exist {
 		if lastTemperature != temperature {
-			log.Printf("Temperature update needed for %s, last: %d, current: %d", scheduler.Topic, lastTemperature, temperature)
+			if ramp, ramping := getActiveRamp(scheduler, time); ramping {
+				log.Printf("Ramping %s to %.1f until %s", scheduler.Topic, ramp.Temperature, ramp.Until.Format("15:04:05"))
+			}
+			log.Printf("Temperature update needed for %s, last: %.1f, current: %.1f", scheduler.Topic, lastTemperature, temperature)
 			lastTemperatures[scheduler.Topic] = temperature
 			return true, temperature
 		} else {
 			return false, 0
 		}
 	} else {
-		log.Printf("Creating temperature state for topic %s, value: %d", scheduler.Topic, temperature)
+		log.Printf("Creating temperature state for topic %s, value: %.1f", scheduler.Topic, temperature)
 		lastTemperatures[scheduler.Topic] = temperature
 		return false, 0
 	}
@@ -97,61 +284,264 @@ func temperatureUpdateNeeded(scheduler TemperatureScheduler, time time.Time) (bo
 func parseTimeTable(tempSchedulerJson string) (TemperatureScheduler, error) {
 	log.Printf("Parsing time table: %s", tempSchedulerJson)
 	var tempScheduler TemperatureScheduler
-	err := json.Unmarshal([]byte(tempSchedulerJson), &tempScheduler)
+	err := config.DecodeJSON([]byte(tempSchedulerJson), &tempScheduler)
 	if err != nil {
-		log.Fatalf("Time table parsing failed")
 		return TemperatureScheduler{}, err
 	}
 	return tempScheduler, nil
 }
 
-// Detect time table overlaps
-func checkTimeTableOverlap(scheduler TemperatureScheduler) {
-	for i, timeTable := range scheduler.TimeTable {
-		for j, timeTable2 := range scheduler.TimeTable {
-			if i != j && checksOverlaps(timeTable, timeTable2) {
-				log.Fatalf("Time table overlap detected: %s", scheduler.Topic)
+// Detect time table overlaps, entries overlapping on any day of the week are reported
+//
+//	out: config.Errors naming both conflicting entries, eg. timeTable[0]: 22:00-06:00 overlaps timeTable[1] 05:00-07:00 on sat
+func checkTimeTableOverlap(scheduler TemperatureScheduler) error {
+	var errs config.Errors
+	entries := getScheduleEntries(scheduler)
+	for i, entry := range entries {
+		for _, other := range entries[i+1:] {
+			if entry.solar() || other.solar() {
+				// times differ every day, checked by checkSolarOverlaps
+				continue
+			}
+			day, overlap := weekOverlap(entry.TimeTable, other.TimeTable)
+			if !overlap {
+				continue
+			}
+			err := fmt.Errorf("%s overlaps %s %s", formatSlot(entry.TimeTable), other.Path, formatSlot(other.TimeTable))
+			if entry.Days != 0 || other.Days != 0 {
+				err = fmt.Errorf("%v on %s", err, Weekdays(1<<day))
+			}
+			errs.Append(config.FieldErr(entry.Path, err))
+		}
+	}
+	return errs.Err()
+}
+
+// Check if time tables overlap on any day of the week, intervals crossing midnight continue into the next day
+//
+//	out: day the overlap starts; bool - true if time tables overlap
+func weekOverlap(t1 TimeTable, t2 TimeTable) (time.Weekday, bool) {
+	start1, end1 := timeTableSpan(t1)
+	start2, end2 := timeTableSpan(t2)
+	for day1 := time.Sunday; day1 <= time.Saturday; day1++ {
+		if !t1.Days.Contains(day1) {
+			continue
+		}
+		for day2 := time.Sunday; day2 <= time.Saturday; day2++ {
+			if !t2.Days.Contains(day2) {
+				continue
+			}
+			offset1, offset2 := int64(day1)*secondsPerDay, int64(day2)*secondsPerDay
+			if overlapStart, overlap := intervalsOverlap(offset1+start1, offset1+end1, offset2+start2, offset2+end2, secondsPerWeek); overlap {
+				return time.Weekday(overlapStart / secondsPerDay), true
 			}
 		}
 	}
+	return 0, false
 }
 
-// Check if time table overlaps
+// Check if half-open intervals [start1, end1) and [start2, end2) repeating every period overlap
+//
+//	out: start of the overlap within the period; bool - true if intervals overlap
+func intervalsOverlap(start1 int64, end1 int64, start2 int64, end2 int64, period int64) (int64, bool) {
+	for _, shift := range []int64{-period, 0, period} {
+		if start1 < end2+shift && start2+shift < end1 {
+			overlapStart := start1
+			if start2+shift > overlapStart {
+				overlapStart = start2 + shift
+			}
+			return (overlapStart%period + period) % period, true
+		}
+	}
+	return 0, false
+}
+
+// Check if time tables overlap at any time of day, days of the time tables aren't considered
 func checksOverlaps(t1 TimeTable, t2 TimeTable) bool {
-	return t1.Start <= t2.End && t2.Start <= t1.End
+	start1, end1 := timeTableSpan(t1)
+	start2, end2 := timeTableSpan(t2)
+	_, overlap := intervalsOverlap(start1, end1, start2, end2, secondsPerDay)
+	return overlap
 }
 
+const (
+	secondsPerDay  = 24 * 3600
+	secondsPerWeek = 7 * secondsPerDay
+)
+
+// Get seconds from midnight of wall clock time, independent of time zone
 func getSecondsFromMidnight(hours int, minutes int) int64 {
-	date := time.Date(1970, 1, 1, hours, minutes, 0, 0, time.UTC)
-	return date.Unix()
+	return int64(hours*3600 + minutes*60)
 }
 
-// convert string to integer, fatal when conversion fails
-func convertOrFatal(strInt string) int {
-	result, err := strconv.Atoi(strInt)
-	if err != nil {
-		log.Fatalf("Can't parse integer: %s", strInt)
+// Parse time of day, accepts HH:MM, HH:MM:SS and 24:00 (end of the day)
+//
+//	out: seconds from midnight
+func parseTimeOfDay(value string) (int64, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM, HH:MM:SS or 24:00", value)
+	}
+	var numbers [3]int
+	for i, part := range parts {
+		if len(part) == 0 || len(part) > 2 || (i > 0 && len(part) != 2) {
+			return 0, fmt.Errorf("invalid time %q, expected HH:MM, HH:MM:SS or 24:00", value)
+		}
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 0 {
+			return 0, fmt.Errorf("invalid time %q, expected HH:MM, HH:MM:SS or 24:00", value)
+		}
+		numbers[i] = number
+	}
+
+	hours, minutes, seconds := numbers[0], numbers[1], numbers[2]
+	if hours == 24 && minutes == 0 && seconds == 0 {
+		return secondsPerDay, nil
+	} else if hours > 23 {
+		return 0, fmt.Errorf("invalid time %q, hours out of range 0-23", value)
+	} else if minutes > 59 {
+		return 0, fmt.Errorf("invalid time %q, minutes out of range 0-59", value)
+	} else if seconds > 59 {
+		return 0, fmt.Errorf("invalid time %q, seconds out of range 0-59", value)
 	}
-	return result
+	return getSecondsFromMidnight(hours, minutes) + int64(seconds), nil
 }
 
+// Get seconds from midnight of the time including seconds
+func getSecondsOfDay(t time.Time) int64 {
+	return getSecondsFromMidnight(t.Hour(), t.Minute()) + int64(t.Second())
+}
+
+var timeTableFields = []string{"days", "end", "ramp", "start", "temperature"}
+
 func (t *TimeTable) UnmarshalJSON(data []byte) error {
-	// custom unmarshaler for TimeTable
-	var dat map[string]interface{}
+	// custom unmarshaler for TimeTable, start and end are times of day
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return fmt.Errorf("expected object with start, end and temperature: %w", err)
+	}
+
+	*t = TimeTable{}
+	var errs config.Errors
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		switch name {
+		case "start", "end", "temperature", "days", "ramp":
+		default:
+			errs.Append(config.FieldErr(name, fmt.Errorf("unknown field (known fields: %s)", strings.Join(timeTableFields, ", "))))
+		}
+	}
 
-	if err := json.Unmarshal(data, &dat); err != nil {
-		return err
+	var err error
+	if t.Start, t.SolarStart, err = parseTimeOfDayField(fields, "start"); err != nil {
+		errs.Append(config.FieldErr("start", err))
+	} else if t.Start == secondsPerDay {
+		errs.Append(config.FieldErr("start", errors.New("24:00 is allowed as end only")))
+	}
+	if t.End, t.SolarEnd, err = parseTimeOfDayField(fields, "end"); err != nil {
+		errs.Append(config.FieldErr("end", err))
+	}
+
+	if temperature, exist := fields["temperature"]; !exist {
+		errs.Append(config.FieldErr("temperature", errors.New("must be set")))
+	} else if err := json.Unmarshal(temperature, &t.Temperature); err != nil {
+		errs.Append(config.FieldErr("temperature", fmt.Errorf("expected number, got %s", temperature)))
+	}
+
+	if days, exist := fields["days"]; exist {
+		if err := t.Days.UnmarshalJSON(days); err != nil {
+			errs.Append(config.FieldErr("days", err))
+		}
 	}
 
-	startSplit := strings.Split(dat["start"].(string), ":")
-	startSeconds := getSecondsFromMidnight(convertOrFatal(startSplit[0]), convertOrFatal(startSplit[1]))
+	if ramp, exist := fields["ramp"]; exist {
+		t.Ramp = &Ramp{}
+		if err := config.DecodeJSON(ramp, t.Ramp); err != nil {
+			errs.Append(config.WithPath("ramp", err))
+		} else if err := checkRamp(*t); err != nil && errs.Err() == nil {
+			errs.Append(config.FieldErr("ramp", err))
+		}
+	}
+	return errs.Err()
+}
+
+// Parse time of day or solar time field of the time table
+//
+//	out: seconds from midnight; solar time, nil for time of day; error
+func parseTimeOfDayField(fields map[string]json.RawMessage, name string) (int64, *SolarTime, error) {
+	raw, exist := fields[name]
+	if !exist {
+		return 0, nil, errors.New("must be set")
+	}
+	var value string
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return 0, nil, fmt.Errorf("expected time of day string, eg. \"22:00\" or \"sunrise-00:30\", got %s", raw)
+	}
+	if solarTime, isSolar, err := parseSolarTime(value); isSolar {
+		return 0, solarTime, err
+	}
+	seconds, err := parseTimeOfDay(value)
+	return seconds, nil, err
+}
 
-	endSplit := strings.Split(dat["end"].(string), ":")
-	endSeconds := getSecondsFromMidnight(convertOrFatal(endSplit[0]), convertOrFatal(endSplit[1]))
+// Check setpoints of the scheduler are within limits of its TRV model
+func checkSetpointLimits(scheduler TemperatureScheduler, model sensors.TrvModel) error {
+	var errs config.Errors
+	check := func(path string, temperature float64) {
+		if err := checkSetpointLimit(temperature, model); err != nil {
+			errs.Append(config.FieldErr(path, err))
+		}
+	}
 
-	t.Start = startSeconds
-	t.End = endSeconds
-	t.Temperature = int(dat["temperature"].(float64))
+	check("defaultTemperature", scheduler.DefaultTemperature)
+	for i, timeTable := range scheduler.TimeTable {
+		check(fmt.Sprintf("timeTable[%d].temperature", i), timeTable.Temperature)
+	}
+	programNames := make([]string, 0, len(scheduler.Programs))
+	for name := range scheduler.Programs {
+		programNames = append(programNames, name)
+	}
+	sort.Strings(programNames)
+	for _, name := range programNames {
+		for i, timeTable := range scheduler.Programs[name].TimeTable {
+			check(fmt.Sprintf("programs.%s.timeTable[%d].temperature", name, i), timeTable.Temperature)
+		}
+	}
+	return errs.Err()
+}
 
+// Check temperature is within limits of the TRV model, zero limit isn't checked
+func checkSetpointLimit(temperature float64, model sensors.TrvModel) error {
+	if model.MinSetpoint != 0 && temperature < model.MinSetpoint {
+		return fmt.Errorf("temperature %v is below minimum %v of the TRV", temperature, model.MinSetpoint)
+	} else if model.MaxSetpoint != 0 && temperature > model.MaxSetpoint {
+		return fmt.Errorf("temperature %v is above maximum %v of the TRV", temperature, model.MaxSetpoint)
+	}
 	return nil
 }
+
+// Check scheduler time table overlaps, TRV model and setpoint limits
+func checkScheduler(scheduler TemperatureScheduler, models map[string]sensors.TrvModel) error {
+	var errs config.Errors
+	errs.Append(checkTimeTableOverlap(scheduler))
+	errs.Append(checkManualHold(scheduler))
+	errs.Append(checkOptimumStart(scheduler))
+	errs.Append(checkZone(scheduler))
+	if model, err := getTrvModel(scheduler.TrvModel, models); err != nil {
+		errs.Append(config.FieldErr("trvModel", err))
+	} else {
+		errs.Append(checkSetpointLimits(scheduler, model))
+		errs.Append(checkProfiles(scheduler, model))
+		errs.Append(checkExceptions(scheduler, model))
+	}
+	return errs.Err()
+}
+
+// Format setpoint published to the TRV, eg. 20.5 or 22
+func formatSetpoint(temperature float64) string {
+	return strconv.FormatFloat(temperature, 'f', -1, 64)
+}
@@ -2,8 +2,11 @@ package main
 
 import (
 	"log"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/sensors"
 )
 
 func TestIfTimeTableParsedCorrectly(t *testing.T) {
@@ -64,7 +67,7 @@ func TestIfTemperatureAtTimeReturnsValidValue(t *testing.T) {
 		TimeTable:          testTimeTables,
 	}
 
-	testTimesWithExpected := map[time.Time]int{
+	testTimesWithExpected := map[time.Time]float64{
 		time.Date(2023, 2, 3, 16, 0, 0, 0, time.UTC): 25,
 		time.Date(2023, 2, 3, 21, 0, 0, 0, time.UTC): 22,
 		time.Date(2023, 2, 4, 2, 15, 0, 0, time.UTC): 18,
@@ -74,7 +77,7 @@ func TestIfTemperatureAtTimeReturnsValidValue(t *testing.T) {
 	for testTime, expected := range testTimesWithExpected {
 		result := getTemperatureAtTime(testScheduler, testTime)
 		if result != expected {
-			log.Fatalf("getTemperatureAtTime failed, expected: %d, got: %d", expected, result)
+			log.Fatalf("getTemperatureAtTime failed, expected: %v, got: %v", expected, result)
 		}
 	}
 }
@@ -141,7 +144,7 @@ func TestTimeTableNotInInterval(t *testing.T) {
 
 func TestTemperatureUpdateNeeded(t *testing.T) {
 	var update bool
-	var temperature int
+	var temperature float64
 	testTimeTables := []TimeTable{
 		{
 			Start:       36000, // 10:00
@@ -166,7 +169,7 @@ func TestTemperatureUpdateNeeded(t *testing.T) {
 	if !update {
 		log.Fatal("temperatureUpdateNeeded #1 failed, update should be true")
 	} else if temperature != 22 {
-		log.Fatalf("temperatureUpdateNeeded #1 failed, temperature should be 22, got: %d", temperature)
+		log.Fatalf("temperatureUpdateNeeded #1 failed, temperature should be 22, got: %v", temperature)
 	}
 
 	// one minutes later, should return false because no update is needed
@@ -180,7 +183,7 @@ func TestTemperatureUpdateNeeded(t *testing.T) {
 	if !update {
 		log.Fatal("temperatureUpdateNeeded #3 failed, update should be true")
 	} else if temperature != 25 {
-		log.Fatalf("temperatureUpdateNeeded #3 failed, temperature should be 25, got: %d", temperature)
+		log.Fatalf("temperatureUpdateNeeded #3 failed, temperature should be 25, got: %v", temperature)
 	}
 }
 
@@ -256,3 +259,146 @@ func TestChecksOverlaps(t *testing.T) {
 		log.Fatal("checksOverlaps #3 failed, should overlap")
 	}
 }
+
+func TestFractionalSetpoints(t *testing.T) {
+	testScheduler, err := parseTimeTable(`{"topic": "fractional-trv", "defaultTemperature": 20.5, "timeTable": [{"start": "22:00", "end": "06:00", "temperature": 18.7}]}`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	noon := time.Date(2023, 2, 4, 12, 0, 0, 0, time.UTC)
+	night := time.Date(2023, 2, 4, 23, 0, 0, 0, time.UTC)
+	if temperature := getTargetTemperature(testScheduler, noon); temperature != 20.5 || formatSetpoint(temperature) != "20.5" {
+		log.Fatalf("getTargetTemperature at noon should be 20.5, got: %v", temperature)
+	}
+	// rounded to 0.5°C step of the default TRV model
+	if temperature := getTargetTemperature(testScheduler, night); temperature != 18.5 {
+		log.Fatalf("getTargetTemperature at night should be 18.5, got: %v", temperature)
+	}
+
+	// configured step of the model
+	testScheduler.TrvModel = "whole-degree-trv"
+	trvModelsMu.Lock()
+	trvModels = map[string]sensors.TrvModel{"whole-degree-trv": {SetpointStep: 1}}
+	trvModelsMu.Unlock()
+	defer func() {
+		trvModelsMu.Lock()
+		trvModels = nil
+		trvModelsMu.Unlock()
+	}()
+	if temperature := getTargetTemperature(testScheduler, night); temperature != 19 || formatSetpoint(temperature) != "19" {
+		log.Fatalf("getTargetTemperature with whole degree step should be 19, got: %v", temperature)
+	}
+}
+
+func TestParseTimeOfDay(t *testing.T) {
+	valid := map[string]int64{
+		"00:00":    0,
+		"7:30":     27000,
+		"07:30":    27000,
+		"22:15:30": 80130,
+		"23:59:59": 86399,
+		"24:00":    86400,
+		"24:00:00": 86400,
+	}
+	for value, expected := range valid {
+		if result, err := parseTimeOfDay(value); err != nil || result != expected {
+			log.Fatalf("parseTimeOfDay(%q) = %d, %v, expected %d", value, result, err, expected)
+		}
+	}
+
+	for _, value := range []string{"7:3O", "24:30", "25:00", "12:60", "12:00:60", "12", "12:0", "-1:00", "12:00:00:00", ""} {
+		if _, err := parseTimeOfDay(value); err == nil {
+			log.Fatalf("parseTimeOfDay(%q) should fail", value)
+		}
+	}
+}
+
+func TestTimeTableParsingErrors(t *testing.T) {
+	testData := `
+	{
+		"topic": "myhome-kr/livingroom/danfoss-thermo-01",
+		"defaultTemperature": 40,
+		"timeTable": [
+			{"start": "22:00", "end": "06:00", "temperature": 18},
+			{"start": "7:3O", "end": 8, "temperature": "warm"},
+			{"start": "24:00", "end": "24:00", "tmperature": 18},
+			{"start": "12:00", "end": "13:00", "temperature": 2}
+		]
+	}`
+
+	_, err := parseTimeTable(testData)
+	if err == nil {
+		log.Fatal("invalid time table should fail")
+	}
+	for _, expected := range []string{
+		`timeTable[1].start: invalid time "7:3O"`,
+		`timeTable[1].end: expected time of day string`,
+		`timeTable[1].temperature: expected number, got "warm"`,
+		`timeTable[2].start: 24:00 is allowed as end only`,
+		`timeTable[2].temperature: must be set`,
+		`timeTable[2].tmperature: unknown field`,
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			log.Fatalf("error should contain %q, got:\n%v", expected, err)
+		}
+	}
+
+	// setpoint limits of the TRV model
+	scheduler, err := parseTimeTable(`{"topic": "trv", "defaultTemperature": 40, "timeTable": [{"start": "12:00", "end": "13:00", "temperature": 2}]}`)
+	if err != nil {
+		log.Fatal(err)
+	}
+	err = checkScheduler(scheduler, nil)
+	if err == nil || !strings.Contains(err.Error(), "defaultTemperature: temperature 40 is above maximum 35") || !strings.Contains(err.Error(), "timeTable[0].temperature: temperature 2 is below minimum 5") {
+		log.Fatalf("setpoints out of limits should be reported, got: %v", err)
+	}
+}
+
+func TestHalfOpenWrapAwareOverlaps(t *testing.T) {
+	testData := []struct {
+		t1, t2  TimeTable
+		overlap bool
+	}{
+		{TimeTable{Start: 3600 * 6, End: 3600 * 8}, TimeTable{Start: 3600 * 8, End: 3600 * 10}, false},  // adjacent
+		{TimeTable{Start: 3600 * 22, End: 3600 * 6}, TimeTable{Start: 3600 * 5, End: 3600 * 7}, true},   // crosses midnight
+		{TimeTable{Start: 3600 * 22, End: 3600 * 6}, TimeTable{Start: 3600 * 6, End: 3600 * 22}, false}, // complementary
+		{TimeTable{Start: 3600 * 22, End: 3600 * 6}, TimeTable{Start: 3600 * 23, End: 3600 * 1}, true},  // both cross midnight
+		{TimeTable{Start: 0, End: 0}, TimeTable{Start: 3600 * 12, End: 3600 * 13}, true},                // all day
+		{TimeTable{Start: 0, End: secondsPerDay}, TimeTable{Start: 3600 * 12, End: 3600 * 13}, true},    // 00:00 - 24:00
+		{TimeTable{Start: 3600 * 20, End: secondsPerDay}, TimeTable{Start: 0, End: 3600 * 6}, false},    // 20:00 - 24:00, 00:00 - 06:00
+	}
+	for i, tt := range testData {
+		if checksOverlaps(tt.t1, tt.t2) != tt.overlap || checksOverlaps(tt.t2, tt.t1) != tt.overlap {
+			log.Fatalf("checksOverlaps #%d failed, expected overlap: %t", i, tt.overlap)
+		}
+	}
+
+	// end of the interval is exclusive
+	adjacent := TimeTable{Start: 3600 * 6, End: 3600 * 8}
+	if timeTableInInterval(adjacent, time.Date(2023, 2, 4, 8, 0, 0, 0, time.UTC)) || !timeTableInInterval(adjacent, time.Date(2023, 2, 4, 7, 59, 59, 0, time.UTC)) {
+		log.Fatal("timeTableInInterval should be half-open")
+	}
+}
+
+func TestCheckTimeTableOverlapNamesEntries(t *testing.T) {
+	friday, saturday := NewWeekdays(time.Friday), NewWeekdays(time.Saturday)
+	scheduler := TemperatureScheduler{
+		Topic: "trv",
+		TimeTable: []TimeTable{
+			{Start: 3600 * 6, End: 3600 * 8},
+			{Start: 3600 * 8, End: 3600 * 10},
+			{Start: 3600 * 22, End: 3600 * 6, Days: friday},
+			{Start: 3600 * 5, End: 3600 * 6, Days: saturday},
+		},
+	}
+	err := checkTimeTableOverlap(scheduler)
+	if err == nil || err.Error() != "timeTable[2]: 22:00-06:00 overlaps timeTable[3] 05:00-06:00 on sat" {
+		log.Fatalf("checkTimeTableOverlap should report friday night overlapping saturday morning, got: %v", err)
+	}
+
+	scheduler.TimeTable[3].Days = NewWeekdays(time.Sunday)
+	if err := checkTimeTableOverlap(scheduler); err != nil {
+		log.Fatalf("checkTimeTableOverlap shouldn't report entries of different days, got: %v", err)
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+)
+
+// Weekdays is a set of days of the week, empty set means every day
+type Weekdays uint8
+
+const allWeekdays Weekdays = 1<<7 - 1
+
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// days of well known program names, used when the program doesn't list its days
+var programDefaultDays = map[string]Weekdays{
+	"workday":  NewWeekdays(time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday),
+	"workdays": NewWeekdays(time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday),
+	"weekend":  NewWeekdays(time.Saturday, time.Sunday),
+}
+
+func NewWeekdays(days ...time.Weekday) Weekdays {
+	var weekdays Weekdays
+	for _, day := range days {
+		weekdays |= 1 << day
+	}
+	return weekdays
+}
+
+// Check if the set contains the day, empty set contains every day
+func (w Weekdays) Contains(day time.Weekday) bool {
+	return w == 0 || w&(1<<day) != 0
+}
+
+// Get days of the set, empty set means every day
+func (w Weekdays) Days() Weekdays {
+	if w == 0 {
+		return allWeekdays
+	}
+	return w
+}
+
+func (w Weekdays) String() string {
+	if w == 0 {
+		return "every day"
+	}
+	var names []string
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if w&(1<<day) != 0 {
+			names = append(names, strings.ToLower(day.String()[:3]))
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// parse list of day names, eg. ["mon", "tuesday"]
+func (w *Weekdays) UnmarshalJSON(data []byte) error {
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return fmt.Errorf("expected list of day names, eg. [mon, tue]: %w", err)
+	}
+	*w = 0
+	for _, name := range names {
+		day, exist := weekdayNames[strings.ToLower(strings.TrimSpace(name))]
+		if !exist {
+			return fmt.Errorf("unknown day %q", name)
+		}
+		*w |= 1 << day
+	}
+	return nil
+}
+
+func (w Weekdays) MarshalJSON() ([]byte, error) {
+	names := []string{}
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if w&(1<<day) != 0 {
+			names = append(names, strings.ToLower(day.String()[:3]))
+		}
+	}
+	return json.Marshal(names)
+}
+
+// DayProgram is a named time table applied on days of the week, eg. workday or weekend
+type DayProgram struct {
+	Days      Weekdays    `json:"days,omitempty"` // well known names (workday, weekend, day names) have default days
+	TimeTable []TimeTable `json:"timeTable"`
+}
+
+// Get days of the program, days of well known program names are used when not set
+func programDays(name string, program DayProgram) Weekdays {
+	if program.Days != 0 {
+		return program.Days
+	}
+	if days, exist := programDefaultDays[strings.ToLower(name)]; exist {
+		return days
+	}
+	if day, exist := weekdayNames[strings.ToLower(name)]; exist {
+		return NewWeekdays(day)
+	}
+	return 0
+}
+
+// Resolve days of the scheduler programs, program with fewer days wins the shared days,
+// eg. friday takes friday from workday
+func resolveProgramDays(programs map[string]DayProgram) map[string]Weekdays {
+	names := make([]string, 0, len(programs))
+	for name := range programs {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return countDays(programDays(names[i], programs[names[i]])) < countDays(programDays(names[j], programs[names[j]]))
+	})
+
+	resolved := map[string]Weekdays{}
+	var taken Weekdays
+	for _, name := range names {
+		days := programDays(name, programs[name])
+		resolved[name] = days &^ taken
+		taken |= days
+	}
+	return resolved
+}
+
+func countDays(w Weekdays) int {
+	count := 0
+	for ; w != 0; w &= w - 1 {
+		count++
+	}
+	return count
+}
+
+// scheduleEntry is a time table entry with its path in the scheduler, eg. programs.workday.timeTable[1]
+type scheduleEntry struct {
+	Path string
+	TimeTable
+}
+
+// Get time table entries of the scheduler, program entries (with days of the program) precede every day entries
+func getScheduleEntries(scheduler TemperatureScheduler) []scheduleEntry {
+	var entries []scheduleEntry
+	programNames := make([]string, 0, len(scheduler.Programs))
+	for name := range scheduler.Programs {
+		programNames = append(programNames, name)
+	}
+	sort.Strings(programNames)
+	resolved := resolveProgramDays(scheduler.Programs)
+	for _, name := range programNames {
+		days := resolved[name]
+		if days == 0 {
+			continue
+		}
+		for i, timeTable := range scheduler.Programs[name].TimeTable {
+			timeTable.Days = timeTable.Days.Days() & days
+			if timeTable.Days != 0 {
+				entries = append(entries, scheduleEntry{Path: fmt.Sprintf("programs.%s.timeTable[%d]", name, i), TimeTable: timeTable})
+			}
+		}
+	}
+	for i, timeTable := range scheduler.TimeTable {
+		entries = append(entries, scheduleEntry{Path: fmt.Sprintf("timeTable[%d]", i), TimeTable: timeTable})
+	}
+	return entries
+}
+
+// Get time table entries of the scheduler, program entries (with days of the program) precede every day entries
+func schedulerEntries(scheduler TemperatureScheduler) []TimeTable {
+	if len(scheduler.Programs) == 0 {
+		return scheduler.TimeTable
+	}
+
+	var entries []TimeTable
+	for _, entry := range getScheduleEntries(scheduler) {
+		entries = append(entries, entry.TimeTable)
+	}
+	return entries
+}
+
+// Get day the interval active at given time started, intervals crossing midnight belong to the day they started
+func intervalStartDay(timeTable TimeTable, t time.Time) time.Weekday {
+	if start, end := timeTableSpan(timeTable); end > secondsPerDay && getSecondsOfDay(t) < start {
+		return (t.Weekday() + 6) % 7
+	}
+	return t.Weekday()
+}
+
+// Check if time table is active at given time, including its days
+func timeTableActive(timeTable TimeTable, t time.Time) bool {
+	_, active := activeTimeTable(timeTable, t)
+	return active
+}
+
+// Get time table active at given time, solar times are resolved for the day the interval started
+func activeTimeTable(timeTable TimeTable, t time.Time) (TimeTable, bool) {
+	if !timeTable.solar() {
+		return timeTable, timeTableInInterval(timeTable, t) && timeTable.Days.Contains(intervalStartDay(timeTable, t))
+	}
+	seconds := getSecondsOfDay(t)
+	// interval started today, or yesterday and continues after midnight
+	for days := int64(0); days < 2; days++ {
+		day := t.AddDate(0, 0, -int(days))
+		if !timeTable.Days.Contains(day.Weekday()) {
+			continue
+		}
+		resolved, ok := resolveSolarTimeTable(timeTable, day)
+		if !ok {
+			continue
+		}
+		if start, end := timeTableSpan(resolved); seconds+days*secondsPerDay >= start && seconds+days*secondsPerDay < end {
+			return resolved, true
+		}
+	}
+	return TimeTable{}, false
+}
+
+func (p *DayProgram) Validate() error {
+	if len(p.TimeTable) == 0 {
+		return config.FieldErr("timeTable", fmt.Errorf("must not be empty"))
+	}
+	return nil
+}
+
+// Validate days of the scheduler programs
+func validatePrograms(programs map[string]DayProgram) error {
+	var errs config.Errors
+	names := make([]string, 0, len(programs))
+	for name := range programs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		days := programDays(name, programs[name])
+		if days == 0 {
+			errs.Append(config.FieldErr(fmt.Sprintf("programs.%s.days", name), fmt.Errorf("must be set for program %s", name)))
+			continue
+		}
+		for _, other := range names[:i] {
+			otherDays := programDays(other, programs[other])
+			if countDays(days) == countDays(otherDays) && days&otherDays != 0 {
+				errs.Append(config.FieldErr(fmt.Sprintf("programs.%s.days", name), fmt.Errorf("program %s shares %s with program %s", name, days&otherDays, other)))
+			}
+		}
+	}
+	return errs.Err()
+}
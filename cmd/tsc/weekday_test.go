@@ -0,0 +1,102 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+)
+
+func TestWeekdaysSchedule(t *testing.T) {
+	testData := `
+	{
+		"topic": "myhome-kr/livingroom/danfoss-thermo-01",
+		"defaultTemperature": 22,
+		"timeTable": [
+			{"start": "12:00", "end": "13:00", "temperature": 23, "days": ["wed"]}
+		],
+		"programs": {
+			"workday": {
+				"timeTable": [{"start": "22:00", "end": "06:00", "temperature": 18}]
+			},
+			"friday": {
+				"timeTable": [{"start": "23:30", "end": "08:00", "temperature": 19}]
+			},
+			"weekend": {
+				"timeTable": [{"start": "23:30", "end": "09:00", "temperature": 17}]
+			}
+		}
+	}`
+	scheduler, err := parseTimeTable(testData)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := checkTimeTableOverlap(scheduler); err != nil {
+		log.Fatalf("programs of different days shouldn't overlap: %v", err)
+	}
+
+	// 2023-02-03 is friday
+	testTimesWithExpected := map[time.Time]float64{
+		time.Date(2023, 2, 1, 12, 30, 0, 0, time.UTC): 23, // wednesday entry
+		time.Date(2023, 2, 2, 12, 30, 0, 0, time.UTC): 22, // thursday, wednesday entry doesn't apply
+		time.Date(2023, 2, 2, 22, 30, 0, 0, time.UTC): 18, // thursday workday program
+		time.Date(2023, 2, 3, 5, 0, 0, 0, time.UTC):   18, // thursday night continues on friday
+		time.Date(2023, 2, 3, 7, 0, 0, 0, time.UTC):   22,
+		time.Date(2023, 2, 3, 22, 30, 0, 0, time.UTC): 22, // friday program takes friday from workday
+		time.Date(2023, 2, 3, 23, 45, 0, 0, time.UTC): 19,
+		time.Date(2023, 2, 4, 7, 30, 0, 0, time.UTC):  19, // friday night belongs to friday program
+		time.Date(2023, 2, 4, 8, 30, 0, 0, time.UTC):  22,
+		time.Date(2023, 2, 5, 8, 30, 0, 0, time.UTC):  17, // saturday night belongs to weekend program
+		time.Date(2023, 2, 6, 8, 30, 0, 0, time.UTC):  17, // sunday night belongs to weekend program on monday too
+		time.Date(2023, 2, 6, 9, 30, 0, 0, time.UTC):  22,
+	}
+	for testTime, expected := range testTimesWithExpected {
+		if result := getTemperatureAtTime(scheduler, testTime); result != expected {
+			log.Fatalf("getTemperatureAtTime(%s) failed, expected: %v, got: %v", testTime.Format("Mon 15:04"), expected, result)
+		}
+	}
+}
+
+func TestResolveProgramDays(t *testing.T) {
+	resolved := resolveProgramDays(map[string]DayProgram{
+		"workday": {},
+		"friday":  {},
+		"custom":  {Days: NewWeekdays(time.Saturday, time.Sunday, time.Monday)},
+	})
+	// program with fewer days wins
+	if resolved["workday"] != NewWeekdays(time.Tuesday, time.Wednesday, time.Thursday) ||
+		resolved["friday"] != NewWeekdays(time.Friday) || resolved["custom"] != NewWeekdays(time.Saturday, time.Sunday, time.Monday) {
+		log.Fatalf("resolveProgramDays failed: %v", resolved)
+	}
+}
+
+func TestProgramsValidation(t *testing.T) {
+	testData := `
+	{
+		"topic": "trv",
+		"defaultTemperature": 22,
+		"timeTable": [],
+		"programs": {
+			"night": {"timeTable": [{"start": "22:00", "end": "06:00", "temperature": 18}]},
+			"weekend": {"timeTable": [{"start": "22:00", "end": "06:00", "temperature": 18}]},
+			"holiday": {"days": ["sat", "sun"], "timeTable": [{"start": "22:00", "end": "06:00", "temperature": 18}]},
+			"empty": {"days": ["mon"], "timeTable": []}
+		}
+	}`
+	var scheduler TemperatureScheduler
+	err := config.DecodeJSON([]byte(testData), &scheduler)
+	if err == nil {
+		log.Fatalf("invalid programs should fail, got %v", scheduler)
+	}
+	for _, expected := range []string{"programs.night.days", "programs.weekend.days: program weekend shares sun,sat with program holiday", "programs.empty.timeTable"} {
+		if !strings.Contains(err.Error(), expected) {
+			log.Fatalf("error should contain %q, got: %v", expected, err)
+		}
+	}
+
+	if err := config.DecodeJSON([]byte(`{"topic": "trv", "defaultTemperature": 22, "timeTable": [{"start": "22:00", "end": "06:00", "temperature": 18, "days": ["someday"]}]}`), &scheduler); err == nil {
+		log.Fatal("unknown day should fail")
+	}
+}
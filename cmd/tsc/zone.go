@@ -0,0 +1,203 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// trvStatus is read back of the setpoint of a zone member
+type trvStatus struct {
+	Topic               string   `json:"topic"`
+	ReportedTemperature *float64 `json:"reportedTemperature,omitempty"` // setpoint reported by the TRV
+	Confirmed           *bool    `json:"confirmed,omitempty"`           // TRV reports the published setpoint
+}
+
+// key: scheduler topic, room temperature source (sensor or TRV topic), guarded by optimumMu
+var zoneTemperatures = map[string]map[string]temperatureReading{}
+
+// Get TRV topics controlled by the scheduler, members of the zone or the scheduler topic itself
+func (s TemperatureScheduler) trvTopics() []string {
+	if len(s.Trvs) > 0 {
+		return s.Trvs
+	}
+	return []string{s.Topic}
+}
+
+// Get room temperature sensor topics of the scheduler
+func (s TemperatureScheduler) sensorTopics() []string {
+	var topics []string
+	if s.SensorTopic != "" {
+		topics = append(topics, s.SensorTopic)
+	}
+	return append(topics, s.SensorTopics...)
+}
+
+// Check if the scheduler is a zone of several TRVs
+func (s TemperatureScheduler) zone() bool {
+	return len(s.Trvs) > 0
+}
+
+// Check zone members of the scheduler
+func checkZone(scheduler TemperatureScheduler) error {
+	var errs config.Errors
+	members := map[string]int{}
+	for i, trv := range scheduler.Trvs {
+		path := fmt.Sprintf("trvs[%d]", i)
+		if first, exist := members[trv]; exist {
+			errs.Append(config.FieldErr(path, fmt.Errorf("TRV %s is already a member as trvs[%d]", trv, first)))
+			continue
+		}
+		members[trv] = i
+		errs.Append(config.MustNotBeEmpty(path, trv))
+	}
+	if scheduler.GroupTopic != "" && !scheduler.zone() {
+		errs.Append(config.FieldErr("groupTopic", errors.New("requires trvs of the zone")))
+	}
+	for i, sensor := range scheduler.SensorTopics {
+		errs.Append(config.MustNotBeEmpty(fmt.Sprintf("sensorTopics[%d]", i), sensor))
+	}
+	return errs.Err()
+}
+
+// Check every TRV is controlled by one scheduler only, duplicate scheduler topics are reported by the caller
+//
+//	out: config.Errors with paths relative to the schedulers, eg. [1].trvs[0]: TRV x is already scheduled by schedulers[0]
+func checkZoneMembers(schedulers schedulersConfigs) error {
+	var errs config.Errors
+	owners := map[string]int{}
+	for i, scheduler := range schedulers {
+		for j, trv := range scheduler.trvTopics() {
+			first, exist := owners[trv]
+			switch {
+			case !exist:
+				owners[trv] = i
+			case scheduler.zone():
+				errs.Append(config.FieldErr(fmt.Sprintf("[%d].trvs[%d]", i, j), fmt.Errorf("TRV %s is already scheduled by schedulers[%d]", trv, first)))
+			case schedulers[first].zone():
+				errs.Append(config.FieldErr(fmt.Sprintf("[%d].topic", i), fmt.Errorf("TRV %s is already scheduled by schedulers[%d]", trv, first)))
+			}
+		}
+	}
+	return errs.Err()
+}
+
+// Check if schedulers control the same TRVs and read the same sensors
+func sameMembers(s1 TemperatureScheduler, s2 TemperatureScheduler) bool {
+	return strings.Join(s1.trvTopics(), "\n") == strings.Join(s2.trvTopics(), "\n") &&
+		strings.Join(s1.sensorTopics(), "\n") == strings.Join(s2.sensorTopics(), "\n")
+}
+
+// Get scheduler controlling the TRV
+func getTrvScheduler(topic string) (TemperatureScheduler, bool) {
+	for _, scheduler := range getSchedulers() {
+		for _, trv := range scheduler.trvTopics() {
+			if trv == topic {
+				return scheduler, true
+			}
+		}
+	}
+	return TemperatureScheduler{}, false
+}
+
+// Publish setpoint to TRVs of the scheduler and ask them to read it back, all members of the zone with group topic
+// are set by a single publish to the group
+//
+//	in: trvs - TRV topics to set; retry - publish is a retry of unconfirmed setpoint
+//	out: bool - true if the setpoint was published to any of the TRVs
+func publishSetpoint(client MQTT.Client, scheduler TemperatureScheduler, trvs []string, temperature float64, now time.Time, retry bool) bool {
+	targets := trvs
+	if scheduler.GroupTopic != "" && len(trvs) == len(scheduler.trvTopics()) {
+		targets = []string{scheduler.GroupTopic}
+	}
+	published := false
+	for _, target := range targets {
+		heatingSetpointTopic := heatingSetpointTopic(target)
+		log.Printf("Updating %s to %s°C", heatingSetpointTopic, formatSetpoint(temperature))
+		if token := client.Publish(heatingSetpointTopic, 0, false, formatSetpoint(temperature)); token.Wait() && token.Error() != nil {
+			log.Printf("Error publishing to topic %s: %v", heatingSetpointTopic, token.Error())
+			publishCounter.Inc(scheduler.Topic, resultFailure)
+			continue
+		}
+		publishCounter.Inc(scheduler.Topic, resultSuccess)
+		log.Printf("Published temperature %s°C to topic %s", formatSetpoint(temperature), heatingSetpointTopic)
+		published = true
+		if target == scheduler.GroupTopic {
+			for _, trv := range trvs {
+				expectSetpoint(trv, temperature, now, retry)
+				requestSetpointReadBack(client, trv)
+			}
+		} else {
+			expectSetpoint(target, temperature, now, retry)
+			requestSetpointReadBack(client, target)
+		}
+	}
+	return published
+}
+
+// Get TRVs of the scheduler that didn't confirm the published setpoint in time
+func getUnconfirmedTrvs(scheduler TemperatureScheduler, now time.Time) []string {
+	var trvs []string
+	for _, trv := range scheduler.trvTopics() {
+		if setpointRetryNeeded(trv, now) {
+			trvs = append(trvs, trv)
+		}
+	}
+	return trvs
+}
+
+// Get setpoint read back of the zone members
+func getTrvsStatus(scheduler TemperatureScheduler) []trvStatus {
+	var trvs []trvStatus
+	for _, trv := range scheduler.trvTopics() {
+		status := trvStatus{Topic: trv}
+		status.ReportedTemperature, status.Confirmed = getReportedSetpoint(trv)
+		trvs = append(trvs, status)
+	}
+	return trvs
+}
+
+// Record room temperature of the source, temperature of the room is the mean of the sources not older than their limit
+//
+//	in: source - sensor or TRV topic
+func recordZoneTemperature(scheduler TemperatureScheduler, source string, temperature float64, now time.Time) {
+	optimumMu.Lock()
+	readings, exist := zoneTemperatures[scheduler.Topic]
+	if !exist {
+		readings = map[string]temperatureReading{}
+		zoneTemperatures[scheduler.Topic] = readings
+	}
+	readings[source] = temperatureReading{temperature: temperature, time: now}
+	sources := make([]string, 0, len(readings))
+	for current := range readings {
+		sources = append(sources, current)
+	}
+	sort.Strings(sources)
+	sum, count := 0.0, 0
+	for _, current := range sources {
+		if reading := readings[current]; now.Sub(reading.time) <= maxRoomReadingAge {
+			sum += reading.temperature
+			count++
+		}
+	}
+	optimumMu.Unlock()
+	recordRoomTemperature(scheduler.Topic, sum/float64(count), now)
+}
+
+// Forget read back state and room temperatures of the removed scheduler and its TRVs
+func forgetZone(scheduler TemperatureScheduler) {
+	for _, trv := range scheduler.trvTopics() {
+		forgetConfirmation(trv)
+		forgetObservedSetpoint(trv)
+	}
+	optimumMu.Lock()
+	delete(zoneTemperatures, scheduler.Topic)
+	optimumMu.Unlock()
+}
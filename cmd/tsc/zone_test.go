@@ -0,0 +1,179 @@
+package main
+
+import (
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/mqtttest"
+	"github.com/jacfal.io/homeaut/pkg/store"
+)
+
+func TestCheckZone(t *testing.T) {
+	if err := checkZone(TemperatureScheduler{Topic: "livingroom", Trvs: []string{"trv-1", "trv-2"}, GroupTopic: "livingroom-trvs"}); err != nil {
+		log.Fatalf("zone should be valid: %v", err)
+	}
+	err := checkZone(TemperatureScheduler{Topic: "livingroom", Trvs: []string{"trv-1", "", "trv-1"}, SensorTopics: []string{""}})
+	if err == nil || !strings.Contains(err.Error(), "trvs[1]: must not be empty") || !strings.Contains(err.Error(), "trvs[2]: TRV trv-1 is already a member as trvs[0]") ||
+		!strings.Contains(err.Error(), "sensorTopics[0]: must not be empty") {
+		log.Fatalf("invalid members should be reported, got: %v", err)
+	}
+	if err := checkZone(TemperatureScheduler{Topic: "trv", GroupTopic: "group"}); err == nil || !strings.Contains(err.Error(), "groupTopic: requires trvs of the zone") {
+		log.Fatalf("group without members should be reported, got: %v", err)
+	}
+
+	err = checkZoneMembers(schedulersConfigs{{Topic: "trv-1"}, {Topic: "livingroom", Trvs: []string{"trv-2", "trv-1"}}, {Topic: "trv-2"}})
+	if err == nil || !strings.Contains(err.Error(), "[1].trvs[1]: TRV trv-1 is already scheduled by schedulers[0]") ||
+		!strings.Contains(err.Error(), "[2].topic: TRV trv-2 is already scheduled by schedulers[1]") {
+		log.Fatalf("TRVs of several schedulers should be reported, got: %v", err)
+	}
+}
+
+// set zone schedulers for the test
+func setZoneSchedulers(schedulers schedulersConfigs) func() {
+	mu.Lock()
+	previousSchedulers := temperatureSchedulers
+	temperatureSchedulers = schedulers
+	mu.Unlock()
+	return func() {
+		mu.Lock()
+		temperatureSchedulers = previousSchedulers
+		for _, scheduler := range schedulers {
+			delete(lastTemperatures, scheduler.Topic)
+		}
+		mu.Unlock()
+		for _, scheduler := range schedulers {
+			forgetZone(scheduler)
+			forgetOverride(scheduler.Topic)
+			forgetHold(scheduler.Topic)
+			forgetOptimumStart(scheduler.Topic)
+			stateStore.Update(func(state *store.State) bool {
+				delete(state.Setpoints, scheduler.Topic)
+				return true
+			})
+		}
+	}
+}
+
+func TestZoneFanOut(t *testing.T) {
+	zone := TemperatureScheduler{Topic: "myhome/livingroom", DefaultTemperature: 21, Trvs: []string{"trv-1", "trv-2", "trv-3"},
+		TimeTable: []TimeTable{{Start: 79200, End: 21600, Temperature: 18}}}
+	defer setZoneSchedulers(schedulersConfigs{zone})()
+
+	client := mqtttest.NewClient()
+	now := time.Date(2023, 2, 4, 21, 50, 0, 0, time.Local)
+	updateScheduler(client, zone, now, true)
+	for _, trv := range zone.Trvs {
+		if published := client.PublishedTo(heatingSetpointTopic(trv)); len(published) != 1 || published[0] != "21" {
+			log.Fatalf("setpoint should be published to %s: %v", trv, published)
+		}
+		if requested := client.PublishedTo(trv + "/get"); len(requested) != 1 {
+			log.Fatalf("read back should be requested from %s: %v", trv, requested)
+		}
+	}
+	if published := client.PublishedTo(schedulerStatusTopic(zone.Topic)); len(published) != 1 {
+		log.Fatalf("one status should be published for the zone: %v", published)
+	}
+
+	// only TRVs that didn't confirm are set again
+	subscribeSchedulers(client, schedulersConfigs{zone})
+	client.Deliver("trv-2", `{"occupied_heating_setpoint_scheduled": 21, "local_temperature": 19}`)
+	client.Reset()
+	updateScheduler(client, zone, now.Add(*confirmTimeout), false)
+	if published := client.PublishedTo(heatingSetpointTopic("trv-2")); len(published) != 0 {
+		log.Fatalf("confirmed setpoint shouldn't be published again: %v", published)
+	}
+	if published := client.PublishedTo(heatingSetpointTopic("trv-3")); len(published) != 1 {
+		log.Fatalf("unconfirmed setpoint should be published again: %v", published)
+	}
+	status := getSchedulerStatus(zone, now)
+	if len(status.Trvs) != 3 || status.Trvs[1].Confirmed == nil || !*status.Trvs[1].Confirmed || status.Trvs[0].Confirmed != nil || status.Confirmed != nil {
+		log.Fatalf("status should show read back of the members: %+v", status.Trvs)
+	}
+
+	// the next slot is set on all members
+	client.Reset()
+	updateScheduler(client, zone, now.Add(10*time.Minute), false)
+	for _, trv := range zone.Trvs {
+		if published := client.PublishedTo(heatingSetpointTopic(trv)); len(published) != 1 || published[0] != "18" {
+			log.Fatalf("the next slot should be published to %s: %v", trv, published)
+		}
+	}
+
+	// manual change of a member holds the zone
+	client.Deliver("trv-3", `{"occupied_heating_setpoint": 18, "setpoint_change_source": "externally"}`)
+	client.Reset()
+	client.Deliver("trv-3", `{"occupied_heating_setpoint": 23, "setpoint_change_source": "manual"}`)
+	if _, active := getActiveHold(zone.Topic, time.Now()); !active {
+		log.Fatal("manual setpoint of a member should hold the zone")
+	}
+	for _, trv := range zone.Trvs {
+		if published := client.PublishedTo(heatingSetpointTopic(trv)); len(published) != 1 || published[0] != "23" {
+			log.Fatalf("held setpoint should be published to %s: %v", trv, published)
+		}
+	}
+}
+
+func TestZoneGroupPublish(t *testing.T) {
+	zone := TemperatureScheduler{Topic: "myhome/bedroom", DefaultTemperature: 20, Trvs: []string{"trv-4", "trv-5"}, GroupTopic: "zigbee2mqtt/bedroom"}
+	defer setZoneSchedulers(schedulersConfigs{zone})()
+
+	client := mqtttest.NewClient()
+	now := time.Date(2023, 2, 4, 12, 0, 0, 0, time.Local)
+	updateScheduler(client, zone, now, true)
+	if published := client.PublishedTo(heatingSetpointTopic(zone.GroupTopic)); len(published) != 1 || published[0] != "20" {
+		log.Fatalf("setpoint should be published to the group: %v", published)
+	}
+	for _, trv := range zone.Trvs {
+		if published := client.PublishedTo(heatingSetpointTopic(trv)); len(published) != 0 {
+			log.Fatalf("members shouldn't be set one by one: %v", published)
+		}
+		if requested := client.PublishedTo(trv + "/get"); len(requested) != 1 {
+			log.Fatalf("read back should be requested from %s: %v", trv, requested)
+		}
+	}
+
+	// override of the zone is published to the group, unconfirmed member is retried directly
+	client.Reset()
+	applyOverrideCommand(client, zone.Topic, []byte(`{"temperature": 23, "duration": "1h"}`), now)
+	if published := client.PublishedTo(heatingSetpointTopic(zone.GroupTopic)); len(published) != 1 || published[0] != "23" {
+		log.Fatalf("override should be published to the group: %v", published)
+	}
+	recordReportedSetpoint("trv-4", []byte(`{"occupied_heating_setpoint_scheduled": 23}`), now)
+	client.Reset()
+	updateScheduler(client, zone, now.Add(*confirmTimeout), false)
+	if published := client.PublishedTo(heatingSetpointTopic("trv-5")); len(published) != 1 || published[0] != "23" {
+		log.Fatalf("unconfirmed member should be set directly: %v", published)
+	}
+	if published := client.PublishedTo(heatingSetpointTopic(zone.GroupTopic)); len(published) != 0 {
+		log.Fatalf("retry shouldn't be published to the group: %v", published)
+	}
+}
+
+func TestZoneRoomTemperature(t *testing.T) {
+	zone := TemperatureScheduler{Topic: "myhome/kitchen", DefaultTemperature: 20, Trvs: []string{"trv-6", "trv-7"},
+		SensorTopic: "sensor-1", SensorTopics: []string{"sensor-2"}}
+	members := TemperatureScheduler{Topic: "myhome/hall", DefaultTemperature: 20, Trvs: []string{"trv-8", "trv-9"}}
+	defer setZoneSchedulers(schedulersConfigs{zone, members})()
+
+	client := mqtttest.NewClient()
+	subscribeSchedulers(client, schedulersConfigs{zone, members})
+	client.Deliver("sensor-1", `{"temperature": 20}`)
+	client.Deliver("sensor-2", `{"temperature": 21}`)
+	client.Deliver("trv-6", `{"local_temperature": 25}`)
+	client.Deliver("trv-8", `{"local_temperature": 18}`)
+	client.Deliver("trv-9", `{"local_temperature": 19}`)
+
+	now := time.Now()
+	optimumMu.Lock()
+	room, _ := getReadings(zone.Topic, now)
+	hall, _ := getReadings(members.Topic, now)
+	optimumMu.Unlock()
+	if room == nil || *room != 20.5 {
+		log.Fatalf("room temperature should be the mean of the sensors, got %v", room)
+	}
+	if hall == nil || *hall != 18.5 {
+		log.Fatalf("room temperature without sensors should be the mean of the members, got %v", hall)
+	}
+}
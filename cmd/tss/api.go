@@ -0,0 +1,239 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/utils"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+const pairsAPIPath = "/api/pairs"
+
+// serializes pair changes made by the API and configuration reload
+var pairsChangeMu sync.Mutex
+
+// pairResource is a Sensor --> TRV pair returned by the API
+type pairResource struct {
+	Config SensorTrvSync `json:"config"`
+	Status pairStatus    `json:"status"`
+}
+
+// pairsAPI manages Sensor --> TRV pairs at runtime
+//
+//	GET    /api/pairs                  list pairs
+//	POST   /api/pairs                  create pair
+//	GET    /api/pairs/<sensor-topic>   get pair
+//	PUT    /api/pairs/<sensor-topic>   update pair
+//	DELETE /api/pairs/<sensor-topic>   delete pair
+type pairsAPI struct {
+	client  MQTT.Client
+	persist bool // write changes back to the configuration file
+}
+
+func (api *pairsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sensorTopic, err := url.PathUnescape(strings.Trim(strings.TrimPrefix(r.URL.EscapedPath(), pairsAPIPath), "/"))
+	if err != nil {
+		utils.WriteError(w, utils.NewAPIError(http.StatusBadRequest, "invalid sensor topic"))
+		return
+	}
+
+	switch {
+	case sensorTopic == "" && r.Method == http.MethodGet:
+		utils.WriteJSON(w, http.StatusOK, listPairs())
+	case sensorTopic == "" && r.Method == http.MethodPost:
+		api.createPair(w, r)
+	case sensorTopic != "" && r.Method == http.MethodGet:
+		pair, exist := getPair(sensorTopic)
+		if !exist {
+			utils.WriteError(w, utils.NewAPIError(http.StatusNotFound, fmt.Sprintf("pair of sensor %s not found", sensorTopic)))
+			return
+		}
+		utils.WriteJSON(w, http.StatusOK, pair)
+	case sensorTopic != "" && r.Method == http.MethodPut:
+		api.updatePair(w, r, sensorTopic)
+	case sensorTopic != "" && r.Method == http.MethodDelete:
+		api.deletePair(w, sensorTopic)
+	default:
+		utils.WriteError(w, utils.NewAPIError(http.StatusMethodNotAllowed, fmt.Sprintf("method %s not allowed", r.Method)))
+	}
+}
+
+func (api *pairsAPI) createPair(w http.ResponseWriter, r *http.Request) {
+	syncConfig, err := readSyncConfig(r.Body)
+	if err != nil {
+		utils.WriteError(w, err)
+		return
+	}
+
+	err = api.changePairs(func(current SyncConfigs) (SyncConfigs, error) {
+		for _, existing := range current {
+			if existing.SensorTopic == syncConfig.SensorTopic {
+				return nil, utils.NewAPIError(http.StatusConflict, fmt.Sprintf("sensor %s is already paired", syncConfig.SensorTopic))
+			}
+		}
+		return append(current, syncConfig), nil
+	})
+	if err != nil {
+		utils.WriteError(w, err)
+		return
+	}
+	pair, _ := getPair(syncConfig.SensorTopic)
+	utils.WriteJSON(w, http.StatusCreated, pair)
+}
+
+func (api *pairsAPI) updatePair(w http.ResponseWriter, r *http.Request, sensorTopic string) {
+	syncConfig, err := readSyncConfig(r.Body)
+	if err != nil {
+		utils.WriteError(w, err)
+		return
+	} else if syncConfig.SensorTopic != sensorTopic {
+		utils.WriteError(w, utils.NewAPIError(http.StatusBadRequest, "sensor-topic can't be changed, delete the pair and create a new one"))
+		return
+	}
+
+	err = api.changePairs(func(current SyncConfigs) (SyncConfigs, error) {
+		for i, existing := range current {
+			if existing.SensorTopic == sensorTopic {
+				current[i] = syncConfig
+				return current, nil
+			}
+		}
+		return nil, utils.NewAPIError(http.StatusNotFound, fmt.Sprintf("pair of sensor %s not found", sensorTopic))
+	})
+	if err != nil {
+		utils.WriteError(w, err)
+		return
+	}
+	pair, _ := getPair(sensorTopic)
+	utils.WriteJSON(w, http.StatusOK, pair)
+}
+
+func (api *pairsAPI) deletePair(w http.ResponseWriter, sensorTopic string) {
+	err := api.changePairs(func(current SyncConfigs) (SyncConfigs, error) {
+		for i, existing := range current {
+			if existing.SensorTopic == sensorTopic {
+				return append(current[:i], current[i+1:]...), nil
+			}
+		}
+		return nil, utils.NewAPIError(http.StatusNotFound, fmt.Sprintf("pair of sensor %s not found", sensorTopic))
+	})
+	if err != nil {
+		utils.WriteError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Change configured pairs and apply them to the running synchronizer
+func (api *pairsAPI) changePairs(change func(current SyncConfigs) (SyncConfigs, error)) error {
+	pairsChangeMu.Lock()
+	defer pairsChangeMu.Unlock()
+
+	mu.Lock()
+	desired, err := change(append(SyncConfigs{}, syncs...))
+	if err == nil {
+		syncs = desired
+	}
+	mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	applyPairs(api.client, desired)
+	if api.persist {
+		if err := persistPairs(desired); err != nil {
+			log.Printf("Error! Can't persist pairs to the configuration file: %v", err)
+			return utils.NewAPIError(http.StatusInternalServerError, fmt.Sprintf("pairs applied, but not persisted: %v", err))
+		}
+	}
+	return nil
+}
+
+// Write pairs to the configuration file, other settings of the file are kept, comments and order of the keys are not
+//
+// Pairs of the command line (--sync) not changed by the API aren't written, the file keeps its own pair of the sensor.
+func persistPairs(pairs SyncConfigs) error {
+	if *configFile == "" {
+		return errors.New("configuration file not set")
+	}
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	cfg.Tss.Pairs = filePairs(pairs, cfg.Tss.Pairs, syncArgs)
+	log.Printf("Persisting pairs to the configuration file %s", *configFile)
+	return config.Save(*configFile, cfg)
+}
+
+// Get pairs to write to the configuration file, unchanged pairs of the command line are replaced by the pairs of
+// the file or dropped
+//
+//	in: pairs - running pairs; configured - pairs of the file; args - pairs of the command line
+func filePairs(pairs SyncConfigs, configured SyncConfigs, args SyncConfigs) SyncConfigs {
+	find := func(syncConfigs SyncConfigs, sensorTopic string) (SensorTrvSync, bool) {
+		for _, syncConfig := range syncConfigs {
+			if syncConfig.SensorTopic == sensorTopic {
+				return syncConfig, true
+			}
+		}
+		return SensorTrvSync{}, false
+	}
+
+	persisted := SyncConfigs{}
+	for _, pair := range pairs {
+		if arg, exist := find(args, pair.SensorTopic); exist && arg == pair {
+			if configuredPair, exist := find(configured, pair.SensorTopic); exist {
+				persisted = append(persisted, configuredPair)
+			}
+			continue
+		}
+		persisted = append(persisted, pair)
+	}
+	return persisted
+}
+
+// Get pairs with their status
+func listPairs() []pairResource {
+	mu.Lock()
+	defer mu.Unlock()
+
+	pairs := []pairResource{}
+	for _, syncConfig := range syncs {
+		if _, running := sensorSyncs[syncConfig.SensorTopic]; running {
+			pairs = append(pairs, pairResource{Config: syncConfig, Status: getPairStatus(syncConfig.SensorTopic)})
+		}
+	}
+	return pairs
+}
+
+func getPair(sensorTopic string) (pairResource, bool) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	syncConfig, exist := sensorSyncs[sensorTopic]
+	if !exist {
+		return pairResource{}, false
+	}
+	return pairResource{Config: syncConfig, Status: getPairStatus(sensorTopic)}, true
+}
+
+func readSyncConfig(body io.Reader) (SensorTrvSync, error) {
+	data, err := io.ReadAll(io.LimitReader(body, 1<<20))
+	if err != nil {
+		return SensorTrvSync{}, utils.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	var syncConfig SensorTrvSync
+	if err := config.DecodeJSON(data, &syncConfig); err != nil {
+		return SensorTrvSync{}, utils.NewAPIError(http.StatusBadRequest, err.Error())
+	}
+	return syncConfig, nil
+}
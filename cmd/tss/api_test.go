@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jacfal.io/homeaut/pkg/mqtttest"
+)
+
+func TestPairsAPI(t *testing.T) {
+	dir := t.TempDir()
+	previousConfigFile, previousSyncs := *configFile, syncs
+	*configFile = filepath.Join(dir, "config.yaml")
+	defer func() { *configFile, syncs = previousConfigFile, previousSyncs }()
+	if err := os.WriteFile(*configFile, []byte("broker:\n  url: tcp://localhost:1883\ntss:\n  cron: '*/5 * * * *'\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	syncs = SyncConfigs{}
+
+	client := mqtttest.NewClient()
+	api := &pairsAPI{client: client, persist: true}
+	request := func(method string, path string, body string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		api.ServeHTTP(recorder, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return recorder
+	}
+
+	tests := []struct {
+		method string
+		path   string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/api/pairs", `{"sensor-topic": "api/sensor", "trv-topic": "api/trv"}`, http.StatusCreated},
+		{http.MethodPost, "/api/pairs", `{"sensor-topic": "api/sensor", "trv-topic": "api/trv2"}`, http.StatusConflict},
+		{http.MethodPost, "/api/pairs", `{"sensor-topic": "api/sensor2"}`, http.StatusBadRequest},
+		{http.MethodPost, "/api/pairs", `{"sensor-topic": "api/sensor2", "trv-topic": "api/trv2", "unknown": 1}`, http.StatusBadRequest},
+		{http.MethodGet, "/api/pairs/api/sensor", "", http.StatusOK},
+		{http.MethodGet, "/api/pairs/api%2Fsensor", "", http.StatusOK},
+		{http.MethodGet, "/api/pairs/api/unknown", "", http.StatusNotFound},
+		{http.MethodPut, "/api/pairs/api/sensor", `{"sensor-topic": "api/sensor", "trv-topic": "api/trv", "radiator-covered": true}`, http.StatusOK},
+		{http.MethodPut, "/api/pairs/api/sensor", `{"sensor-topic": "api/other", "trv-topic": "api/trv"}`, http.StatusBadRequest},
+		{http.MethodPut, "/api/pairs/api/unknown", `{"sensor-topic": "api/unknown", "trv-topic": "api/trv"}`, http.StatusNotFound},
+		{http.MethodPatch, "/api/pairs/api/sensor", "", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		if got := request(tt.method, tt.path, tt.body); got.Code != tt.status {
+			t.Errorf("%s %s = %d, want %d (%s)", tt.method, tt.path, got.Code, tt.status, got.Body.String())
+		}
+	}
+
+	var pairs []pairResource
+	if err := json.Unmarshal(request(http.MethodGet, "/api/pairs", "").Body.Bytes(), &pairs); err != nil {
+		t.Fatal(err)
+	}
+	if len(pairs) != 1 || pairs[0].Config.TrvTopic != "api/trv" || !pairs[0].Config.RadiatorCovered || pairs[0].Status.Tandem != tandemWaiting {
+		t.Errorf("GET /api/pairs = %+v", pairs)
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cfg.Tss.Pairs) != 1 || cfg.Tss.Pairs[0].SensorTopic != "api/sensor" || cfg.Tss.Cron != "*/5 * * * *" {
+		t.Errorf("persisted configuration = %+v", cfg.Tss)
+	}
+
+	if got := request(http.MethodDelete, "/api/pairs/api/sensor", ""); got.Code != http.StatusNoContent {
+		t.Errorf("DELETE /api/pairs/api/sensor = %d (%s)", got.Code, got.Body.String())
+	}
+	if _, exist := getPair("api/sensor"); exist {
+		t.Errorf("pair api/sensor still running after delete")
+	}
+	if cfg, err := loadConfig(*configFile); err != nil || len(cfg.Tss.Pairs) != 0 {
+		t.Errorf("persisted pairs after delete = %+v, %v", cfg, err)
+	}
+}
+
+func TestFilePairs(t *testing.T) {
+	configured := SyncConfigs{{SensorTopic: "file/sensor", TrvTopic: "file/trv"}, {SensorTopic: "both/sensor", TrvTopic: "file/trv2"}}
+	args := SyncConfigs{{SensorTopic: "args/sensor", TrvTopic: "args/trv"}, {SensorTopic: "both/sensor", TrvTopic: "args/trv2"}}
+	running := append(mergeSyncConfigs(configured, args), SensorTrvSync{SensorTopic: "api/sensor", TrvTopic: "api/trv"})
+
+	persisted := filePairs(running, configured, args)
+	want := SyncConfigs{configured[0], configured[1], {SensorTopic: "api/sensor", TrvTopic: "api/trv"}}
+	if len(persisted) != len(want) {
+		t.Fatalf("filePairs() = %+v, want %+v", persisted, want)
+	}
+	for i := range want {
+		if persisted[i] != want[i] {
+			t.Errorf("filePairs() = %+v, want %+v", persisted, want)
+		}
+	}
+
+	// command line pair changed by the API is written
+	running[2].RadiatorCovered = true
+	if persisted := filePairs(running, configured, args); len(persisted) != 4 || persisted[2] != running[2] {
+		t.Errorf("filePairs() should persist changed command line pair, got %+v", persisted)
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+	"github.com/jacfal.io/homeaut/pkg/sensors"
+	"github.com/jacfal.io/homeaut/utils"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Config is the configuration file, sections of other services are ignored
+type Config struct {
+	Broker config.Broker `json:"broker"`
+	Tss    TssConfig     `json:"tss"`
+	Tsc    interface{}   `json:"tsc,omitempty"` // temperature scheduler section, not used by tss
+}
+
+// TssConfig holds the synchronizer settings, command line args take precedence
+type TssConfig struct {
+	Cron                 string         `json:"cron,omitempty"`
+	Forward              string         `json:"forward,omitempty"`
+	Deadband             float64        `json:"deadband,omitempty"`
+	MinInterval          utils.Duration `json:"min-interval,omitempty"`
+	MaxInterval          utils.Duration `json:"max-interval,omitempty"`
+	SensorTimeout        utils.Duration `json:"sensor-timeout,omitempty"`         // tandem is disassembled when sensor is silent
+	CoveredSensorTimeout utils.Duration `json:"covered-sensor-timeout,omitempty"` // the same for radiator covered mode
+	ShutdownTimeout      utils.Duration `json:"shutdown-timeout,omitempty"`
+	State                string         `json:"state,omitempty"`         // state file
+	ServiceTopic         string         `json:"service-topic,omitempty"` // availability topic prefix
+	MetricsListen        string         `json:"metrics-listen,omitempty"`
+	APIListen            string         `json:"api-listen,omitempty"`
+	APIPersist           bool           `json:"api-persist,omitempty"` // rewrite the configuration file with pairs changed by the API, comments are dropped
+	Pairs                SyncConfigs    `json:"pairs,omitempty"`
+}
+
+func (c *TssConfig) Validate() error {
+	var errs config.Errors
+	if c.Forward != "" && c.Forward != forwardModeCron && c.Forward != forwardModeEvent {
+		errs.Append(config.FieldErr("forward", fmt.Errorf("unknown forwarding mode %q (use %s or %s)", c.Forward, forwardModeCron, forwardModeEvent)))
+	}
+	if c.Deadband < 0 {
+		errs.Append(config.FieldErr("deadband", errors.New("must not be negative")))
+	}
+
+	pairIndexes := map[string]int{}
+	for i, pair := range c.Pairs {
+		if first, exist := pairIndexes[pair.SensorTopic]; exist && pair.SensorTopic != "" {
+			errs.Append(config.FieldErr(fmt.Sprintf("pairs[%d].sensor-topic", i), fmt.Errorf("sensor %s is already paired by pairs[%d]", pair.SensorTopic, first)))
+			continue
+		}
+		pairIndexes[pair.SensorTopic] = i
+	}
+	return errs.Err()
+}
+
+func (s *SensorTrvSync) Validate() error {
+	var errs config.Errors
+	errs.Append(config.MustNotBeEmpty("sensor-topic", s.SensorTopic))
+	errs.Append(config.MustNotBeEmpty("trv-topic", s.TrvTopic))
+	if _, err := sensors.GetDecoder(s.SensorModel); err != nil {
+		errs.Append(config.FieldErr("sensor-model", err))
+	}
+	if s.Deadband < 0 {
+		errs.Append(config.FieldErr("deadband", errors.New("must not be negative")))
+	}
+	return errs.Err()
+}
+
+// Load configuration file
+func loadConfig(path string) (Config, error) {
+	log.Printf("Loading configuration: %s", path)
+	var cfg Config
+	if err := config.Load(path, &cfg); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Apply configuration file values to the input args, args set on the command line take precedence
+func applyConfig(cfg Config) {
+	applyFlag := func(name string, value string) {
+		if err := argFlags.Apply(name, value); err != nil {
+			log.Printf("Error! Can't apply configuration value %s=%s: %v", name, value, err)
+		}
+	}
+	formatDuration := func(d utils.Duration) string {
+		if d == 0 {
+			return ""
+		}
+		return d.String()
+	}
+
+	applyFlag("broker", cfg.Broker.URL)
+	mqttClientID = cfg.Broker.ClientID
+	if mqttClientID == "" {
+		mqttClientID = defaultMqttClientID
+	}
+	mqttUsername = cfg.Broker.Username
+	mqttPassword = cfg.Broker.Password
+
+	applyFlag("state", cfg.Tss.State)
+	applyFlag("service-topic", cfg.Tss.ServiceTopic)
+	applyFlag("metrics-listen", cfg.Tss.MetricsListen)
+	applyFlag("api-listen", cfg.Tss.APIListen)
+	applyFlag("api-persist", fmt.Sprintf("%t", cfg.Tss.APIPersist))
+	applyFlag("cron", cfg.Tss.Cron)
+	applyFlag("forward", cfg.Tss.Forward)
+	if cfg.Tss.Deadband > 0 {
+		applyFlag("deadband", fmt.Sprintf("%g", cfg.Tss.Deadband))
+	} else {
+		applyFlag("deadband", "")
+	}
+	applyFlag("min-interval", formatDuration(cfg.Tss.MinInterval))
+	applyFlag("max-interval", formatDuration(cfg.Tss.MaxInterval))
+
+	termSensorTimeoutSeconds = defaultTermSensorTimeoutSeconds
+	if cfg.Tss.SensorTimeout > 0 {
+		termSensorTimeoutSeconds = int64(cfg.Tss.SensorTimeout.Duration().Seconds())
+	}
+	coveredTermSensorTimeoutSeconds = defaultCoveredTermSensorTimeoutSeconds
+	if cfg.Tss.CoveredSensorTimeout > 0 {
+		coveredTermSensorTimeoutSeconds = int64(cfg.Tss.CoveredSensorTimeout.Duration().Seconds())
+	}
+	shutdownTimeout = defaultShutdownTimeout
+	if cfg.Tss.ShutdownTimeout > 0 {
+		shutdownTimeout = cfg.Tss.ShutdownTimeout.Duration()
+	}
+
+	syncs = mergeSyncConfigs(cfg.Tss.Pairs, syncArgs)
+}
+
+// Reload configuration file and apply changes to the running synchronizer
+func reloadConfig(client MQTT.Client) {
+	if *configFile == "" {
+		log.Printf("Warning! Configuration file not set, nothing to reload")
+		return
+	}
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		log.Printf("Error! Configuration reload failed, keeping current configuration: %v", err)
+		return
+	}
+
+	pairsChangeMu.Lock()
+	defer pairsChangeMu.Unlock()
+
+	previousBroker, previousState, previousCron, previousForwardMode := *mqttBroker, *stateFile, *cron, *forwardMode
+	mu.Lock()
+	applyConfig(cfg)
+	mu.Unlock()
+
+	if *mqttBroker != previousBroker {
+		log.Printf("Warning! MQTT broker change (%s --> %s) requires restart", previousBroker, *mqttBroker)
+	}
+	if *stateFile != previousState {
+		log.Printf("Warning! State file change (%s --> %s) requires restart", previousState, *stateFile)
+	}
+	if *cron != previousCron || *forwardMode != previousForwardMode {
+		log.Printf("Sensor --> TRV forwarding changed: mode %s, sync interval '%s'", *forwardMode, *cron)
+		scheduleCron(client)
+	}
+	applyPairs(client, syncs)
+	log.Printf("Configuration reloaded")
+}
+
+// Merge sync configs, overrides replace configs with the same sensor topic
+func mergeSyncConfigs(configs SyncConfigs, overrides SyncConfigs) SyncConfigs {
+	merged := append(SyncConfigs{}, configs...)
+	for _, override := range overrides {
+		replaced := false
+		for i := range merged {
+			if merged[i].SensorTopic == override.SensorTopic {
+				merged[i] = override
+				replaced = true
+			}
+		}
+		if !replaced {
+			merged = append(merged, override)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLoadExampleConfig(t *testing.T) {
+	cfg, err := loadConfig("../../config.example.yaml")
+	if err != nil {
+		t.Fatalf("loadConfig() error = %v", err)
+	}
+	if cfg.Broker.URL != "tcp://localhost:1883" || cfg.Tss.Forward != forwardModeEvent || len(cfg.Tss.Pairs) != 2 || !cfg.Tss.Pairs[1].RadiatorCovered {
+		t.Errorf("loadConfig() = %+v", cfg)
+	}
+}
+
+func TestLoadInvalidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	data := `
+tss:
+  forward: sometimes
+  pairs:
+    - sensor-topic: topic1
+      trv-topic: topic2
+    - sensor-topic: topic1
+      trv-topic: ""
+      min-interval: 5 minutes
+`
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := loadConfig(path)
+	if err == nil {
+		t.Fatalf("loadConfig() should fail")
+	}
+	for _, expected := range []string{"tss.forward:", "tss.pairs[1].min-interval:", "tss.pairs[1].trv-topic:", "tss.pairs[1].sensor-topic: sensor topic1 is already paired by pairs[0]"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Errorf("loadConfig() error should contain %q, got:\n%v", expected, err)
+		}
+	}
+}
+
+func TestMergeSyncConfigs(t *testing.T) {
+	configs := SyncConfigs{{SensorTopic: "sensor1", TrvTopic: "trv1"}, {SensorTopic: "sensor2", TrvTopic: "trv2"}}
+	overrides := SyncConfigs{{SensorTopic: "sensor2", TrvTopic: "trv2", RadiatorCovered: true}, {SensorTopic: "sensor3", TrvTopic: "trv3"}}
+	expected := SyncConfigs{{SensorTopic: "sensor1", TrvTopic: "trv1"}, {SensorTopic: "sensor2", TrvTopic: "trv2", RadiatorCovered: true}, {SensorTopic: "sensor3", TrvTopic: "trv3"}}
+
+	if got := mergeSyncConfigs(configs, overrides); !reflect.DeepEqual(got, expected) {
+		t.Errorf("mergeSyncConfigs() = %v, want %v", got, expected)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/sensors"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	forwardModeCron  = "cron"  // send sensor data on every cron tick
+	forwardModeEvent = "event" // send sensor data as soon as it changes
+)
+
+// Event driven forwarding settings of the Sensor --> TRV tandem
+type forwardSettings struct {
+	onChange    bool          // forward temperature changes immediately
+	deadband    float32       // minimal temperature change to forward
+	minInterval time.Duration // minimal time between two forwards
+	maxInterval time.Duration // keep-alive, maximal time between two forwards
+}
+
+// Last temperature forwarded to the TRV
+type forwardState struct {
+	temperature     float32
+	lastForwardUnix int64
+}
+
+// Get forwarding settings of the tandem, input args are used for values not set in the sync config.
+// Keep-alive interval is never longer than the TRV refresh interval of the radiator mode.
+func getForwardSettings(syncConfig SensorTrvSync) forwardSettings {
+	settings := forwardSettings{
+		onChange:    *forwardMode == forwardModeEvent,
+		deadband:    float32(*deadband),
+		minInterval: *minInterval,
+		maxInterval: *maxInterval,
+	}
+	if syncConfig.Deadband > 0 {
+		settings.deadband = syncConfig.Deadband
+	}
+	if syncConfig.MinInterval > 0 {
+		settings.minInterval = syncConfig.MinInterval.Duration()
+	}
+	if syncConfig.MaxInterval > 0 {
+		settings.maxInterval = syncConfig.MaxInterval.Duration()
+	}
+	if !settings.onChange || settings.maxInterval == 0 || settings.maxInterval > sensors.GetRefreshInterval(syncConfig.RadiatorCovered) {
+		settings.maxInterval = sensors.GetRefreshInterval(syncConfig.RadiatorCovered)
+	}
+	return settings
+}
+
+// Check if sensor temperature should be forwarded to the TRV
+//
+//	out: true if nothing was forwarded yet, the sensor turned stale, keep-alive interval elapsed or (on change
+//	     forwarding only) temperature moved more than deadband and minimal interval elapsed
+func forwardNeeded(settings forwardSettings, state forwardState, temperature float32, now time.Time) bool {
+	if state.lastForwardUnix == 0 {
+		return true
+	}
+	if temperature == sensors.ExternalSensorUndefined && state.temperature != sensors.ExternalSensorUndefined {
+		// stale sensor disassembles the tandem immediately, whatever the cadence
+		return true
+	}
+
+	sinceLastForward := now.Sub(time.Unix(state.lastForwardUnix, 0))
+	if settings.maxInterval > 0 && sinceLastForward >= settings.maxInterval {
+		return true
+	} else if !settings.onChange || sinceLastForward < settings.minInterval {
+		return false
+	}
+	return math.Abs(float64(temperature-state.temperature)) > float64(settings.deadband)
+}
+
+// Send temperature to the TRV paired with the sensor, mu must be held by the caller
+func forwardTemperature(client MQTT.Client, sensorTopic string, temperature float32, now time.Time) {
+	trvTopic := sensorTrvTopic[sensorTopic]
+	if trvTopic == "" {
+		log.Printf("Error! Can't find TRV topic for sensor %s", sensorTopic)
+		return
+	}
+
+	log.Printf("Sending current sensor temp (%.2f°C) to the thermo head (%s)", temperature, trvTopic)
+	syncConfig := sensorSyncs[sensorTopic]
+	if token := client.Publish(trvTopic, QOS, false, fmt.Sprintf("%d", sensors.GetExternalTempSensorFormat(temperature))); token.Wait() && token.Error() != nil {
+		log.Printf("Error! Publish sensor temperature failed. Topic %s, temperature: %f", trvTopic, temperature)
+		publishCounter.Inc(sensorTopic, syncConfig.TrvTopic, resultFailure)
+		return
+	}
+	publishCounter.Inc(sensorTopic, syncConfig.TrvTopic, resultSuccess)
+	assembled := temperature != sensors.ExternalSensorUndefined
+	tandemAssembledGauge.Set(boolToFloat(assembled), sensorTopic, syncConfig.TrvTopic)
+	if assembled {
+		forwardedTemperatureGauge.Set(float64(temperature), sensorTopic, syncConfig.TrvTopic)
+	}
+	forwardStates[sensorTopic] = forwardState{temperature: temperature, lastForwardUnix: now.Unix()}
+	recordForward(sensorTopic, syncConfig.TrvTopic, temperature, now)
+	publishPairStatus(client, sensorTopic)
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/mqtttest"
+	"github.com/jacfal.io/homeaut/pkg/sensors"
+	"github.com/jacfal.io/homeaut/utils"
+)
+
+func TestForwardNeeded(t *testing.T) {
+	settings := forwardSettings{onChange: true, deadband: 0.2, minInterval: 2 * time.Minute, maxInterval: 30 * time.Minute}
+	lastForward := time.Date(2023, 2, 4, 12, 0, 0, 0, time.UTC)
+	state := forwardState{temperature: 21.0, lastForwardUnix: lastForward.Unix()}
+
+	tests := []struct {
+		name        string
+		state       forwardState
+		temperature float32
+		now         time.Time
+		want        bool
+	}{
+		{name: "Nothing forwarded yet", state: forwardState{}, temperature: 21.0, now: lastForward, want: true},
+		{name: "Change within deadband", state: state, temperature: 21.1, now: lastForward.Add(5 * time.Minute), want: false},
+		{name: "Change over deadband", state: state, temperature: 21.3, now: lastForward.Add(5 * time.Minute), want: true},
+		{name: "Change over deadband (decrease)", state: state, temperature: 20.7, now: lastForward.Add(5 * time.Minute), want: true},
+		{name: "Change over deadband, min interval not elapsed", state: state, temperature: 22.0, now: lastForward.Add(1 * time.Minute), want: false},
+		{name: "No change, keep-alive elapsed", state: state, temperature: 21.0, now: lastForward.Add(30 * time.Minute), want: true},
+		{name: "Sensor turned stale", state: state, temperature: sensors.ExternalSensorUndefined, now: lastForward.Add(1 * time.Minute), want: true},
+		{name: "Sensor still stale", state: forwardState{temperature: sensors.ExternalSensorUndefined, lastForwardUnix: lastForward.Unix()}, temperature: sensors.ExternalSensorUndefined, now: lastForward.Add(5 * time.Minute), want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := forwardNeeded(settings, tt.state, tt.temperature, tt.now); got != tt.want {
+				t.Errorf("forwardNeeded() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardNeededRefreshOnly(t *testing.T) {
+	settings := forwardSettings{onChange: false, maxInterval: 30 * time.Minute}
+	lastForward := time.Date(2023, 2, 4, 12, 0, 0, 0, time.UTC)
+	state := forwardState{temperature: 21.0, lastForwardUnix: lastForward.Unix()}
+
+	if forwardNeeded(settings, state, 23.0, lastForward.Add(29*time.Minute)) {
+		t.Errorf("forwardNeeded() should wait for the refresh interval when not forwarding on change")
+	}
+	if !forwardNeeded(settings, state, 21.0, lastForward.Add(30*time.Minute)) {
+		t.Errorf("forwardNeeded() should refresh after the refresh interval")
+	}
+}
+
+func TestStaleSensorDisassemblesImmediately(t *testing.T) {
+	client := mqtttest.NewClient()
+	pair := SensorTrvSync{SensorTopic: "stale/sensor", TrvTopic: "stale/trv", RadiatorCovered: true}
+	mu.Lock()
+	previous := append(SyncConfigs{}, syncs...)
+	mu.Unlock()
+	applyPairs(client, SyncConfigs{pair})
+	defer applyPairs(client, previous)
+
+	// last forward within the refresh interval, last reading just past the stale limit
+	now := time.Now()
+	mu.Lock()
+	sensorTemperatures[pair.SensorTopic] = SensorTemperature{temperature: 21, lastUpdateUnix: now.Unix() - coveredTermSensorTimeoutSeconds - 60}
+	forwardStates[pair.SensorTopic] = forwardState{temperature: 21, lastForwardUnix: now.Add(-time.Minute).Unix()}
+	mu.Unlock()
+	client.Reset()
+
+	sensorTempTRV(client, false)()
+	undefined := fmt.Sprintf("%d", sensors.ExternalSensorUndefined)
+	trvTopic := pair.TrvTopic + "/set/external_measured_room_sensor"
+	if published := client.PublishedTo(trvTopic); len(published) != 1 || published[0] != undefined {
+		t.Errorf("stale sensor should disassemble the tandem before the refresh interval, published = %v", published)
+	}
+	sensorTempTRV(client, false)()
+	if published := client.PublishedTo(trvTopic); len(published) != 1 {
+		t.Errorf("disassembled tandem shouldn't be refreshed before the refresh interval, published = %v", published)
+	}
+}
+
+func TestGetForwardSettingsRefreshInterval(t *testing.T) {
+	defaultMode := *forwardMode
+	defer func() { *forwardMode = defaultMode }()
+
+	tests := []struct {
+		name       string
+		mode       string
+		syncConfig SensorTrvSync
+		want       time.Duration
+	}{
+		{name: "Cron, uncovered", mode: forwardModeCron, syncConfig: SensorTrvSync{}, want: 3 * time.Hour},
+		{name: "Cron, covered", mode: forwardModeCron, syncConfig: SensorTrvSync{RadiatorCovered: true}, want: 30 * time.Minute},
+		{name: "Event, uncovered", mode: forwardModeEvent, syncConfig: SensorTrvSync{MaxInterval: utils.Duration(time.Hour)}, want: time.Hour},
+		{name: "Event, covered, max interval capped", mode: forwardModeEvent, syncConfig: SensorTrvSync{RadiatorCovered: true, MaxInterval: utils.Duration(time.Hour)}, want: 30 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			*forwardMode = tt.mode
+			if got := getForwardSettings(tt.syncConfig).maxInterval; got != tt.want {
+				t.Errorf("getForwardSettings().maxInterval = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
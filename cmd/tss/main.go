@@ -5,23 +5,39 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"sync"
 	"time"
 
 	"github.com/go-co-op/gocron"
+	"github.com/jacfal.io/homeaut/pkg/config"
 	"github.com/jacfal.io/homeaut/pkg/sensors"
+	"github.com/jacfal.io/homeaut/pkg/status"
+	"github.com/jacfal.io/homeaut/pkg/store"
 	"github.com/jacfal.io/homeaut/utils"
 
 	MQTT "github.com/eclipse/paho.mqtt.golang"
 )
 
-const termSensorTimeoutSeconds = 60 * 60 * 3 // 3 hours
 const QOS = 0
 
+const (
+	defaultTermSensorTimeoutSeconds        int64 = 60 * 60 * 3 // 3 hours
+	defaultCoveredTermSensorTimeoutSeconds int64 = 60 * 60     // 1 hour, TRV relies on external sensor only
+	defaultShutdownTimeout                       = 30 * time.Second
+	defaultMqttClientID                          = "test-client"
+)
+
 // Tandem definition Sensor --> TRV
 type SensorTrvSync struct {
-	SensorTopic string `json:"sensor-topic"`
-	TrvTopic    string `json:"trv-topic"`
+	SensorTopic string         `json:"sensor-topic"`
+	TrvTopic    string         `json:"trv-topic"`
+	SensorModel string         `json:"sensor-model,omitempty"` // sensor payload decoder, sensors.DefaultModel when empty
+	Deadband    float32        `json:"deadband,omitempty"`     // event forwarding, --deadband when empty
+	MinInterval utils.Duration `json:"min-interval,omitempty"` // event forwarding, --min-interval when empty
+	MaxInterval utils.Duration `json:"max-interval,omitempty"` // event forwarding, --max-interval when empty
+	// Danfoss radiator covered mode, TRV uses external sensor only and needs more frequent updates
+	RadiatorCovered bool `json:"radiator-covered,omitempty"`
 }
 
 // SensorTemperature holds current temperature and last update time
@@ -33,48 +49,97 @@ type SensorTemperature struct {
 type SyncConfigs []SensorTrvSync
 
 var (
-	// key: trv topic, value: sensor temperature
+	// key: sensor topic, value: sensor temperature
 	sensorTemperatures = map[string]SensorTemperature{}
 	sensorTrvTopic     = map[string]string{}
 	mu                 sync.Mutex
 
-	// input args
-	mqttBroker = flag.String("broker", "tcp://localhost:1883", "MQTT broker connection string")
-	cron       = flag.String("cron", "", "Interval of sending sensor temp data to the TRV (use cron format '*/15 * * * *')")
-	syncs      SyncConfigs
-)
+	// key: sensor topic
+	sensorSyncs   = map[string]SensorTrvSync{}
+	forwardStates = map[string]forwardState{}
+
+	// persisted readings and pair status
+	stateStore = store.NewMemoryStore()
+
+	// retained pair status documents
+	statusPublisher = status.NewPublisher()
 
-func sensorTempTRV(client MQTT.Client) func() {
 	// Data receive timeout, when data not received from sensor within this time, we disassemble tandem
-	termSensorTimeoutSeconds := 60 * 60 * 3 // 3 hours
+	termSensorTimeoutSeconds        = defaultTermSensorTimeoutSeconds
+	coveredTermSensorTimeoutSeconds = defaultCoveredTermSensorTimeoutSeconds
+
+	shutdownTimeout = defaultShutdownTimeout
+	mqttClientID    = defaultMqttClientID
+	mqttUsername    string
+	mqttPassword    string
+
+	scheduler *gocron.Scheduler
+	cronJob   *gocron.Job
 
+	// configured pairs (configuration file merged with --sync args)
+	syncs    SyncConfigs
+	argFlags *config.Flags
+
+	// input args
+	configFile    = flag.String("config", "", "Configuration file (YAML or JSON), command line args take precedence")
+	serviceTopic  = flag.String("service-topic", "go-home/tss", "Topic prefix of the service availability (<service-topic>/availability)")
+	apiListen     = flag.String("api-listen", "", "Address of the HTTP API managing Sensor --> TRV pairs, eg. 'localhost:9111' (empty = disabled)")
+	apiPersist    = flag.Bool("api-persist", false, "Write pairs changed by the HTTP API back to the configuration file, the file is rewritten without its comments and key order")
+	metricsListen = flag.String("metrics-listen", "", "Address of the Prometheus metrics endpoint, eg. ':9101' (empty = disabled)")
+	stateFile     = flag.String("state", "", "State file keeping last sensor readings and pair status over restarts (empty = memory only)")
+	watchConfig   = flag.Duration("watch-config", 0, "Reload configuration file when it changes, checked on this interval (0 = reload on SIGHUP only)")
+	mqttBroker    = flag.String("broker", "tcp://localhost:1883", "MQTT broker connection string")
+	cron          = flag.String("cron", "", "Interval of sending sensor temp data to the TRV (use cron format '*/15 * * * *')")
+	forwardMode   = flag.String("forward", forwardModeCron, "Sensor --> TRV forwarding mode: 'cron' sends sensor temp on every --cron tick, 'event' sends it as soon as it changes more than --deadband")
+	deadband      = flag.Float64("deadband", 0.2, "Event forwarding: minimal sensor temperature change (°C) to forward")
+	minInterval   = flag.Duration("min-interval", 2*time.Minute, "Event forwarding: minimal interval between two forwards to the TRV")
+	maxInterval   = flag.Duration("max-interval", 30*time.Minute, "Event forwarding: keep-alive, forward the sensor temp at least once per this interval")
+	syncArgs      SyncConfigs
+)
+
+// sensorTempTRV sends sensor temperatures to the paired TRVs
+//
+//	in: force - send all temperatures, otherwise send only those where forward is needed
+func sensorTempTRV(client MQTT.Client, force bool) func() {
 	// closure
 	return func() {
 		mu.Lock()
 		defer mu.Unlock()
 
+		now := time.Now()
 		for sensorTopic, sensorData := range sensorTemperatures {
-			termSensorUpdateDeltaUnix := time.Now().Unix() - sensorData.lastUpdateUnix
-			if sensorData.temperature != sensors.ExternalSensorUndefined && termSensorUpdateDeltaUnix > int64(termSensorTimeoutSeconds) {
+			termSensorUpdateDeltaUnix := now.Unix() - sensorData.lastUpdateUnix
+			if sensorData.temperature != sensors.ExternalSensorUndefined && termSensorUpdateDeltaUnix > getTermSensorTimeoutSeconds(sensorSyncs[sensorTopic]) {
 				log.Printf("Warning! Haven't received data from sensor for %d minutes. Disassembling tandem", (termSensorUpdateDeltaUnix / 60))
 				// we need to tell TRV that sensor isn't available
 				sensorData = SensorTemperature{temperature: sensors.ExternalSensorUndefined, lastUpdateUnix: 0}
 			}
 
-			trvTopic := sensorTrvTopic[sensorTopic]
-			if trvTopic == "" {
-				log.Printf("Error! Can't find TRV topic for sensor %s", sensorTopic)
+			if !force && !forwardNeeded(getForwardSettings(sensorSyncs[sensorTopic]), forwardStates[sensorTopic], sensorData.temperature, now) {
 				continue
 			}
-
-			log.Printf("Sending current sensor temp (%.2f°C) to the thermo head (%s)", sensorData.temperature, trvTopic)
-			if token := client.Publish(trvTopic, QOS, false, fmt.Sprintf("%d", sensors.GetExternalTempSensorFormat(sensorData.temperature))); token.Wait() && token.Error() != nil {
-				log.Printf("Error! Publish sensor temperature failed. Topic %s, temperature: %f", trvTopic, sensorData.temperature)
-			}
+			forwardTemperature(client, sensorTopic, sensorData.temperature, now)
 		}
 	}
 }
 
+// Get sensor data receive timeout according to the radiator mode
+func getTermSensorTimeoutSeconds(syncConfig SensorTrvSync) int64 {
+	if syncConfig.RadiatorCovered {
+		return coveredTermSensorTimeoutSeconds
+	}
+	return termSensorTimeoutSeconds
+}
+
+// Tell TRV whether the radiator is covered, Danfoss TRV then uses external sensor as the only temperature input
+func setRadiatorCovered(client MQTT.Client, syncConfig SensorTrvSync) {
+	radiatorCoveredTopic := fmt.Sprintf("%s/set/radiator_covered", syncConfig.TrvTopic)
+	log.Printf("Setting radiator covered = %t (%s)", syncConfig.RadiatorCovered, radiatorCoveredTopic)
+	if token := client.Publish(radiatorCoveredTopic, QOS, false, fmt.Sprintf("%t", syncConfig.RadiatorCovered)); token.Wait() && token.Error() != nil {
+		log.Printf("Error! Publish radiator covered failed. Topic %s: %v", radiatorCoveredTopic, token.Error())
+	}
+}
+
 func (i *SyncConfigs) String() string {
 	// not used, but required by flag.Var
 	return ""
@@ -90,56 +155,106 @@ func (i *SyncConfigs) Set(value string) error {
 	return nil
 }
 
+// (Re)schedule sending of sensor data on the --cron tick
+func scheduleCron(client MQTT.Client) {
+	if cronJob != nil {
+		scheduler.RemoveByReference(cronJob)
+		cronJob = nil
+	}
+	if *forwardMode != forwardModeCron || *cron == "" {
+		return
+	}
+
+	job, err := scheduler.Cron(*cron).Do(sensorTempTRV(client, true))
+	if err != nil {
+		log.Printf("Error! Can't schedule sensor --> TRV sync (%s): %v", *cron, err)
+		return
+	}
+	cronJob = job
+}
+
 func main() {
 	log.Printf("=== Starting Thermo head <---> Sensor synchronizer ===")
 
-	flag.Var(&syncs, "sync", "Sensor, TRV sync json config: { 'sensor-topic': 'myhome-kr/livingroom/son-sns-01', 'trv-topic': 'myhome-kr/livingroom/danfoss-thermo-01' }")
+	flag.Var(&syncArgs, "sync", fmt.Sprintf("Sensor, TRV sync json config: { 'sensor-topic': 'myhome-kr/livingroom/son-sns-01', 'trv-topic': 'myhome-kr/livingroom/danfoss-thermo-01', 'sensor-model': '%s' } (sensor models: %v)", sensors.DefaultModel, sensors.Models()))
 	flag.Parse()
 
+	argFlags = config.CommandLineFlags()
+	syncs = syncArgs
+	if *configFile != "" {
+		cfg, err := loadConfig(*configFile)
+		if err != nil {
+			log.Fatalf("Error! %v", err)
+		}
+		applyConfig(cfg)
+	}
+	if len(syncs) == 0 {
+		log.Printf("Warning! No Sensor --> TRV pairs configured")
+	}
+
 	log.Printf("Sync configs: %v", syncs)
 	log.Printf("MQTT broker host: %s", *mqttBroker)
 
-	if *cron == "" {
-		log.Fatalf("Error! Sensor --> TRV sync interval must be set")
-	} else {
-		log.Printf("Sensor --> TRV sync interval: %s", *cron)
+	switch *forwardMode {
+	case forwardModeCron:
+		if *cron == "" {
+			log.Printf("Sensor --> TRV sync interval not set, using TRV refresh interval (radiator covered: %s, uncovered: %s)", sensors.CoveredRefreshInterval, sensors.UncoveredRefreshInterval)
+		} else {
+			log.Printf("Sensor --> TRV sync interval: %s", *cron)
+		}
+	case forwardModeEvent:
+		log.Printf("Sensor --> TRV event forwarding: deadband %.2f°C, min interval %s, max interval %s", *deadband, *minInterval, *maxInterval)
+		if *cron != "" {
+			log.Printf("Warning! Sync interval %s is ignored in event forwarding mode", *cron)
+		}
+	default:
+		log.Fatalf("Error! Unknown forwarding mode %s", *forwardMode)
+	}
+
+	if *stateFile != "" {
+		var err error
+		if stateStore, err = store.Open(*stateFile); err != nil {
+			log.Fatalf("Error! %v", err)
+		}
+		stateStore.AutoFlush(context.Background(), time.Minute)
+	}
+
+	mu.Lock()
+	for _, syncConfig := range syncs {
+		assembleTandem(syncConfig)
 	}
+	restoreState()
+	mu.Unlock()
 
-	scheduler := gocron.NewScheduler(time.UTC)
-	connOpts := MQTT.NewClientOptions().AddBroker(*mqttBroker).SetClientID("test-client").SetCleanSession(true)
+	scheduler = gocron.NewScheduler(time.UTC)
+	connOpts := MQTT.NewClientOptions().AddBroker(*mqttBroker).SetClientID(mqttClientID).SetCleanSession(true)
+	connOpts.SetUsername(mqttUsername).SetPassword(mqttPassword)
+	// handlers publish and wait for QoS 1 status tokens, they must not block the incoming messages
+	connOpts.SetOrderMatters(false)
+	status.SetWill(connOpts, *serviceTopic)
 
 	// MQTT Broker - topic subscription settings
 	connOpts.OnConnect = func(c MQTT.Client) {
+		if err := status.PublishAvailability(c, *serviceTopic, status.Online); err != nil {
+			log.Printf("Error! Publish availability failed: %v", err)
+		}
+		statusPublisher.Reset()
 
-		topicsToSubscribe := map[string]byte{}
-		for _, syncConfig := range syncs {
-			topicsToSubscribe[syncConfig.SensorTopic] = QOS
-			sensorTrvTopic[syncConfig.SensorTopic] = fmt.Sprintf("%s/set/external_measured_room_sensor", syncConfig.TrvTopic)
+		current := currentSyncConfigs()
+		for _, syncConfig := range current {
+			setRadiatorCovered(c, syncConfig)
 		}
 
+		mu.Lock()
 		log.Printf("Paired topics %v", sensorTrvTopic)
-		var onSensorMessageReceived = func(client MQTT.Client, message MQTT.Message) {
-			setTempVar := func(temp float32) {
-				mu.Lock()
-				defer mu.Unlock()
-				log.Printf("Setting new current temp = %f°C (%s)", temp, message.Topic())
-				sensorTemperatures[message.Topic()] = SensorTemperature{temp, time.Now().Unix()}
-			}
-			log.Printf("Sensor message received: %s (%s)", message.Payload(), message.Topic())
-			sonoffPayload, err := sensors.SonoffSensorPayloadToStruct(string(message.Payload()))
-			if err != nil {
-				log.Printf("Error! Can't parse sensor payload (%s)", message.Topic())
-			} else {
-				setTempVar(sonoffPayload.Temperature)
-			}
+		for _, syncConfig := range current {
+			publishPairStatus(c, syncConfig.SensorTopic)
 		}
+		mu.Unlock()
 
-		if token := c.SubscribeMultiple(topicsToSubscribe, onSensorMessageReceived); token.Wait() && token.Error() != nil {
-			log.Panicf("Error, topics %v subscription failed: %s", topicsToSubscribe, token.Error())
-		} else {
-			log.Printf("Topic %v subscribed", topicsToSubscribe)
+		if len(current) > 0 {
+			subscribeSensors(c, current)
 		}
-
 	}
 
 	// MQTT Broker - connect to the client, subscribe topic
@@ -150,24 +265,63 @@ func main() {
 		log.Printf("Connected to the MQTT broker")
 	}
 
-	scheduler.Cron(*cron).Do(sensorTempTRV(client))
+	// TRV refresh, keep-alive and forwards postponed by the minimal interval
+	scheduler.Every(1).Minute().Do(sensorTempTRV(client, false))
+	scheduleCron(client)
 	scheduler.StartAsync()
 
+	// HTTP endpoints, metrics and API share the server when listening on the same address
+	httpMuxes := map[string]*http.ServeMux{}
+	getHTTPMux := func(addr string) *http.ServeMux {
+		if _, exist := httpMuxes[addr]; !exist {
+			httpMuxes[addr] = http.NewServeMux()
+		}
+		return httpMuxes[addr]
+	}
+	if *metricsListen != "" {
+		registerRuntimeMetrics(client)
+		getHTTPMux(*metricsListen).Handle("/metrics", metricsRegistry.Handler())
+	}
+	if *apiListen != "" {
+		if *apiPersist && *configFile == "" {
+			log.Fatalf("Error! API persistence requires configuration file (--config)")
+		}
+		if *apiPersist {
+			log.Printf("Warning! Pairs changed by the API rewrite %s, comments of the file are dropped", *configFile)
+		}
+		api := &pairsAPI{client: client, persist: *apiPersist}
+		getHTTPMux(*apiListen).Handle(pairsAPIPath, api)
+		getHTTPMux(*apiListen).Handle(pairsAPIPath+"/", api)
+	}
+
+	cleanUpOps := map[string]utils.Operation{}
+	for addr, httpMux := range httpMuxes {
+		cleanUpOps["close-http-"+addr] = utils.StartHTTPServer(addr, httpMux)
+	}
+
+	// reload configuration on SIGHUP or configuration file change
+	utils.WatchReload(context.Background(), *configFile, *watchConfig, func() {
+		reloadConfig(client)
+	})
+
 	// wait for termination signal and register database & http server clean-up operations
-	wait := utils.GracefulShutdown(context.Background(), 30*time.Second, map[string]utils.Operation{
-		"disassemble-and-close": func(ctx context.Context) error {
-			defer client.Disconnect(0)
-			for trvTopic, _ := range sensorTemperatures {
-				// disassemble all sensor --> TRV tandems
-				token := client.Publish(trvTopic, 0, false, fmt.Sprintf("%d", sensors.ExternalSensorUndefined))
-				token.Wait()
-				if token.Error() != nil {
-					return token.Error()
-				}
+	cleanUpOps["disassemble-and-close"] = func(ctx context.Context) error {
+		defer client.Disconnect(250)
+		defer status.PublishAvailability(client, *serviceTopic, status.Offline)
+		mu.Lock()
+		defer mu.Unlock()
+		for _, trvTopic := range sensorTrvTopic {
+			// disassemble all sensor --> TRV tandems
+			if err := disassembleTandem(client, trvTopic); err != nil {
+				return err
 			}
-			return nil
-		},
-	})
+		}
+		return nil
+	}
+	cleanUpOps["flush-state"] = func(ctx context.Context) error {
+		return stateStore.Flush()
+	}
+	wait := utils.GracefulShutdown(context.Background(), shutdownTimeout, cleanUpOps)
 
 	<-wait
 }
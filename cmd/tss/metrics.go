@@ -0,0 +1,55 @@
+package main
+
+import (
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/metrics"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+const (
+	resultSuccess = "success"
+	resultFailure = "failure"
+)
+
+var (
+	metricsRegistry = metrics.NewRegistry()
+
+	sensorTemperatureGauge    = metricsRegistry.NewGauge("tss_sensor_temperature_celsius", "Last temperature received from the sensor.", "sensor", "trv")
+	forwardedTemperatureGauge = metricsRegistry.NewGauge("tss_forwarded_temperature_celsius", "Last sensor temperature forwarded to the TRV.", "sensor", "trv")
+	tandemAssembledGauge      = metricsRegistry.NewGauge("tss_tandem_assembled", "Whether the TRV uses the external sensor (1) or not (0).", "sensor", "trv")
+	sensorMessagesCounter     = metricsRegistry.NewCounter("tss_sensor_messages_total", "Sensor messages received by result of the payload decoding.", "sensor", "result")
+	publishCounter            = metricsRegistry.NewCounter("tss_publish_total", "Sensor temperature publishes to the TRV by result.", "sensor", "trv", "result")
+)
+
+// Register metrics computed on scrape
+func registerRuntimeMetrics(client MQTT.Client) {
+	metricsRegistry.NewGaugeFunc("tss_sensor_last_received_age_seconds", "Seconds since the last message from the sensor.", []string{"sensor", "trv"}, func(emit func(value float64, labelValues ...string)) {
+		mu.Lock()
+		defer mu.Unlock()
+		now := time.Now().Unix()
+		for sensorTopic, sensorData := range sensorTemperatures {
+			if sensorData.lastUpdateUnix > 0 {
+				emit(float64(now-sensorData.lastUpdateUnix), sensorTopic, sensorSyncs[sensorTopic].TrvTopic)
+			}
+		}
+	})
+	metricsRegistry.NewGaugeFunc("tss_mqtt_connected", "Whether the MQTT broker is connected (1) or not (0).", nil, func(emit func(value float64, labelValues ...string)) {
+		emit(boolToFloat(client.IsConnected()))
+	})
+}
+
+// Remove series of the dropped tandem
+func deletePairMetrics(sensorTopic string, trvTopic string) {
+	sensorTemperatureGauge.Delete(sensorTopic, trvTopic)
+	forwardedTemperatureGauge.Delete(sensorTopic, trvTopic)
+	tandemAssembledGauge.Delete(sensorTopic, trvTopic)
+}
+
+func boolToFloat(value bool) float64 {
+	if value {
+		return 1
+	}
+	return 0
+}
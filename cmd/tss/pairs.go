@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/sensors"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Pair sensor with TRV, mu must be held by the caller
+func assembleTandem(syncConfig SensorTrvSync) {
+	sensorTrvTopic[syncConfig.SensorTopic] = fmt.Sprintf("%s/set/external_measured_room_sensor", syncConfig.TrvTopic)
+	sensorSyncs[syncConfig.SensorTopic] = syncConfig
+}
+
+// Forget sensor pairing, mu must be held by the caller
+//
+//	out: TRV external sensor topic of the removed tandem
+func removeTandem(sensorTopic string) string {
+	trvTopic := sensorTrvTopic[sensorTopic]
+	deletePairMetrics(sensorTopic, sensorSyncs[sensorTopic].TrvTopic)
+	delete(sensorTrvTopic, sensorTopic)
+	delete(sensorSyncs, sensorTopic)
+	delete(sensorTemperatures, sensorTopic)
+	delete(forwardStates, sensorTopic)
+	forgetState(sensorTopic)
+	return trvTopic
+}
+
+// Tell TRV that external sensor isn't available
+func disassembleTandem(client MQTT.Client, trvTopic string) error {
+	log.Printf("Disassembling tandem (%s)", trvTopic)
+	token := client.Publish(trvTopic, QOS, false, fmt.Sprintf("%d", sensors.ExternalSensorUndefined))
+	token.Wait()
+	return token.Error()
+}
+
+// Get running sensor --> TRV pairs
+func currentSyncConfigs() SyncConfigs {
+	mu.Lock()
+	defer mu.Unlock()
+
+	current := SyncConfigs{}
+	for _, syncConfig := range sensorSyncs {
+		current = append(current, syncConfig)
+	}
+	return current
+}
+
+// Compare running pairs with the new ones
+//
+//	out: added pairs, removed pairs, changed pairs (new value)
+func diffSyncConfigs(current SyncConfigs, desired SyncConfigs) (SyncConfigs, SyncConfigs, SyncConfigs) {
+	currentBySensor := map[string]SensorTrvSync{}
+	for _, syncConfig := range current {
+		currentBySensor[syncConfig.SensorTopic] = syncConfig
+	}
+	desiredBySensor := map[string]SensorTrvSync{}
+	for _, syncConfig := range desired {
+		desiredBySensor[syncConfig.SensorTopic] = syncConfig
+	}
+
+	var added, removed, changed SyncConfigs
+	for _, syncConfig := range desired {
+		if currentConfig, exist := currentBySensor[syncConfig.SensorTopic]; !exist {
+			added = append(added, syncConfig)
+		} else if !reflect.DeepEqual(currentConfig, syncConfig) {
+			changed = append(changed, syncConfig)
+		}
+	}
+	for _, syncConfig := range current {
+		if _, exist := desiredBySensor[syncConfig.SensorTopic]; !exist {
+			removed = append(removed, syncConfig)
+		}
+	}
+	return added, removed, changed
+}
+
+// Apply new sensor --> TRV pairs to the running synchronizer: subscribe added sensors, unsubscribe and disassemble
+// removed pairs and re-pair changed ones
+func applyPairs(client MQTT.Client, desired SyncConfigs) {
+	added, removed, changed := diffSyncConfigs(currentSyncConfigs(), desired)
+	if len(added) == 0 && len(removed) == 0 && len(changed) == 0 {
+		return
+	}
+	log.Printf("Applying pairs: added %v, removed %v, changed %v", added, removed, changed)
+
+	var toDisassemble, toClear []string
+	var toSetup SyncConfigs
+	mu.Lock()
+	for _, syncConfig := range removed {
+		toDisassemble = append(toDisassemble, removeTandem(syncConfig.SensorTopic))
+		toClear = append(toClear, syncConfig.TrvTopic)
+	}
+	for _, syncConfig := range changed {
+		previous := sensorSyncs[syncConfig.SensorTopic]
+		if previous.TrvTopic != syncConfig.TrvTopic {
+			toDisassemble = append(toDisassemble, sensorTrvTopic[syncConfig.SensorTopic])
+			toClear = append(toClear, previous.TrvTopic)
+		}
+		if previous.TrvTopic != syncConfig.TrvTopic || previous.RadiatorCovered != syncConfig.RadiatorCovered {
+			toSetup = append(toSetup, syncConfig)
+		}
+		assembleTandem(syncConfig)
+		// forward current temperature with the new settings
+		delete(forwardStates, syncConfig.SensorTopic)
+	}
+	for _, syncConfig := range added {
+		assembleTandem(syncConfig)
+		toSetup = append(toSetup, syncConfig)
+	}
+	mu.Unlock()
+
+	if !client.IsConnected() {
+		// sensors are subscribed on (re)connect
+		return
+	}
+
+	if len(removed) > 0 {
+		topics := make([]string, len(removed))
+		for i, syncConfig := range removed {
+			topics[i] = syncConfig.SensorTopic
+		}
+		if token := client.Unsubscribe(topics...); token.Wait() && token.Error() != nil {
+			log.Printf("Error! Topics %v unsubscription failed: %v", topics, token.Error())
+		} else {
+			log.Printf("Topics %v unsubscribed", topics)
+		}
+	}
+	for _, trvTopic := range toDisassemble {
+		if err := disassembleTandem(client, trvTopic); err != nil {
+			log.Printf("Error! Can't disassemble tandem (%s): %v", trvTopic, err)
+		}
+	}
+	for _, trvTopic := range toClear {
+		clearPairStatus(client, trvTopic)
+	}
+	for _, syncConfig := range toSetup {
+		setRadiatorCovered(client, syncConfig)
+	}
+	mu.Lock()
+	for _, syncConfig := range append(added, changed...) {
+		publishPairStatus(client, syncConfig.SensorTopic)
+	}
+	mu.Unlock()
+	if len(added) > 0 {
+		subscribeSensors(client, added)
+	}
+	sensorTempTRV(client, false)()
+}
+
+// Subscribe sensor topics
+func subscribeSensors(client MQTT.Client, syncConfigs SyncConfigs) {
+	topicsToSubscribe := map[string]byte{}
+	for _, syncConfig := range syncConfigs {
+		topicsToSubscribe[syncConfig.SensorTopic] = QOS
+	}
+	if token := client.SubscribeMultiple(topicsToSubscribe, onSensorMessageReceived); token.Wait() && token.Error() != nil {
+		log.Printf("Error! Topics %v subscription failed: %s", topicsToSubscribe, token.Error())
+	} else {
+		log.Printf("Topic %v subscribed", topicsToSubscribe)
+	}
+}
+
+func onSensorMessageReceived(client MQTT.Client, message MQTT.Message) {
+	setTempVar := func(temp float32) {
+		mu.Lock()
+		defer mu.Unlock()
+		if _, paired := sensorSyncs[message.Topic()]; !paired {
+			// message received before unsubscription of removed pair
+			return
+		}
+		log.Printf("Setting new current temp = %f°C (%s)", temp, message.Topic())
+		sensorTemperatureGauge.Set(float64(temp), message.Topic(), sensorSyncs[message.Topic()].TrvTopic)
+		now := time.Now()
+		sensorTemperatures[message.Topic()] = SensorTemperature{temp, now.Unix()}
+		recordReading(message.Topic(), temp, now)
+		defer publishPairStatus(client, message.Topic())
+
+		if *forwardMode == forwardModeEvent && forwardNeeded(getForwardSettings(sensorSyncs[message.Topic()]), forwardStates[message.Topic()], temp, now) {
+			forwardTemperature(client, message.Topic(), temp, now)
+		}
+	}
+	log.Printf("Sensor message received: %s (%s)", message.Payload(), message.Topic())
+	mu.Lock()
+	sensorModel := sensorSyncs[message.Topic()].SensorModel
+	mu.Unlock()
+
+	sensorData, err := sensors.DecodePayload(sensorModel, string(message.Payload()))
+	if err != nil {
+		log.Printf("Error! Can't parse sensor payload (%s): %v", message.Topic(), err)
+		sensorMessagesCounter.Inc(message.Topic(), resultFailure)
+	} else {
+		sensorMessagesCounter.Inc(message.Topic(), resultSuccess)
+		setTempVar(sensorData.GetTemperature())
+	}
+}
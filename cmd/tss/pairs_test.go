@@ -0,0 +1,35 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffSyncConfigs(t *testing.T) {
+	current := SyncConfigs{
+		{SensorTopic: "sensor1", TrvTopic: "trv1"},
+		{SensorTopic: "sensor2", TrvTopic: "trv2"},
+		{SensorTopic: "sensor3", TrvTopic: "trv3"},
+	}
+	desired := SyncConfigs{
+		{SensorTopic: "sensor1", TrvTopic: "trv1"},
+		{SensorTopic: "sensor2", TrvTopic: "trv2", RadiatorCovered: true},
+		{SensorTopic: "sensor4", TrvTopic: "trv4"},
+	}
+
+	added, removed, changed := diffSyncConfigs(current, desired)
+	if !reflect.DeepEqual(added, SyncConfigs{{SensorTopic: "sensor4", TrvTopic: "trv4"}}) {
+		t.Errorf("diffSyncConfigs() added = %v", added)
+	}
+	if !reflect.DeepEqual(removed, SyncConfigs{{SensorTopic: "sensor3", TrvTopic: "trv3"}}) {
+		t.Errorf("diffSyncConfigs() removed = %v", removed)
+	}
+	if !reflect.DeepEqual(changed, SyncConfigs{{SensorTopic: "sensor2", TrvTopic: "trv2", RadiatorCovered: true}}) {
+		t.Errorf("diffSyncConfigs() changed = %v", changed)
+	}
+
+	added, removed, changed = diffSyncConfigs(current, current)
+	if len(added) != 0 || len(removed) != 0 || len(changed) != 0 {
+		t.Errorf("diffSyncConfigs() of the same configs should be empty, got %v, %v, %v", added, removed, changed)
+	}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/sensors"
+	"github.com/jacfal.io/homeaut/pkg/store"
+)
+
+// Restore last sensor readings of configured pairs, mu must be held by the caller
+func restoreState() {
+	stateStore.View(func(state *store.State) {
+		for sensorTopic, reading := range state.Readings {
+			if _, paired := sensorSyncs[sensorTopic]; !paired {
+				continue
+			}
+			log.Printf("Restoring sensor temp = %f°C from %s (%s)", reading.Temperature, reading.Time.Format(time.RFC3339), sensorTopic)
+			sensorTemperatures[sensorTopic] = SensorTemperature{temperature: reading.Temperature, lastUpdateUnix: reading.Time.Unix()}
+		}
+	})
+}
+
+// Persist sensor reading
+func recordReading(sensorTopic string, temperature float32, now time.Time) {
+	stateStore.Update(func(state *store.State) bool {
+		state.Readings[sensorTopic] = store.Reading{Temperature: temperature, Time: now}
+		return true
+	})
+}
+
+// Persist tandem status after the temperature was forwarded to the TRV
+func recordForward(sensorTopic string, trvTopic string, temperature float32, now time.Time) {
+	stateStore.Update(func(state *store.State) bool {
+		state.Pairs[sensorTopic] = store.PairStatus{
+			TrvTopic:             trvTopic,
+			Assembled:            temperature != sensors.ExternalSensorUndefined,
+			ForwardedTemperature: temperature,
+			LastForward:          now,
+		}
+		return true
+	})
+}
+
+// Forget state of removed pair
+func forgetState(sensorTopic string) {
+	stateStore.Update(func(state *store.State) bool {
+		delete(state.Readings, sensorTopic)
+		delete(state.Pairs, sensorTopic)
+		return true
+	})
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/sensors"
+	"github.com/jacfal.io/homeaut/pkg/store"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Tandem states
+const (
+	tandemWaiting      = "waiting" // nothing forwarded yet
+	tandemAssembled    = "assembled"
+	tandemDisassembled = "disassembled"
+)
+
+// pairStatus is the retained status document of the Sensor --> TRV tandem
+type pairStatus struct {
+	SensorTopic          string     `json:"sensor-topic"`
+	TrvTopic             string     `json:"trv-topic"`
+	Temperature          *float32   `json:"temperature,omitempty"` // last sensor temperature
+	LastReading          *time.Time `json:"last-reading,omitempty"`
+	ForwardedTemperature *float32   `json:"forwarded-temperature,omitempty"`
+	LastForward          *time.Time `json:"last-forward,omitempty"`
+	Tandem               string     `json:"tandem"`
+	RadiatorCovered      bool       `json:"radiator-covered"`
+}
+
+func pairStatusTopic(trvTopic string) string {
+	return trvTopic + "/tss/status"
+}
+
+// Get status of the tandem, mu must be held by the caller
+func getPairStatus(sensorTopic string) pairStatus {
+	syncConfig := sensorSyncs[sensorTopic]
+	pair := pairStatus{
+		SensorTopic:     sensorTopic,
+		TrvTopic:        syncConfig.TrvTopic,
+		Tandem:          tandemWaiting,
+		RadiatorCovered: syncConfig.RadiatorCovered,
+	}
+
+	if sensorData, exist := sensorTemperatures[sensorTopic]; exist {
+		temperature := sensorData.temperature
+		lastReading := time.Unix(sensorData.lastUpdateUnix, 0)
+		pair.Temperature = &temperature
+		pair.LastReading = &lastReading
+	}
+	stateStore.View(func(state *store.State) {
+		if forwarded, exist := state.Pairs[sensorTopic]; exist && forwarded.TrvTopic == syncConfig.TrvTopic {
+			temperature := forwarded.ForwardedTemperature
+			lastForward := forwarded.LastForward
+			pair.ForwardedTemperature = &temperature
+			pair.LastForward = &lastForward
+			if forwarded.ForwardedTemperature == sensors.ExternalSensorUndefined {
+				pair.Tandem = tandemDisassembled
+			} else {
+				pair.Tandem = tandemAssembled
+			}
+		}
+	})
+	return pair
+}
+
+// Publish status of the tandem, mu must be held by the caller
+func publishPairStatus(client MQTT.Client, sensorTopic string) {
+	pair := getPairStatus(sensorTopic)
+	if pair.TrvTopic == "" {
+		return
+	}
+	if err := statusPublisher.Publish(client, pairStatusTopic(pair.TrvTopic), pair); err != nil {
+		log.Printf("Error! Publish pair status failed (%s): %v", pairStatusTopic(pair.TrvTopic), err)
+	}
+}
+
+// Remove retained status of the dropped tandem
+func clearPairStatus(client MQTT.Client, trvTopic string) {
+	if err := statusPublisher.Clear(client, pairStatusTopic(trvTopic)); err != nil {
+		log.Printf("Error! Clear pair status failed (%s): %v", pairStatusTopic(trvTopic), err)
+	}
+}
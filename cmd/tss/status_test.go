@@ -0,0 +1,33 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/sensors"
+)
+
+func TestGetPairStatus(t *testing.T) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	now := time.Date(2023, 2, 4, 12, 0, 0, 0, time.UTC)
+	assembleTandem(SensorTrvSync{SensorTopic: "status-sensor", TrvTopic: "status-trv", RadiatorCovered: true})
+	defer removeTandem("status-sensor")
+
+	if pair := getPairStatus("status-sensor"); pair.Tandem != tandemWaiting || pair.Temperature != nil || !pair.RadiatorCovered {
+		t.Errorf("getPairStatus() before reading = %+v", pair)
+	}
+
+	sensorTemperatures["status-sensor"] = SensorTemperature{temperature: 21.5, lastUpdateUnix: now.Unix()}
+	recordForward("status-sensor", "status-trv", 21.5, now)
+	pair := getPairStatus("status-sensor")
+	if pair.Tandem != tandemAssembled || *pair.Temperature != 21.5 || *pair.ForwardedTemperature != 21.5 || !pair.LastForward.Equal(now) {
+		t.Errorf("getPairStatus() after forward = %+v", pair)
+	}
+
+	recordForward("status-sensor", "status-trv", sensors.ExternalSensorUndefined, now)
+	if pair := getPairStatus("status-sensor"); pair.Tandem != tandemDisassembled {
+		t.Errorf("getPairStatus() after disassembly = %+v", pair)
+	}
+}
@@ -3,6 +3,9 @@ package main
 import (
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/jacfal.io/homeaut/utils"
 )
 
 func TestParseSyncConfig(t *testing.T) {
@@ -18,6 +21,10 @@ func TestParseSyncConfig(t *testing.T) {
 		{name: "Parse config", args: args{jsonStr: `{ "sensor-topic": "topic1", "trv-topic": "topic2" }`}, want: SensorTrvSync{SensorTopic: "topic1", TrvTopic: "topic2"}, wantErr: false},
 		{name: "Parse config - err no sensor topic", args: args{jsonStr: `{ "sensor-topic": "", "trv-topic": "topic2" }`}, want: SensorTrvSync{}, wantErr: true},
 		{name: "Parse config - err no trv topic", args: args{jsonStr: `{ "sensor-topic": "topic1", "trv-topic": "" }`}, want: SensorTrvSync{}, wantErr: true},
+		{name: "Parse config with sensor model", args: args{jsonStr: `{ "sensor-topic": "topic1", "trv-topic": "topic2", "sensor-model": "sonoff-snzb-02" }`}, want: SensorTrvSync{SensorTopic: "topic1", TrvTopic: "topic2", SensorModel: "sonoff-snzb-02"}, wantErr: false},
+		{name: "Parse config with event forwarding", args: args{jsonStr: `{ "sensor-topic": "topic1", "trv-topic": "topic2", "deadband": 0.5, "min-interval": "5m", "max-interval": 3600 }`}, want: SensorTrvSync{SensorTopic: "topic1", TrvTopic: "topic2", Deadband: 0.5, MinInterval: utils.Duration(5 * time.Minute), MaxInterval: utils.Duration(time.Hour)}, wantErr: false},
+		{name: "Parse config - err invalid interval", args: args{jsonStr: `{ "sensor-topic": "topic1", "trv-topic": "topic2", "min-interval": "5 minutes" }`}, want: SensorTrvSync{}, wantErr: true},
+		{name: "Parse config - err unknown sensor model", args: args{jsonStr: `{ "sensor-topic": "topic1", "trv-topic": "topic2", "sensor-model": "unknown" }`}, want: SensorTrvSync{}, wantErr: true},
 		{name: "Parse config - err invalid json", args: args{jsonStr: `{ "sensor-topic": "topic1", `}, want: SensorTrvSync{}, wantErr: true},
 	}
 	for _, tt := range tests {
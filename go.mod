@@ -3,8 +3,12 @@ module github.com/jacfal.io/homeaut
 go 1.19
 
 require (
-	github.com/eclipse/paho.mqtt.golang v1.4.2 // indirect
-	github.com/go-co-op/gocron v1.18.0 // indirect
+	github.com/eclipse/paho.mqtt.golang v1.4.2
+	github.com/go-co-op/gocron v1.18.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
 	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/robfig/cron/v3 v3.0.1 // indirect
 	golang.org/x/net v0.0.0-20200425230154-ff2c4b7c35a0 // indirect
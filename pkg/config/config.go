@@ -0,0 +1,119 @@
+// Package config loads service configuration from YAML or JSON files.
+//
+// Configuration is decoded strictly (unknown fields are rejected) and every value implementing Validator is validated.
+// All problems are reported at once with the path to the offending field, eg. `tss.pairs[2].sensor-topic: must not be empty`.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Broker holds MQTT broker connection settings
+type Broker struct {
+	URL      string `json:"url,omitempty"`
+	ClientID string `json:"client-id,omitempty"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+}
+
+// Validator is implemented by configuration values which need to be checked after decoding
+type Validator interface {
+	Validate() error
+}
+
+// Load reads configuration file to v, YAML is used unless the file has .json extension
+func Load(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		err = DecodeJSON(data, v)
+	} else {
+		err = DecodeYAML(data, v)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid configuration %s:\n%w", path, err)
+	}
+	return nil
+}
+
+// DecodeJSON decodes and validates JSON configuration
+func DecodeJSON(data []byte, v interface{}) error {
+	var tree interface{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return err
+	}
+	return Decode(tree, v)
+}
+
+// DecodeYAML decodes and validates YAML configuration
+func DecodeYAML(data []byte, v interface{}) error {
+	var tree interface{}
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return err
+	}
+	return Decode(tree, v)
+}
+
+// Save writes configuration to the file, YAML is used unless the file has .json extension, the file is rewritten as
+// a whole: comments and order of the keys are not kept
+func Save(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(filepath.Ext(path), ".json") {
+		// go through generic tree to keep JSON field names and custom marshalers
+		var tree interface{}
+		if err := json.Unmarshal(data, &tree); err != nil {
+			return err
+		}
+		if data, err = yaml.Marshal(tree); err != nil {
+			return err
+		}
+	}
+	return WriteFileAtomic(path, data, 0o644)
+}
+
+// WriteFileAtomic writes data to a temporary file and renames it to path, so readers never see partial content
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// MustNotBeEmpty returns field error when value is empty
+func MustNotBeEmpty(path string, value string) error {
+	if value == "" {
+		return FieldErr(path, errors.New("must not be empty"))
+	}
+	return nil
+}
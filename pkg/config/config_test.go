@@ -0,0 +1,123 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jacfal.io/homeaut/utils"
+)
+
+type testPair struct {
+	Sensor   string         `json:"sensor"`
+	Interval utils.Duration `json:"interval,omitempty"`
+}
+
+func (p *testPair) Validate() error {
+	return MustNotBeEmpty("sensor", p.Sensor)
+}
+
+type testConfig struct {
+	Broker Broker             `json:"broker"`
+	Pairs  []testPair         `json:"pairs"`
+	Limits map[string]float64 `json:"limits,omitempty"`
+}
+
+func TestDecodeYAMLAndJSON(t *testing.T) {
+	yamlData := `
+broker:
+  url: tcp://localhost:1883
+pairs:
+  - sensor: topic1
+    interval: 15m
+limits:
+  min: 5
+`
+	jsonData := `{"broker": {"url": "tcp://localhost:1883"}, "pairs": [{"sensor": "topic1", "interval": "15m"}], "limits": {"min": 5}}`
+	expected := testConfig{
+		Broker: Broker{URL: "tcp://localhost:1883"},
+		Pairs:  []testPair{{Sensor: "topic1", Interval: utils.Duration(15 * 60 * 1e9)}},
+		Limits: map[string]float64{"min": 5},
+	}
+
+	var fromYAML, fromJSON testConfig
+	if err := DecodeYAML([]byte(yamlData), &fromYAML); err != nil {
+		t.Fatalf("DecodeYAML() error = %v", err)
+	}
+	if err := DecodeJSON([]byte(jsonData), &fromJSON); err != nil {
+		t.Fatalf("DecodeJSON() error = %v", err)
+	}
+	if !reflect.DeepEqual(fromYAML, expected) || !reflect.DeepEqual(fromJSON, expected) {
+		t.Errorf("Decode() yaml = %v, json = %v, want %v", fromYAML, fromJSON, expected)
+	}
+}
+
+func TestDecodeErrorPaths(t *testing.T) {
+	yamlData := `
+broker:
+  url: 1883
+pairs:
+  - sensor: topic1
+  - sensor: ""
+    interval: 15 minutes
+  - sensr: topic3
+limits:
+  min: low
+`
+	var cfg testConfig
+	err := DecodeYAML([]byte(yamlData), &cfg)
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("DecodeYAML() error = %v, want Errors", err)
+	}
+
+	expectedPaths := []string{"broker.url", "limits.min", "pairs[1].interval", "pairs[1].sensor", "pairs[2].sensr", "pairs[2].sensor"}
+	paths := []string{}
+	for _, err := range errs {
+		var fieldErr *FieldError
+		if !errors.As(err, &fieldErr) {
+			t.Fatalf("DecodeYAML() error %v is not a field error", err)
+		}
+		paths = append(paths, fieldErr.Path)
+	}
+	if strings.Join(paths, ",") != strings.Join(expectedPaths, ",") {
+		t.Errorf("DecodeYAML() error paths = %v, want %v\n%v", paths, expectedPaths, err)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	expected := testConfig{
+		Broker: Broker{URL: "tcp://localhost:1883"},
+		Pairs:  []testPair{{Sensor: "topic1", Interval: utils.Duration(15 * 60 * 1e9)}},
+	}
+
+	for _, name := range []string{"config.yaml", "config.json"} {
+		path := filepath.Join(t.TempDir(), name)
+		if err := Save(path, expected); err != nil {
+			t.Fatalf("Save(%s) error = %v", name, err)
+		}
+
+		var loaded testConfig
+		if err := Load(path, &loaded); err != nil {
+			data, _ := os.ReadFile(path)
+			t.Fatalf("Load(%s) error = %v\n%s", name, err, data)
+		}
+		if !reflect.DeepEqual(loaded, expected) {
+			t.Errorf("Load(%s) = %v, want %v", name, loaded, expected)
+		}
+	}
+}
+
+func TestDecodeYAMLDates(t *testing.T) {
+	var cfg testConfig
+	if err := DecodeYAML([]byte("pairs:\n  - sensor: 2023-12-24\n"), &cfg); err != nil {
+		t.Fatalf("DecodeYAML() error = %v", err)
+	}
+	if len(cfg.Pairs) != 1 || cfg.Pairs[0].Sensor != "2023-12-24" {
+		t.Errorf("DecodeYAML() date = %v, want 2023-12-24", cfg.Pairs)
+	}
+}
@@ -0,0 +1,246 @@
+package config
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	validatorType       = reflect.TypeOf((*Validator)(nil)).Elem()
+)
+
+// Decode decodes generic configuration tree (as produced by json or yaml unmarshal to interface{}) to v.
+// Field names are taken from json struct tags and custom json.Unmarshaler implementations are respected.
+func Decode(tree interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("config: Decode requires non-nil pointer, got %T", v)
+	}
+	return decode("", tree, rv.Elem())
+}
+
+func decode(path string, src interface{}, dst reflect.Value) error {
+	if dst.Kind() == reflect.Ptr {
+		if src == nil {
+			dst.Set(reflect.Zero(dst.Type()))
+			return nil
+		}
+		value := reflect.New(dst.Type().Elem())
+		if err := decode(path, src, value.Elem()); err != nil {
+			return err
+		}
+		dst.Set(value)
+		return nil
+	}
+
+	if reflect.PtrTo(dst.Type()).Implements(jsonUnmarshalerType) {
+		data, err := json.Marshal(src)
+		if err != nil {
+			return FieldErr(path, err)
+		}
+		if err := dst.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(data); err != nil {
+			return withPath(path, err)
+		}
+		return validate(path, dst)
+	}
+
+	if reflect.PtrTo(dst.Type()).Implements(textUnmarshalerType) {
+		text, ok := src.(string)
+		if !ok {
+			return FieldErr(path, fmt.Errorf("expected string, got %s", describe(src)))
+		}
+		if err := dst.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(text)); err != nil {
+			return FieldErr(path, err)
+		}
+		return validate(path, dst)
+	}
+
+	var err error
+	switch dst.Kind() {
+	case reflect.Struct:
+		err = decodeStruct(path, src, dst)
+	case reflect.Slice:
+		err = decodeSlice(path, src, dst)
+	case reflect.Map:
+		err = decodeMap(path, src, dst)
+	case reflect.Interface:
+		if src != nil {
+			dst.Set(reflect.ValueOf(src))
+		}
+	default:
+		err = decodeScalar(path, src, dst)
+	}
+	// validate even partially decoded values, so all problems are reported at once
+	var errs Errors
+	errs.Append(err)
+	errs.Append(validate(path, dst))
+	return errs.Err()
+}
+
+func decodeStruct(path string, src interface{}, dst reflect.Value) error {
+	values, ok := src.(map[string]interface{})
+	if !ok {
+		if src == nil {
+			return nil
+		}
+		return FieldErr(path, fmt.Errorf("expected object, got %s", describe(src)))
+	}
+
+	fields := structFields(dst.Type())
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errs Errors
+	for _, key := range keys {
+		index, exist := fields[key]
+		if !exist {
+			errs.Append(FieldErr(joinPath(path, key), fmt.Errorf("unknown field (known fields: %s)", strings.Join(fieldNames(fields), ", "))))
+			continue
+		}
+		errs.Append(decode(joinPath(path, key), values[key], dst.Field(index)))
+	}
+	return errs.Err()
+}
+
+func decodeSlice(path string, src interface{}, dst reflect.Value) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	values, ok := src.([]interface{})
+	if !ok {
+		return FieldErr(path, fmt.Errorf("expected list, got %s", describe(src)))
+	}
+
+	var errs Errors
+	result := reflect.MakeSlice(dst.Type(), len(values), len(values))
+	for i, value := range values {
+		errs.Append(decode(fmt.Sprintf("%s[%d]", path, i), value, result.Index(i)))
+	}
+	dst.Set(result)
+	return errs.Err()
+}
+
+func decodeMap(path string, src interface{}, dst reflect.Value) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	values, ok := src.(map[string]interface{})
+	if !ok {
+		return FieldErr(path, fmt.Errorf("expected object, got %s", describe(src)))
+	} else if dst.Type().Key().Kind() != reflect.String {
+		return FieldErr(path, fmt.Errorf("unsupported map key type %s", dst.Type().Key()))
+	}
+
+	var errs Errors
+	result := reflect.MakeMapWithSize(dst.Type(), len(values))
+	for key, value := range values {
+		element := reflect.New(dst.Type().Elem()).Elem()
+		if err := decode(joinPath(path, key), value, element); err != nil {
+			errs.Append(err)
+			continue
+		}
+		result.SetMapIndex(reflect.ValueOf(key).Convert(dst.Type().Key()), element)
+	}
+	dst.Set(result)
+	return errs.Err()
+}
+
+func decodeScalar(path string, src interface{}, dst reflect.Value) error {
+	// yaml decodes unquoted dates to timestamps, string fields get them as written
+	if timestamp, ok := src.(time.Time); ok && dst.Kind() == reflect.String {
+		if timestamp.Equal(timestamp.Truncate(24 * time.Hour)) {
+			dst.SetString(timestamp.Format("2006-01-02"))
+		} else {
+			dst.SetString(timestamp.Format(time.RFC3339Nano))
+		}
+		return nil
+	}
+	data, err := json.Marshal(src)
+	if err != nil {
+		return FieldErr(path, err)
+	}
+	if err := json.Unmarshal(data, dst.Addr().Interface()); err != nil {
+		return FieldErr(path, fmt.Errorf("expected %s, got %s", kindName(dst.Kind()), describe(src)))
+	}
+	return nil
+}
+
+func validate(path string, value reflect.Value) error {
+	if value.CanAddr() && reflect.PtrTo(value.Type()).Implements(validatorType) {
+		return withPath(path, value.Addr().Interface().(Validator).Validate())
+	} else if value.Type().Implements(validatorType) {
+		return withPath(path, value.Interface().(Validator).Validate())
+	}
+	return nil
+}
+
+// json field name --> struct field index
+func structFields(t reflect.Type) map[string]int {
+	fields := map[string]int{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+		name := field.Name
+		if tag, ok := field.Tag.Lookup("json"); ok {
+			tagName := strings.Split(tag, ",")[0]
+			if tagName == "-" {
+				continue
+			} else if tagName != "" {
+				name = tagName
+			}
+		}
+		fields[name] = i
+	}
+	return fields
+}
+
+func fieldNames(fields map[string]int) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func describe(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "list"
+	case string:
+		return fmt.Sprintf("string %q", v)
+	case bool:
+		return fmt.Sprintf("bool %t", v)
+	default:
+		return fmt.Sprintf("number %v", v)
+	}
+}
+
+func kindName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	default:
+		return kind.String()
+	}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"strings"
+)
+
+// FieldError is an error of a configuration field
+type FieldError struct {
+	Path string // path to the field, eg. tss.pairs[2].sensor-topic
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	if e.Path == "" {
+		return e.Err.Error()
+	}
+	return e.Path + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Errors is a list of all configuration problems found
+type Errors []error
+
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// Append adds error to the list, nested Errors are flattened, nil errors are ignored
+func (e *Errors) Append(err error) {
+	if err == nil {
+		return
+	}
+	if errs, ok := err.(Errors); ok {
+		*e = append(*e, errs...)
+		return
+	}
+	*e = append(*e, err)
+}
+
+// Err returns nil when the list is empty
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// FieldErr creates error of the field at path, empty path means the value itself
+func FieldErr(path string, err error) error {
+	return &FieldError{Path: path, Err: err}
+}
+
+// WithPath prefixes path(s) of the error by path of the parent value, eg. schedulers[1]
+func WithPath(path string, err error) error {
+	return withPath(path, err)
+}
+
+// prefix error path(s) by path of the parent value
+func withPath(path string, err error) error {
+	if err == nil || path == "" {
+		return err
+	}
+
+	switch e := err.(type) {
+	case Errors:
+		result := make(Errors, len(e))
+		for i, nested := range e {
+			result[i] = withPath(path, nested)
+		}
+		return result
+	case *FieldError:
+		return &FieldError{Path: joinPath(path, e.Path), Err: e.Err}
+	default:
+		return &FieldError{Path: path, Err: err}
+	}
+}
+
+func joinPath(parent string, child string) string {
+	if parent == "" {
+		return child
+	} else if child == "" {
+		return parent
+	} else if strings.HasPrefix(child, "[") {
+		return parent + child
+	}
+	return parent + "." + child
+}
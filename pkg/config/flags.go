@@ -0,0 +1,40 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+)
+
+// Flags applies configuration values to the command line flags, flags set on the command line take precedence
+type Flags struct {
+	set map[string]bool
+}
+
+// CommandLineFlags captures flags set on the command line, call it right after flag.Parse
+func CommandLineFlags() *Flags {
+	set := map[string]bool{}
+	flag.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	return &Flags{set: set}
+}
+
+// IsSet reports whether the flag was set on the command line
+func (f *Flags) IsSet(name string) bool {
+	return f.set[name]
+}
+
+// Apply sets configuration value to the flag unless it was set on the command line, empty value means flag default
+func (f *Flags) Apply(name string, value string) error {
+	if f.set[name] {
+		return nil
+	}
+	fl := flag.Lookup(name)
+	if fl == nil {
+		return fmt.Errorf("unknown flag %s", name)
+	}
+	if value == "" {
+		value = fl.DefValue
+	}
+	return fl.Value.Set(value)
+}
@@ -0,0 +1,405 @@
+// Package ical reads events of iCalendar (.ics) files and expands their recurrences.
+//
+// Only the subset used by calendar applications for plain events is supported: VEVENT with DTSTART, DTEND or
+// DURATION, SUMMARY, RRULE (FREQ, INTERVAL, COUNT, UNTIL and BYDAY of weekly rules), EXDATE and RECURRENCE-ID
+// (the moved instance replaces the occurrence of the recurring event). Components nested in the event, eg. VALARM,
+// are ignored, events using unsupported features are skipped. TZID parameters must be IANA time zone names, floating
+// times are read in the given local time zone.
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Recurrence frequencies
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// recurrences of an event are expanded at most up to this number of periods
+const maxPeriods = 100000
+
+// Event is a calendar event, dates of all day events are midnights in UTC
+type Event struct {
+	UID     string
+	Summary string
+	Start   time.Time
+	End     time.Time // exclusive
+	AllDay  bool
+	Rule    *Recurrence
+	ExDates []time.Time // starts of excluded occurrences
+}
+
+// Recurrence is the RRULE of an event
+type Recurrence struct {
+	Freq     string
+	Interval int
+	Count    int       // number of occurrences, unlimited when 0
+	Until    time.Time // last possible start, unlimited when zero
+	ByDay    []time.Weekday
+}
+
+// Occurrence is a single occurrence of an event
+type Occurrence struct {
+	Start time.Time
+	End   time.Time // exclusive
+}
+
+var weekdays = map[string]time.Weekday{
+	"SU": time.Sunday, "MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday, "FR": time.Friday, "SA": time.Saturday,
+}
+
+// ParseFile reads events of the iCalendar file
+func ParseFile(path string, local *time.Location) ([]Event, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return Parse(file, local)
+}
+
+// Parse reads events of the iCalendar stream, events using unsupported features are skipped with a warning
+//
+//	in: local - time zone of floating times
+func Parse(r io.Reader, local *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var event *Event
+	var hasEnd bool
+	var duration time.Duration
+	var recurrenceID time.Time
+	var eventErr error
+	nested := 0                       // depth of components within the event, eg. VALARM
+	moved := map[string][]time.Time{} // key: UID, value: recurrence ids of the instances moved by RECURRENCE-ID
+	for number, line := range lines {
+		name, params, value, err := parseLine(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number+1, err)
+		}
+		switch {
+		case name == "BEGIN" && value == "VEVENT" && event == nil:
+			event, hasEnd, duration, recurrenceID, eventErr, nested = &Event{}, false, 0, time.Time{}, nil, 0
+			continue
+		case event == nil:
+			continue
+		case name == "BEGIN":
+			nested++
+			continue
+		case name == "END" && nested > 0:
+			nested--
+			continue
+		case nested > 0:
+			// properties of nested components, eg. SUMMARY of VALARM
+			continue
+		case name == "END" && value == "VEVENT":
+			if eventErr == nil && event.Start.IsZero() {
+				eventErr = errors.New("without DTSTART")
+			}
+			if eventErr != nil {
+				log.Printf("Warning! Calendar event %q skipped: %v", event.Summary, eventErr)
+				event = nil
+				continue
+			}
+			if !hasEnd {
+				event.End = event.Start.Add(duration)
+				if event.AllDay && duration == 0 {
+					event.End = event.Start.AddDate(0, 0, 1)
+				}
+			}
+			if !recurrenceID.IsZero() {
+				// the moved instance replaces the occurrence of the recurring event
+				moved[event.UID] = append(moved[event.UID], recurrenceID)
+				event.Rule = nil
+			}
+			events = append(events, *event)
+			event = nil
+			continue
+		case eventErr != nil:
+			// the first error of the event is reported
+			continue
+		}
+
+		switch name {
+		case "UID":
+			event.UID = value
+		case "SUMMARY":
+			event.Summary = unescape(value)
+		case "DTSTART":
+			if event.Start, event.AllDay, err = parseTime(value, params, local); err != nil {
+				eventErr = fmt.Errorf("line %d: DTSTART: %w", number+1, err)
+			}
+		case "DTEND":
+			if event.End, _, err = parseTime(value, params, local); err != nil {
+				eventErr = fmt.Errorf("line %d: DTEND: %w", number+1, err)
+			}
+			hasEnd = true
+		case "DURATION":
+			if duration, err = parseDuration(value); err != nil {
+				eventErr = fmt.Errorf("line %d: DURATION: %w", number+1, err)
+			}
+		case "RRULE":
+			if event.Rule, err = parseRecurrence(value, local); err != nil {
+				eventErr = fmt.Errorf("line %d: RRULE: %w", number+1, err)
+			}
+		case "RECURRENCE-ID":
+			if recurrenceID, _, err = parseTime(value, params, local); err != nil {
+				eventErr = fmt.Errorf("line %d: RECURRENCE-ID: %w", number+1, err)
+			}
+		case "EXDATE":
+			for _, exDate := range strings.Split(value, ",") {
+				excluded, _, err := parseTime(exDate, params, local)
+				if err != nil {
+					eventErr = fmt.Errorf("line %d: EXDATE: %w", number+1, err)
+					break
+				}
+				event.ExDates = append(event.ExDates, excluded)
+			}
+		}
+	}
+	for i := range events {
+		if events[i].Rule != nil {
+			events[i].ExDates = append(events[i].ExDates, moved[events[i].UID]...)
+		}
+	}
+	return events, nil
+}
+
+// Occurrences returns occurrences of the event overlapping [from, until)
+func (e Event) Occurrences(from time.Time, until time.Time) []Occurrence {
+	duration := e.End.Sub(e.Start)
+	overlaps := func(start time.Time) bool {
+		return start.Before(until) && start.Add(duration).After(from)
+	}
+	if e.Rule == nil {
+		if overlaps(e.Start) {
+			return []Occurrence{{Start: e.Start, End: e.End}}
+		}
+		return nil
+	}
+
+	var occurrences []Occurrence
+	count := 0
+	for period := 0; period < maxPeriods; period++ {
+		for _, start := range e.Rule.periodStarts(e.Start, period) {
+			if start.Before(e.Start) {
+				continue
+			}
+			count++
+			if e.Rule.Count > 0 && count > e.Rule.Count || !e.Rule.Until.IsZero() && start.After(e.Rule.Until) || !start.Before(until) {
+				return occurrences
+			}
+			if !e.excluded(start) && overlaps(start) {
+				occurrences = append(occurrences, Occurrence{Start: start, End: start.Add(duration)})
+			}
+		}
+	}
+	return occurrences
+}
+
+func (e Event) excluded(start time.Time) bool {
+	for _, exDate := range e.ExDates {
+		if exDate.Equal(start) || e.AllDay && exDate.Format("20060102") == start.Format("20060102") {
+			return true
+		}
+	}
+	return false
+}
+
+// Get candidate starts of the recurrence period, wall clock time of the first start is kept
+func (r *Recurrence) periodStarts(first time.Time, period int) []time.Time {
+	step := period * r.Interval
+	year, month, day := first.Date()
+	hour, min, sec := first.Clock()
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, hour, min, sec, 0, first.Location())
+	}
+
+	switch r.Freq {
+	case Daily:
+		return []time.Time{date(year, month, day+step)}
+	case Weekly:
+		if len(r.ByDay) == 0 {
+			return []time.Time{date(year, month, day+7*step)}
+		}
+		// weeks start on Monday
+		monday := day + 7*step - (int(first.Weekday())+6)%7
+		var starts []time.Time
+		for _, weekday := range r.ByDay {
+			starts = append(starts, date(year, month, monday+(int(weekday)+6)%7))
+		}
+		return starts
+	case Monthly:
+		// months without the day are skipped
+		if start := date(year, month+time.Month(step), day); start.Day() == day {
+			return []time.Time{start}
+		}
+	case Yearly:
+		if start := date(year+step, month, day); start.Day() == day {
+			return []time.Time{start}
+		}
+	}
+	return nil
+}
+
+// Join folded lines, continuation lines start with a space or tab
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+// Split content line, eg. DTSTART;TZID=Europe/Prague:20231223T180000
+func parseLine(line string) (string, map[string]string, string, error) {
+	// the value starts after the first colon outside of quoted parameter values
+	separator, quoted := -1, false
+	for i, char := range line {
+		if char == '"' {
+			quoted = !quoted
+		} else if char == ':' && !quoted {
+			separator = i
+			break
+		}
+	}
+	if separator < 0 {
+		return "", nil, "", fmt.Errorf("invalid content line %q", line)
+	}
+
+	parts := strings.Split(line[:separator], ";")
+	params := map[string]string{}
+	for _, param := range parts[1:] {
+		if key, value, found := strings.Cut(param, "="); found {
+			params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return strings.ToUpper(parts[0]), params, line[separator+1:], nil
+}
+
+func unescape(value string) string {
+	return strings.NewReplacer(`\\`, `\`, `\;`, `;`, `\,`, `,`, `\n`, "\n", `\N`, "\n").Replace(value)
+}
+
+// Parse DATE or DATE-TIME value
+//
+//	out: time; bool - true if the value is a date
+func parseTime(value string, params map[string]string, local *time.Location) (time.Time, bool, error) {
+	if params["VALUE"] == "DATE" || len(value) == len("20060102") {
+		t, err := time.Parse("20060102", value)
+		return t, true, err
+	}
+	if strings.HasSuffix(value, "Z") {
+		t, err := time.Parse("20060102T150405Z", value)
+		return t, false, err
+	}
+
+	location := local
+	if tzid := params["TZID"]; tzid != "" {
+		var err error
+		if location, err = time.LoadLocation(tzid); err != nil {
+			return time.Time{}, false, fmt.Errorf("unknown time zone %q", tzid)
+		}
+	}
+	t, err := time.ParseInLocation("20060102T150405", value, location)
+	return t, false, err
+}
+
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// Parse duration, eg. PT1H30M or P1D
+func parseDuration(value string) (time.Duration, error) {
+	match := durationPattern.FindStringSubmatch(value)
+	if match == nil || value == "P" || strings.HasSuffix(value, "T") {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	var duration time.Duration
+	for i, unit := range []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second} {
+		if match[i+2] != "" {
+			n, _ := strconv.Atoi(match[i+2])
+			duration += time.Duration(n) * unit
+		}
+	}
+	if match[1] == "-" {
+		duration = -duration
+	}
+	return duration, nil
+}
+
+// Parse RRULE value, eg. FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20240101T000000Z
+func parseRecurrence(value string, local *time.Location) (*Recurrence, error) {
+	rule := &Recurrence{Interval: 1}
+	for _, part := range strings.Split(value, ";") {
+		key, value, _ := strings.Cut(part, "=")
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			rule.Freq = strings.ToUpper(value)
+		case "INTERVAL":
+			if rule.Interval, err = strconv.Atoi(value); err == nil && rule.Interval < 1 {
+				err = errors.New("must be positive")
+			}
+		case "COUNT":
+			rule.Count, err = strconv.Atoi(value)
+		case "UNTIL":
+			rule.Until, _, err = parseTime(value, nil, local)
+			if err == nil && len(value) == len("20060102") {
+				// date of the last occurrence is inclusive
+				rule.Until = rule.Until.AddDate(0, 0, 1).Add(-time.Second)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, exist := weekdays[strings.ToUpper(day)]
+				if !exist {
+					return nil, fmt.Errorf("unsupported BYDAY %q", day)
+				}
+				rule.ByDay = append(rule.ByDay, weekday)
+			}
+			sort.Slice(rule.ByDay, func(i, j int) bool {
+				return (rule.ByDay[i]+6)%7 < (rule.ByDay[j]+6)%7
+			})
+		case "WKST":
+		default:
+			return nil, fmt.Errorf("unsupported rule part %s", key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", key, err)
+		}
+	}
+
+	switch rule.Freq {
+	case Daily, Weekly, Monthly, Yearly:
+	default:
+		return nil, fmt.Errorf("unsupported frequency %q", rule.Freq)
+	}
+	if len(rule.ByDay) > 0 && rule.Freq != Weekly {
+		return nil, fmt.Errorf("BYDAY is supported by weekly rules only")
+	}
+	return rule, nil
+}
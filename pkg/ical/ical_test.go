@@ -0,0 +1,201 @@
+package ical
+
+import (
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+const testCalendar = `BEGIN:VCALENDAR
+VERSION:2.0
+PRODID:-//test//EN
+BEGIN:VEVENT
+UID:guests@example.com
+SUMMARY:Guests in the guest room\, grandparents
+DTSTART;VALUE=DATE:20231223
+DTEND;VALUE=DATE:20231227
+END:VEVENT
+BEGIN:VEVENT
+UID:yoga@example.com
+SUMMARY:Yoga
+DTSTART;TZID=Europe/Prague:20231002T180000
+DURATION:PT1H30M
+RRULE:FREQ=WEEKLY;BYDAY=MO,WE;UNTIL=20231031T000000Z
+EXDATE;TZID=Europe/Prague:20231004T180000
+END:VEVENT
+BEGIN:VEVENT
+UID:cleaning@example.com
+SUMMARY:Cleaning
+DTSTART:20240131T080000
+DTEND:20240131T
+ 100000
+RRULE:FREQ=MONTHLY;COUNT=3
+END:VEVENT
+BEGIN:VEVENT
+UID:birthday@example.com
+SUMMARY:Birthday
+DTSTART;VALUE=DATE:20200510
+RRULE:FREQ=YEARLY
+END:VEVENT
+END:VCALENDAR
+`
+
+func TestParse(t *testing.T) {
+	events, err := Parse(strings.NewReader(testCalendar), time.UTC)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if len(events) != 4 {
+		t.Fatalf("Parse() events = %d, want 4", len(events))
+	}
+
+	guests := events[0]
+	if guests.Summary != "Guests in the guest room, grandparents" || !guests.AllDay || !guests.Start.Equal(time.Date(2023, 12, 23, 0, 0, 0, 0, time.UTC)) || !guests.End.Equal(time.Date(2023, 12, 27, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Parse() all day event = %+v", guests)
+	}
+	prague, _ := time.LoadLocation("Europe/Prague")
+	yoga := events[1]
+	if !yoga.Start.Equal(time.Date(2023, 10, 2, 18, 0, 0, 0, prague)) || yoga.End.Sub(yoga.Start) != 90*time.Minute || yoga.Rule.Freq != Weekly || len(yoga.Rule.ByDay) != 2 {
+		t.Errorf("Parse() recurring event = %+v", yoga)
+	}
+	if cleaning := events[2]; cleaning.End.Sub(cleaning.Start) != 2*time.Hour {
+		t.Errorf("Parse() folded DTEND = %v", cleaning.End)
+	}
+	if birthday := events[3]; birthday.End.Sub(birthday.Start) != 24*time.Hour {
+		t.Errorf("Parse() all day event without DTEND should last a day, got %v", birthday.End)
+	}
+}
+
+func TestOccurrences(t *testing.T) {
+	events, err := Parse(strings.NewReader(testCalendar), time.UTC)
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	prague, _ := time.LoadLocation("Europe/Prague")
+
+	tests := []struct {
+		name   string
+		event  Event
+		from   time.Time
+		until  time.Time
+		starts []time.Time
+	}{
+		{"single", events[0], time.Date(2023, 12, 26, 12, 0, 0, 0, time.UTC), time.Date(2023, 12, 30, 0, 0, 0, 0, time.UTC), []time.Time{time.Date(2023, 12, 23, 0, 0, 0, 0, time.UTC)}},
+		{"single outside", events[0], time.Date(2023, 12, 27, 0, 0, 0, 0, time.UTC), time.Date(2023, 12, 30, 0, 0, 0, 0, time.UTC), nil},
+		{
+			// EXDATE removes Wednesday, DST ends on 2023-10-29, wall clock time is kept
+			"weekly", events[1], time.Date(2023, 10, 1, 0, 0, 0, 0, prague), time.Date(2023, 10, 9, 0, 0, 0, 0, prague),
+			[]time.Time{time.Date(2023, 10, 2, 18, 0, 0, 0, prague)},
+		},
+		{
+			"weekly until", events[1], time.Date(2023, 10, 28, 0, 0, 0, 0, prague), time.Date(2023, 11, 10, 0, 0, 0, 0, prague),
+			[]time.Time{time.Date(2023, 10, 30, 18, 0, 0, 0, prague)},
+		},
+		{
+			// February doesn't have the 31st, COUNT counts the existing months only
+			"monthly", events[2], time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+			[]time.Time{time.Date(2024, 1, 31, 8, 0, 0, 0, time.UTC), time.Date(2024, 3, 31, 8, 0, 0, 0, time.UTC), time.Date(2024, 5, 31, 8, 0, 0, 0, time.UTC)},
+		},
+		{"yearly", events[3], time.Date(2024, 5, 10, 23, 0, 0, 0, time.UTC), time.Date(2024, 5, 12, 0, 0, 0, 0, time.UTC), []time.Time{time.Date(2024, 5, 10, 0, 0, 0, 0, time.UTC)}},
+	}
+	for _, tt := range tests {
+		occurrences := tt.event.Occurrences(tt.from, tt.until)
+		var starts []time.Time
+		for _, occurrence := range occurrences {
+			starts = append(starts, occurrence.Start)
+		}
+		if len(starts) != len(tt.starts) {
+			t.Errorf("%s: Occurrences() = %v, want %v", tt.name, starts, tt.starts)
+			continue
+		}
+		for i := range starts {
+			if !starts[i].Equal(tt.starts[i]) {
+				t.Errorf("%s: Occurrences() = %v, want %v", tt.name, starts, tt.starts)
+			}
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	if _, err := Parse(strings.NewReader("BEGIN:VEVENT\nSUMMARY\nEND:VEVENT\n"), time.UTC); err == nil || !strings.Contains(err.Error(), "line 2: invalid content line") {
+		t.Errorf("Parse() error = %v, want invalid content line", err)
+	}
+}
+
+func TestParseSkipsUnsupportedEvents(t *testing.T) {
+	for name, event := range map[string]string{
+		"missing start":         "SUMMARY:x\n",
+		"bad rule":              "DTSTART:20240101T080000\nRRULE:FREQ=HOURLY\n",
+		"unsupported rule part": "DTSTART:20240101T080000\nRRULE:FREQ=MONTHLY;BYMONTHDAY=1\n",
+		"unsupported BYDAY":     "DTSTART:20240101T080000\nRRULE:FREQ=MONTHLY;BYDAY=2SU\n",
+		"bad time zone":         "DTSTART;TZID=Nowhere:20240101T080000\n",
+		"bad duration":          "DTSTART:20240101T080000\nDURATION:1H\n",
+	} {
+		calendar := "BEGIN:VEVENT\n" + event + "END:VEVENT\nBEGIN:VEVENT\nSUMMARY:Yoga\nDTSTART:20240101T180000\nEND:VEVENT\n"
+		events, err := Parse(strings.NewReader(calendar), time.UTC)
+		if err != nil || len(events) != 1 || events[0].Summary != "Yoga" {
+			t.Errorf("%s: Parse() = %+v, %v, want the supported event only", name, events, err)
+		}
+	}
+}
+
+func TestParseNestedComponents(t *testing.T) {
+	calendar := `BEGIN:VEVENT
+SUMMARY:Yoga
+DTSTART:20240101T180000
+BEGIN:VALARM
+ACTION:EMAIL
+SUMMARY:Reminder
+DURATION:PT15M
+TRIGGER:-PT30M
+END:VALARM
+DURATION:PT1H
+END:VEVENT
+`
+	events, err := Parse(strings.NewReader(calendar), time.UTC)
+	if err != nil || len(events) != 1 {
+		t.Fatalf("Parse() = %+v, %v", events, err)
+	}
+	if events[0].Summary != "Yoga" || events[0].End.Sub(events[0].Start) != time.Hour {
+		t.Errorf("Parse() properties of the alarm should be ignored, got %+v", events[0])
+	}
+}
+
+func TestRecurrenceID(t *testing.T) {
+	// the second occurrence moved from 18:00 to 19:00, the moved instance may precede the recurring event
+	calendar := `BEGIN:VEVENT
+UID:yoga@example.com
+SUMMARY:Yoga
+RECURRENCE-ID:20240108T180000
+DTSTART:20240108T190000
+DURATION:PT1H
+END:VEVENT
+BEGIN:VEVENT
+UID:yoga@example.com
+SUMMARY:Yoga
+DTSTART:20240101T180000
+DURATION:PT1H
+RRULE:FREQ=WEEKLY;COUNT=3
+END:VEVENT
+`
+	events, err := Parse(strings.NewReader(calendar), time.UTC)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("Parse() = %+v, %v", events, err)
+	}
+	var starts []time.Time
+	for _, event := range events {
+		for _, occurrence := range event.Occurrences(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)) {
+			starts = append(starts, occurrence.Start)
+		}
+	}
+	want := []time.Time{time.Date(2024, 1, 8, 19, 0, 0, 0, time.UTC), time.Date(2024, 1, 1, 18, 0, 0, 0, time.UTC), time.Date(2024, 1, 15, 18, 0, 0, 0, time.UTC)}
+	if len(starts) != len(want) {
+		t.Fatalf("Occurrences() = %v, want %v", starts, want)
+	}
+	for i := range starts {
+		if !starts[i].Equal(want[i]) {
+			t.Errorf("Occurrences() = %v, want %v", starts, want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+// Package metrics exposes gauges, counters and histograms in the Prometheus text format.
+//
+// It covers the small subset of Prometheus client features the services need without pulling in its dependencies.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry holds metrics exposed by the handler
+type Registry struct {
+	mu         sync.Mutex
+	collectors []collector
+}
+
+type collector interface {
+	write(w io.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.collectors = append(r.collectors, c)
+}
+
+// Handler serves metrics in the Prometheus text format
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Expose(w)
+	})
+}
+
+// Expose writes all metrics in the Prometheus text format
+func (r *Registry) Expose(w io.Writer) {
+	r.mu.Lock()
+	collectors := append([]collector{}, r.collectors...)
+	r.mu.Unlock()
+
+	for _, c := range collectors {
+		c.write(w)
+	}
+}
+
+// desc is a metric name, help and label names
+type desc struct {
+	name   string
+	help   string
+	kind   string
+	labels []string
+}
+
+func (d desc) writeHeader(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.name, d.help, d.name, d.kind)
+}
+
+func (d desc) key(labelValues []string) string {
+	if len(labelValues) != len(d.labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.name, len(d.labels), len(labelValues)))
+	}
+	return strings.Join(labelValues, "\xff")
+}
+
+func (d desc) writeSample(w io.Writer, suffix string, labelValues []string, extraLabels string, value float64) {
+	pairs := make([]string, 0, len(labelValues)+1)
+	for i, label := range d.labels {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", label, escape(labelValues[i])))
+	}
+	if extraLabels != "" {
+		pairs = append(pairs, extraLabels)
+	}
+
+	labels := ""
+	if len(pairs) > 0 {
+		labels = "{" + strings.Join(pairs, ",") + "}"
+	}
+	fmt.Fprintf(w, "%s%s%s %s\n", d.name, suffix, labels, formatValue(value))
+}
+
+func escape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	case math.IsNaN(value):
+		return "NaN"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+// vec holds values of a metric per label values
+type vec struct {
+	desc
+	mu     sync.Mutex
+	values map[string]float64
+	labels map[string][]string
+}
+
+func newVec(d desc) *vec {
+	return &vec{desc: d, values: map[string]float64{}, labels: map[string][]string{}}
+}
+
+func (v *vec) update(labelValues []string, fn func(value float64) float64) {
+	key := v.key(labelValues)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.values[key] = fn(v.values[key])
+	v.labels[key] = append([]string{}, labelValues...)
+}
+
+// Delete removes the series with given label values
+func (v *vec) Delete(labelValues ...string) {
+	key := v.key(labelValues)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	delete(v.values, key)
+	delete(v.labels, key)
+}
+
+func (v *vec) write(w io.Writer) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	v.writeHeader(w)
+	keys := make([]string, 0, len(v.values))
+	for key := range v.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		v.writeSample(w, "", v.labels[key], "", v.values[key])
+	}
+}
+
+// Gauge is a value that can go up and down
+type Gauge struct {
+	*vec
+}
+
+func (r *Registry) NewGauge(name string, help string, labels ...string) *Gauge {
+	g := &Gauge{newVec(desc{name: name, help: help, kind: "gauge", labels: labels})}
+	r.register(g)
+	return g
+}
+
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.update(labelValues, func(float64) float64 { return value })
+}
+
+// Counter is a monotonically increasing value
+type Counter struct {
+	*vec
+}
+
+func (r *Registry) NewCounter(name string, help string, labels ...string) *Counter {
+	c := &Counter{newVec(desc{name: name, help: help, kind: "counter", labels: labels})}
+	r.register(c)
+	return c
+}
+
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(delta float64, labelValues ...string) {
+	c.update(labelValues, func(value float64) float64 { return value + delta })
+}
+
+// GaugeFunc is a gauge computed on every scrape
+type GaugeFunc struct {
+	desc
+	collect func(emit func(value float64, labelValues ...string))
+}
+
+// NewGaugeFunc registers gauge whose series are emitted by collect on every scrape
+func (r *Registry) NewGaugeFunc(name string, help string, labels []string, collect func(emit func(value float64, labelValues ...string))) *GaugeFunc {
+	g := &GaugeFunc{desc: desc{name: name, help: help, kind: "gauge", labels: labels}, collect: collect}
+	r.register(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w io.Writer) {
+	g.writeHeader(w)
+	g.collect(func(value float64, labelValues ...string) {
+		g.key(labelValues) // check label values count
+		g.writeSample(w, "", labelValues, "", value)
+	})
+}
+
+// Histogram counts observations in cumulative buckets
+type Histogram struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// NewHistogram registers histogram with given upper bucket bounds (sorted ascending)
+func (r *Registry) NewHistogram(name string, help string, buckets []float64) *Histogram {
+	h := &Histogram{desc: desc{name: name, help: help, kind: "histogram"}, buckets: buckets, counts: make([]uint64, len(buckets))}
+	r.register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.writeHeader(w)
+	for i, bound := range h.buckets {
+		h.writeSample(w, "_bucket", nil, fmt.Sprintf("le=\"%s\"", formatValue(bound)), float64(h.counts[i]))
+	}
+	h.writeSample(w, "_bucket", nil, "le=\"+Inf\"", float64(h.count))
+	h.writeSample(w, "_sum", nil, "", h.sum)
+	h.writeSample(w, "_count", nil, "", float64(h.count))
+}
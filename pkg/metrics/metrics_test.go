@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryTextFormat(t *testing.T) {
+	r := NewRegistry()
+	gauge := r.NewGauge("test_temperature_celsius", "Temperature.", "topic")
+	counter := r.NewCounter("test_publish_total", "Publishes.", "topic", "result")
+	r.NewGaugeFunc("test_connected", "Connection state.", nil, func(emit func(value float64, labelValues ...string)) {
+		emit(1)
+	})
+	histogram := r.NewHistogram("test_tick_duration_seconds", "Tick duration.", []float64{0.1, 1})
+
+	gauge.Set(21.5, "trv1")
+	gauge.Set(20, `trv"2`)
+	gauge.Set(19, "removed")
+	gauge.Delete("removed")
+	counter.Inc("trv1", "success")
+	counter.Inc("trv1", "success")
+	counter.Inc("trv1", "failure")
+	histogram.Observe(0.05)
+	histogram.Observe(0.5)
+
+	var out bytes.Buffer
+	r.Expose(&out)
+	expected := `# HELP test_temperature_celsius Temperature.
+# TYPE test_temperature_celsius gauge
+test_temperature_celsius{topic="trv\"2"} 20
+test_temperature_celsius{topic="trv1"} 21.5
+# HELP test_publish_total Publishes.
+# TYPE test_publish_total counter
+test_publish_total{topic="trv1",result="failure"} 1
+test_publish_total{topic="trv1",result="success"} 2
+# HELP test_connected Connection state.
+# TYPE test_connected gauge
+test_connected 1
+# HELP test_tick_duration_seconds Tick duration.
+# TYPE test_tick_duration_seconds histogram
+test_tick_duration_seconds_bucket{le="0.1"} 1
+test_tick_duration_seconds_bucket{le="1"} 2
+test_tick_duration_seconds_bucket{le="+Inf"} 2
+test_tick_duration_seconds_sum 0.55
+test_tick_duration_seconds_count 2
+`
+	if out.String() != expected {
+		t.Errorf("Expose() =\n%s\nwant\n%s", out.String(), expected)
+	}
+
+	recorder := httptest.NewRecorder()
+	r.Handler().ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/plain") || recorder.Body.String() != expected {
+		t.Errorf("Handler() returned unexpected response: %s", recorder.Body.String())
+	}
+}
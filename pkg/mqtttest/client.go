@@ -0,0 +1,150 @@
+// Package mqtttest provides in-memory MQTT client for tests.
+package mqtttest
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Published is a message published by the client
+type Published struct {
+	Topic    string
+	Qos      byte
+	Retained bool
+	Payload  string
+}
+
+// Client records published messages and subscriptions, messages can be delivered with Deliver
+type Client struct {
+	mu            sync.Mutex
+	Published     []Published
+	Subscriptions map[string]MQTT.MessageHandler
+	PublishErr    error // returned by Publish when set
+}
+
+func NewClient() *Client {
+	return &Client{Subscriptions: map[string]MQTT.MessageHandler{}}
+}
+
+// PublishedTo returns payloads published to the topic
+func (c *Client) PublishedTo(topic string) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	payloads := []string{}
+	for _, published := range c.Published {
+		if published.Topic == topic {
+			payloads = append(payloads, published.Payload)
+		}
+	}
+	return payloads
+}
+
+// Reset forgets published messages
+func (c *Client) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Published = nil
+}
+
+// Deliver calls handler subscribed for the topic
+func (c *Client) Deliver(topic string, payload string) {
+	c.mu.Lock()
+	handler := c.Subscriptions[topic]
+	c.mu.Unlock()
+
+	if handler != nil {
+		handler(c, &Message{topic: topic, payload: []byte(payload)})
+	}
+}
+
+func (c *Client) IsConnected() bool      { return true }
+func (c *Client) IsConnectionOpen() bool { return true }
+func (c *Client) Connect() MQTT.Token    { return &Token{} }
+func (c *Client) Disconnect(uint)        {}
+
+func (c *Client) Publish(topic string, qos byte, retained bool, payload interface{}) MQTT.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.PublishErr != nil {
+		return &Token{err: c.PublishErr}
+	}
+	var payloadStr string
+	switch p := payload.(type) {
+	case string:
+		payloadStr = p
+	case []byte:
+		payloadStr = string(p)
+	default:
+		payloadStr = fmt.Sprintf("%v", p)
+	}
+	c.Published = append(c.Published, Published{Topic: topic, Qos: qos, Retained: retained, Payload: payloadStr})
+	return &Token{}
+}
+
+func (c *Client) Subscribe(topic string, qos byte, callback MQTT.MessageHandler) MQTT.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.Subscriptions[topic] = callback
+	return &Token{}
+}
+
+func (c *Client) SubscribeMultiple(filters map[string]byte, callback MQTT.MessageHandler) MQTT.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for topic := range filters {
+		c.Subscriptions[topic] = callback
+	}
+	return &Token{}
+}
+
+func (c *Client) Unsubscribe(topics ...string) MQTT.Token {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, topic := range topics {
+		delete(c.Subscriptions, topic)
+	}
+	return &Token{}
+}
+
+func (c *Client) AddRoute(topic string, callback MQTT.MessageHandler) {}
+
+func (c *Client) OptionsReader() MQTT.ClientOptionsReader {
+	return MQTT.ClientOptionsReader{}
+}
+
+// Token is already completed token
+type Token struct {
+	err error
+}
+
+func (t *Token) Wait() bool                     { return true }
+func (t *Token) WaitTimeout(time.Duration) bool { return true }
+func (t *Token) Done() <-chan struct{} {
+	done := make(chan struct{})
+	close(done)
+	return done
+}
+func (t *Token) Error() error { return t.err }
+
+// Message is a received message
+type Message struct {
+	topic   string
+	payload []byte
+}
+
+func NewMessage(topic string, payload string) *Message {
+	return &Message{topic: topic, payload: []byte(payload)}
+}
+
+func (m *Message) Duplicate() bool   { return false }
+func (m *Message) Qos() byte         { return 0 }
+func (m *Message) Retained() bool    { return false }
+func (m *Message) Topic() string     { return m.topic }
+func (m *Message) MessageID() uint16 { return 0 }
+func (m *Message) Payload() []byte   { return m.payload }
+func (m *Message) Ack()              {}
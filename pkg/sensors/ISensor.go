@@ -1,5 +1,84 @@
 package sensors
 
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultModel is used when a sync pair doesn't declare its sensor model
+const DefaultModel = SonoffModel
+
+// ISensor is a common view on a decoded sensor payload
 type ISensor interface {
-	getTemperature() float64;
+	GetTemperature() float32
+	GetHumidity() float32
+	GetBattery() float32
+	GetLinkQuality() int
+	// GetTimestamp returns time of the measurement reported by the device, zero time when not reported
+	GetTimestamp() time.Time
+}
+
+// PayloadDecoder converts raw MQTT payload to the sensor data
+type PayloadDecoder func(mqttPayload string) (ISensor, error)
+
+var (
+	decodersMu sync.RWMutex
+	decoders   = map[string]PayloadDecoder{}
+)
+
+// RegisterDecoder registers payload decoder for given sensor model, panics when model is already registered
+func RegisterDecoder(model string, decoder PayloadDecoder) {
+	decodersMu.Lock()
+	defer decodersMu.Unlock()
+
+	if decoder == nil {
+		panic("sensors: RegisterDecoder decoder is nil")
+	}
+	if _, dup := decoders[model]; dup {
+		panic("sensors: RegisterDecoder called twice for model " + model)
+	}
+	decoders[model] = decoder
+}
+
+// GetDecoder returns payload decoder for given sensor model, empty model means DefaultModel
+func GetDecoder(model string) (PayloadDecoder, error) {
+	if model == "" {
+		model = DefaultModel
+	}
+
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+
+	decoder, exist := decoders[model]
+	if !exist {
+		return nil, fmt.Errorf("unknown sensor model %q (known models: %v)", model, models())
+	}
+	return decoder, nil
+}
+
+// DecodePayload decodes MQTT payload using decoder registered for given sensor model
+func DecodePayload(model string, mqttPayload string) (ISensor, error) {
+	decoder, err := GetDecoder(model)
+	if err != nil {
+		return nil, err
+	}
+	return decoder(mqttPayload)
+}
+
+// Models returns sorted list of registered sensor models
+func Models() []string {
+	decodersMu.RLock()
+	defer decodersMu.RUnlock()
+	return models()
+}
+
+func models() []string {
+	models := make([]string, 0, len(decoders))
+	for model := range decoders {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
 }
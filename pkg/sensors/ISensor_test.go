@@ -0,0 +1,40 @@
+package sensors
+
+import (
+	"log"
+	"testing"
+)
+
+func TestDecodePayloadByModel(t *testing.T) {
+	testPayload := "{\"battery\":72.5,\"humidity\":64.75,\"linkquality\":108,\"temperature\":21.44,\"voltage\":2900}"
+
+	// default model is used when model isn't set
+	for _, model := range []string{"", SonoffModel} {
+		sensor, err := DecodePayload(model, testPayload)
+		if err != nil {
+			log.Fatalf("DecodePayload failed for model %q: %v", model, err)
+		}
+		if sensor.GetTemperature() != 21.44 || sensor.GetHumidity() != 64.75 || sensor.GetBattery() != 72.5 || sensor.GetLinkQuality() != 108 {
+			log.Fatalf("DecodePayload returned unexpected values for model %q: %v", model, sensor)
+		}
+	}
+
+	// unknown model
+	if _, err := DecodePayload("unknown-model", testPayload); err == nil {
+		log.Fatalf("DecodePayload should fail for unknown model")
+	}
+
+	// invalid payload
+	if _, err := DecodePayload(SonoffModel, "{ just some invalid text }"); err == nil {
+		log.Fatalf("DecodePayload should fail for invalid payload")
+	}
+}
+
+func TestRegisterDecoderTwicePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			log.Fatalf("RegisterDecoder should panic when model is registered twice")
+		}
+	}()
+	RegisterDecoder(SonoffModel, func(mqttPayload string) (ISensor, error) { return nil, nil })
+}
@@ -1,7 +1,23 @@
 package sensors
 
+import "time"
+
 const ExternalSensorUndefined = -8000
 
+// DanfossModel is the Danfoss Ally eTRV, setpoints 5 - 35°C in 0.5°C steps
+const DanfossModel = "danfoss-ally"
+
+func init() {
+	RegisterTrvModel(DanfossModel, TrvModel{SetpointStep: 0.5, MinSetpoint: 5, MaxSetpoint: 35})
+}
+
+// Danfoss Ally expects the external_measured_room_sensor value to be refreshed at least every 30 minutes
+// when radiator_covered is true and at least every 3 hours otherwise
+const (
+	CoveredRefreshInterval   = 30 * time.Minute
+	UncoveredRefreshInterval = 3 * time.Hour
+)
+
 func GetExternalTempSensorFormat(temperature float32) int {
 	if temperature == ExternalSensorUndefined {
 		return ExternalSensorUndefined
@@ -13,3 +29,11 @@ func GetExternalTempSensorFormat(temperature float32) int {
 		return toReturn
 	}
 }
+
+// Get maximal interval between two external sensor updates for given radiator mode
+func GetRefreshInterval(radiatorCovered bool) time.Duration {
+	if radiatorCovered {
+		return CoveredRefreshInterval
+	}
+	return UncoveredRefreshInterval
+}
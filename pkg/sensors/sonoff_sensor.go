@@ -3,21 +3,51 @@ package sensors
 import (
 	"encoding/json"
 	"errors"
+	"time"
 )
 
+const SonoffModel = "sonoff-snzb-02"
+
 type SonoffTemperatureSensor struct {
-	Battery     float32 `json:"battery"`
-	Humidity    float32 `json:"humidity"`
-	Linkquality int     `json:"linkquality"`
-	Temperature float32 `json:"temperature"`
-	Voltage     int     `json:"voltage"`
+	Battery     float32   `json:"battery"`
+	Humidity    float32   `json:"humidity"`
+	Linkquality int       `json:"linkquality"`
+	Temperature float32   `json:"temperature"`
+	Voltage     int       `json:"voltage"`
+	LastSeen    Timestamp `json:"last_seen,omitempty"`
+}
+
+func init() {
+	RegisterDecoder(SonoffModel, func(mqttPayload string) (ISensor, error) {
+		sns, err := SonoffSensorPayloadToStruct(mqttPayload)
+		if err != nil {
+			return nil, err
+		}
+		return &sns, nil
+	})
 }
 
 // ISensor interface
-func getTemperature(s *SonoffTemperatureSensor) float32 {
+func (s *SonoffTemperatureSensor) GetTemperature() float32 {
 	return s.Temperature
 }
 
+func (s *SonoffTemperatureSensor) GetHumidity() float32 {
+	return s.Humidity
+}
+
+func (s *SonoffTemperatureSensor) GetBattery() float32 {
+	return s.Battery
+}
+
+func (s *SonoffTemperatureSensor) GetLinkQuality() int {
+	return s.Linkquality
+}
+
+func (s *SonoffTemperatureSensor) GetTimestamp() time.Time {
+	return s.LastSeen.Time()
+}
+
 func SonoffSensorPayloadToStruct(mqttPayload string) (SonoffTemperatureSensor, error) {
 	var sns SonoffTemperatureSensor
 	err := json.Unmarshal([]byte(mqttPayload), &sns)
@@ -7,7 +7,7 @@ import (
 
 func TestIfPayloadParsedCorrectly(t *testing.T) {
 	testPayload := "{\"battery\":72.5,\"humidity\":64.75,\"linkquality\":108,\"temperature\":21.44,\"voltage\":2900}"
-	
+
 	// success
 	expected := SonoffTemperatureSensor{
 		Battery:     72.5,
@@ -22,7 +22,7 @@ func TestIfPayloadParsedCorrectly(t *testing.T) {
 	if err != nil || result != expected {
 		log.Fatalf("Sonoff payload parsing failed- should be fine")
 	}
-	
+
 	// failed
 	testPayload = "{ just some invalid text }"
 	_, err = SonoffSensorPayloadToStruct(testPayload)
@@ -30,3 +30,26 @@ func TestIfPayloadParsedCorrectly(t *testing.T) {
 		log.Fatalf("Sonoff payload parsing failed - should be err")
 	}
 }
+
+func TestIfPayloadWithLastSeenParsedCorrectly(t *testing.T) {
+	testPayloads := map[string]int64{
+		"{\"temperature\":21.44,\"last_seen\":1675512000000}":                 1675512000000,
+		"{\"temperature\":21.44,\"last_seen\":\"2023-02-04T12:00:00Z\"}":      1675512000000,
+		"{\"temperature\":21.44,\"last_seen\":\"2023-02-04T13:00:00+01:00\"}": 1675512000000,
+	}
+
+	for payload, expected := range testPayloads {
+		result, err := SonoffSensorPayloadToStruct(payload)
+		if err != nil {
+			log.Fatalf("Sonoff payload parsing failed (%s): %v", payload, err)
+		}
+		if result.GetTimestamp().UnixMilli() != expected {
+			log.Fatalf("Sonoff last seen parsing failed (%s), expected: %d, got: %d", payload, expected, result.GetTimestamp().UnixMilli())
+		}
+	}
+
+	result, _ := SonoffSensorPayloadToStruct("{\"temperature\":21.44}")
+	if !result.GetTimestamp().IsZero() {
+		log.Fatalf("Sonoff last seen should be zero when not reported")
+	}
+}
@@ -0,0 +1,46 @@
+package sensors
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Timestamp is a Zigbee2MQTT `last_seen` value stored as unix milliseconds.
+// Zigbee2MQTT reports it either as epoch number or as ISO 8601 string, depending on its configuration.
+type Timestamp int64
+
+func (t *Timestamp) UnmarshalJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	switch v := value.(type) {
+	case nil:
+		*t = 0
+	case float64:
+		*t = Timestamp(v)
+	case string:
+		parsed, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			// ISO_8601_local format doesn't contain zone offset
+			parsed, err = time.ParseInLocation("2006-01-02T15:04:05", v, time.Local)
+			if err != nil {
+				return fmt.Errorf("invalid timestamp %q", v)
+			}
+		}
+		*t = Timestamp(parsed.UnixMilli())
+	default:
+		return fmt.Errorf("invalid timestamp %s", string(data))
+	}
+	return nil
+}
+
+// Time converts timestamp to time, zero time when timestamp isn't set
+func (t Timestamp) Time() time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(int64(t))
+}
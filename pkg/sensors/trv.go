@@ -0,0 +1,64 @@
+package sensors
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// DefaultTrvModel is used when a scheduler doesn't declare its TRV model
+const DefaultTrvModel = DanfossModel
+
+// TrvModel describes setpoints accepted by a TRV
+type TrvModel struct {
+	SetpointStep float64 `json:"step"` // eg. 0.5 for half degree steps
+	MinSetpoint  float64 `json:"min"`
+	MaxSetpoint  float64 `json:"max"`
+}
+
+var (
+	trvModelsMu sync.RWMutex
+	trvModels   = map[string]TrvModel{}
+)
+
+// RegisterTrvModel registers TRV model, panics when model is already registered
+func RegisterTrvModel(name string, model TrvModel) {
+	trvModelsMu.Lock()
+	defer trvModelsMu.Unlock()
+
+	if _, dup := trvModels[name]; dup {
+		panic("sensors: RegisterTrvModel called twice for model " + name)
+	}
+	trvModels[name] = model
+}
+
+// GetTrvModel returns registered TRV model, empty name means DefaultTrvModel
+func GetTrvModel(name string) (TrvModel, error) {
+	if name == "" {
+		name = DefaultTrvModel
+	}
+
+	trvModelsMu.RLock()
+	defer trvModelsMu.RUnlock()
+
+	model, exist := trvModels[name]
+	if !exist {
+		names := make([]string, 0, len(trvModels))
+		for name := range trvModels {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return TrvModel{}, fmt.Errorf("unknown TRV model %q (known models: %v)", name, names)
+	}
+	return model, nil
+}
+
+// RoundSetpoint rounds temperature to the setpoint step of the model, zero step keeps the temperature
+func (m TrvModel) RoundSetpoint(temperature float64) float64 {
+	if m.SetpointStep <= 0 {
+		return temperature
+	}
+	// dividing by steps per degree keeps 0.1 steps exact (20.3, not 20.300000000000001)
+	return math.Round(temperature/m.SetpointStep) / (1 / m.SetpointStep)
+}
@@ -0,0 +1,37 @@
+package sensors
+
+import (
+	"log"
+	"testing"
+)
+
+func TestRoundSetpoint(t *testing.T) {
+	model, err := GetTrvModel("")
+	if err != nil {
+		log.Fatalf("GetTrvModel failed for default model: %v", err)
+	}
+
+	testData := map[float64]float64{
+		20.5:  20.5,
+		20.74: 20.5,
+		20.75: 21,
+		21.2:  21,
+		22:    22,
+	}
+	for temperature, expected := range testData {
+		if result := model.RoundSetpoint(temperature); result != expected {
+			log.Fatalf("RoundSetpoint(%v) = %v, expected %v", temperature, result, expected)
+		}
+	}
+
+	if result := (TrvModel{SetpointStep: 0.1}).RoundSetpoint(20.31); result != 20.3 {
+		log.Fatalf("RoundSetpoint with 0.1 step = %v, expected 20.3", result)
+	}
+	if result := (TrvModel{}).RoundSetpoint(20.31); result != 20.31 {
+		log.Fatalf("RoundSetpoint without step = %v, expected 20.31", result)
+	}
+
+	if _, err := GetTrvModel("unknown-trv"); err == nil {
+		log.Fatalf("GetTrvModel should fail for unknown model")
+	}
+}
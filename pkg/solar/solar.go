@@ -0,0 +1,86 @@
+// Package solar computes sunrise and sunset times locally, using the NOAA solar calculator equations.
+//
+// Times are accurate to about a minute between the polar circles and within a few minutes near them.
+package solar
+
+import (
+	"math"
+	"time"
+)
+
+// zenith of the sun at sunrise and sunset, includes atmospheric refraction and the radius of the sun
+const zenith = 90.833
+
+// Sun returns sunrise and sunset of the date at given location, the date is the local day around its solar noon
+//
+//	in: latitude - degrees, north positive; longitude - degrees, east positive
+//	out: sunrise and sunset in UTC; bool - false if the sun doesn't rise or set that day (polar day or night)
+func Sun(year int, month time.Month, day int, latitude float64, longitude float64) (time.Time, time.Time, bool) {
+	midnight := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	// the sun is evaluated at the local solar noon, then once again at sunrise and sunset
+	noon := midnight.Add(time.Duration((720 - 4*longitude) * float64(time.Minute)))
+	var times [2]time.Time
+	for i, sign := range []float64{-1, 1} {
+		t := noon
+		for iteration := 0; iteration < 2; iteration++ {
+			declination, equationOfTime := position(t)
+			hourAngle, ok := sunriseHourAngle(latitude, declination)
+			if !ok {
+				return time.Time{}, time.Time{}, false
+			}
+			minutes := 720 - 4*longitude - equationOfTime + sign*4*hourAngle
+			t = midnight.Add(time.Duration(minutes * float64(time.Minute))).Round(time.Second)
+		}
+		times[i] = t
+	}
+	return times[0], times[1], true
+}
+
+// Get declination of the sun (degrees) and the equation of time (minutes) at given time
+func position(t time.Time) (float64, float64) {
+	julianDay := float64(t.Unix())/86400 + 2440587.5
+	century := (julianDay - 2451545) / 36525
+
+	meanLongitude := math.Mod(280.46646+century*(36000.76983+century*0.0003032), 360)
+	meanAnomaly := 357.52911 + century*(35999.05029-0.0001537*century)
+	eccentricity := 0.016708634 - century*(0.000042037+0.0000001267*century)
+	center := sin(meanAnomaly)*(1.914602-century*(0.004817+0.000014*century)) +
+		sin(2*meanAnomaly)*(0.019993-0.000101*century) + sin(3*meanAnomaly)*0.000289
+	apparentLongitude := meanLongitude + center - 0.00569 - 0.00478*sin(125.04-1934.136*century)
+	meanObliquity := 23 + (26+(21.448-century*(46.815+century*(0.00059-century*0.001813)))/60)/60
+	obliquity := meanObliquity + 0.00256*cos(125.04-1934.136*century)
+	declination := degrees(math.Asin(sin(obliquity) * sin(apparentLongitude)))
+
+	y := math.Pow(math.Tan(radians(obliquity/2)), 2)
+	equationOfTime := 4 * degrees(y*sin(2*meanLongitude)-2*eccentricity*sin(meanAnomaly)+
+		4*eccentricity*y*sin(meanAnomaly)*cos(2*meanLongitude)-0.5*y*y*sin(4*meanLongitude)-
+		1.25*eccentricity*eccentricity*sin(2*meanAnomaly))
+	return declination, equationOfTime
+}
+
+// Get hour angle of the sunrise in degrees
+//
+//	out: hour angle; bool - false if the sun doesn't cross the horizon
+func sunriseHourAngle(latitude float64, declination float64) (float64, bool) {
+	cosHourAngle := cos(zenith)/(cos(latitude)*cos(declination)) - math.Tan(radians(latitude))*math.Tan(radians(declination))
+	if cosHourAngle < -1 || cosHourAngle > 1 {
+		return 0, false
+	}
+	return degrees(math.Acos(cosHourAngle)), true
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
+
+func sin(degrees float64) float64 {
+	return math.Sin(radians(degrees))
+}
+
+func cos(degrees float64) float64 {
+	return math.Cos(radians(degrees))
+}
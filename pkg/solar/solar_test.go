@@ -0,0 +1,46 @@
+package solar
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSun(t *testing.T) {
+	tests := []struct {
+		name      string
+		date      time.Time
+		latitude  float64
+		longitude float64
+		sunrise   time.Time
+		sunset    time.Time
+	}{
+		// published sunrise and sunset times, rounded to minutes
+		{"prague summer", time.Date(2023, 6, 21, 0, 0, 0, 0, time.UTC), 50.0755, 14.4378, time.Date(2023, 6, 21, 2, 52, 0, 0, time.UTC), time.Date(2023, 6, 21, 19, 15, 0, 0, time.UTC)},
+		{"prague winter", time.Date(2023, 12, 21, 0, 0, 0, 0, time.UTC), 50.0755, 14.4378, time.Date(2023, 12, 21, 6, 58, 0, 0, time.UTC), time.Date(2023, 12, 21, 15, 2, 0, 0, time.UTC)},
+		{"new york", time.Date(2024, 3, 20, 0, 0, 0, 0, time.UTC), 40.7128, -74.0060, time.Date(2024, 3, 20, 10, 59, 0, 0, time.UTC), time.Date(2024, 3, 20, 23, 9, 0, 0, time.UTC)},
+		{"sydney", time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC), -33.8688, 151.2093, time.Date(2024, 1, 14, 18, 59, 0, 0, time.UTC), time.Date(2024, 1, 15, 9, 9, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		year, month, day := tt.date.Date()
+		sunrise, sunset, ok := Sun(year, month, day, tt.latitude, tt.longitude)
+		if !ok {
+			t.Errorf("%s: Sun() reports no sunrise", tt.name)
+			continue
+		}
+		if diff := sunrise.Sub(tt.sunrise); diff < -time.Minute || diff > time.Minute {
+			t.Errorf("%s: Sun() sunrise = %v, want %v", tt.name, sunrise, tt.sunrise)
+		}
+		if diff := sunset.Sub(tt.sunset); diff < -time.Minute || diff > time.Minute {
+			t.Errorf("%s: Sun() sunset = %v, want %v", tt.name, sunset, tt.sunset)
+		}
+	}
+}
+
+func TestSunPolar(t *testing.T) {
+	// Tromsø, polar night in December and midnight sun in June
+	for _, month := range []time.Month{time.December, time.June} {
+		if sunrise, sunset, ok := Sun(2023, month, 21, 69.6492, 18.9553); ok {
+			t.Errorf("Sun() in %s = %v - %v, want no sunrise or sunset", month, sunrise, sunset)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+// Package status announces service availability and publishes retained JSON status documents over MQTT.
+package status
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Availability payloads
+const (
+	Online  = "online"
+	Offline = "offline"
+)
+
+// QOS of availability and status messages, dashboards need them delivered
+const QOS = 1
+
+// PublishTimeout limits waiting for the broker to acknowledge a message, the client keeps QOS 1 messages while it
+// reconnects and callers may hold their locks
+const PublishTimeout = 5 * time.Second
+
+// AvailabilityTopic returns availability topic of the service
+func AvailabilityTopic(serviceTopic string) string {
+	return serviceTopic + "/availability"
+}
+
+// SetWill makes the broker announce the service offline when the connection is lost unexpectedly
+func SetWill(opts *MQTT.ClientOptions, serviceTopic string) *MQTT.ClientOptions {
+	return opts.SetWill(AvailabilityTopic(serviceTopic), Offline, QOS, true)
+}
+
+// PublishAvailability publishes retained service availability
+func PublishAvailability(client MQTT.Client, serviceTopic string, availability string) error {
+	return wait(client.Publish(AvailabilityTopic(serviceTopic), QOS, true, availability))
+}
+
+// Publish retained message of the status topic, the message isn't queued while the client is disconnected, documents
+// are published again after reconnect
+func publish(client MQTT.Client, topic string, payload interface{}) error {
+	if !client.IsConnectionOpen() {
+		return errors.New("not connected to the broker")
+	}
+	return wait(client.Publish(topic, QOS, true, payload))
+}
+
+// Wait for the publish at most PublishTimeout
+func wait(token MQTT.Token) error {
+	if !token.WaitTimeout(PublishTimeout) {
+		return fmt.Errorf("not acknowledged by the broker in %s", PublishTimeout)
+	}
+	return token.Error()
+}
+
+// Publisher publishes retained JSON documents, unchanged documents aren't published again
+type Publisher struct {
+	mu   sync.Mutex
+	last map[string]string // key: topic, value: last published document
+}
+
+func NewPublisher() *Publisher {
+	return &Publisher{last: map[string]string{}}
+}
+
+// Publish publishes document to the topic when it differs from the last published one
+func (p *Publisher) Publish(client MQTT.Client, topic string, doc interface{}) error {
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.last[topic] == string(data) {
+		return nil
+	}
+
+	if err := publish(client, topic, data); err != nil {
+		return err
+	}
+	p.last[topic] = string(data)
+	return nil
+}
+
+// Clear removes retained document of the topic
+func (p *Publisher) Clear(client MQTT.Client, topic string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err := publish(client, topic, []byte{}); err != nil {
+		return err
+	}
+	delete(p.last, topic)
+	return nil
+}
+
+// Reset forgets published documents, so they are published again (eg. after reconnect)
+func (p *Publisher) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.last = map[string]string{}
+}
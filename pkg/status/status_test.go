@@ -0,0 +1,62 @@
+package status
+
+import (
+	"testing"
+
+	MQTT "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/jacfal.io/homeaut/pkg/mqtttest"
+)
+
+func TestPublisherSkipsUnchangedDocuments(t *testing.T) {
+	client := mqtttest.NewClient()
+	publisher := NewPublisher()
+
+	for _, doc := range []map[string]int{{"temperature": 20}, {"temperature": 20}, {"temperature": 21}} {
+		if err := publisher.Publish(client, "trv1/tsc/status", doc); err != nil {
+			t.Fatalf("Publish() error = %v", err)
+		}
+	}
+
+	published := client.PublishedTo("trv1/tsc/status")
+	if len(published) != 2 || published[0] != `{"temperature":20}` || published[1] != `{"temperature":21}` {
+		t.Errorf("Publish() published = %v", published)
+	}
+	if !client.Published[0].Retained {
+		t.Errorf("Publish() status should be retained")
+	}
+
+	publisher.Reset()
+	publisher.Publish(client, "trv1/tsc/status", map[string]int{"temperature": 21})
+	if len(client.PublishedTo("trv1/tsc/status")) != 3 {
+		t.Errorf("Publish() should publish again after Reset()")
+	}
+}
+
+// disconnectedClient is a client reconnecting to the broker
+type disconnectedClient struct {
+	*mqtttest.Client
+}
+
+func (c disconnectedClient) IsConnectionOpen() bool { return false }
+
+func TestPublisherDisconnected(t *testing.T) {
+	client := mqtttest.NewClient()
+	publisher := NewPublisher()
+
+	var disconnected MQTT.Client = disconnectedClient{client}
+	if err := publisher.Publish(disconnected, "trv1/tsc/status", map[string]int{"temperature": 20}); err == nil {
+		t.Errorf("Publish() should fail while disconnected")
+	}
+	if err := publisher.Clear(disconnected, "trv1/tsc/status"); err == nil {
+		t.Errorf("Clear() should fail while disconnected")
+	}
+	if len(client.Published) != 0 {
+		t.Errorf("nothing should be queued while disconnected, published = %v", client.Published)
+	}
+
+	// the document is published once connected
+	if err := publisher.Publish(client, "trv1/tsc/status", map[string]int{"temperature": 20}); err != nil || len(client.PublishedTo("trv1/tsc/status")) != 1 {
+		t.Errorf("Publish() should publish once connected, err = %v", err)
+	}
+}
@@ -0,0 +1,203 @@
+// Package store persists service state (last readings, published setpoints, overrides, manual holds, heating profiles,
+// schedule exceptions, learned warm-ups, pair status) in a single JSON file.
+//
+// Changes are kept in memory and written atomically by Flush, so a crash never leaves a partially written file.
+// Store opened with an empty path keeps the state in memory only.
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/jacfal.io/homeaut/pkg/config"
+)
+
+// Reading is the last value received from a sensor
+type Reading struct {
+	Temperature float32   `json:"temperature"`
+	Time        time.Time `json:"time"`
+}
+
+// Setpoint is the last temperature published to a TRV
+type Setpoint struct {
+	Temperature float64   `json:"temperature"`
+	Time        time.Time `json:"time"`
+}
+
+// Override is a temporary setpoint taking precedence over the schedule
+type Override struct {
+	Temperature float64   `json:"temperature"`
+	Until       time.Time `json:"until"`
+	Created     time.Time `json:"created"`
+}
+
+// Hold is a manual setpoint change on the TRV the schedule keeps until it ends
+type Hold struct {
+	Temperature float64   `json:"temperature"`
+	Until       time.Time `json:"until"`
+	Created     time.Time `json:"created"`
+}
+
+// Exception is a date range replacing the weekly schedule, added at runtime
+type Exception struct {
+	Name        string   `json:"name,omitempty"`
+	From        string   `json:"from"`                  // first day, 2006-01-02
+	To          string   `json:"to,omitempty"`          // last day (inclusive), the first day when empty
+	Program     string   `json:"program,omitempty"`     // day program used on the days
+	Profile     string   `json:"profile,omitempty"`     // profile used on the days
+	Temperature *float64 `json:"temperature,omitempty"` // constant temperature of the days
+}
+
+// WarmUp is a measured warm-up of a room, learned by optimum start
+type WarmUp struct {
+	Time    time.Time `json:"time"`              // the room reached the setpoint
+	Rise    float64   `json:"rise"`              // °C
+	Rate    float64   `json:"rate"`              // °C per hour
+	Outdoor *float64  `json:"outdoor,omitempty"` // outdoor temperature at the start, unknown when empty
+}
+
+// PairStatus is the state of a Sensor --> TRV tandem
+type PairStatus struct {
+	TrvTopic             string    `json:"trv-topic"`
+	Assembled            bool      `json:"assembled"`
+	ForwardedTemperature float32   `json:"forwarded-temperature"`
+	LastForward          time.Time `json:"last-forward"`
+}
+
+// State is the persisted content
+type State struct {
+	Readings   map[string]Reading     `json:"readings,omitempty"`   // key: sensor topic
+	Setpoints  map[string]Setpoint    `json:"setpoints,omitempty"`  // key: TRV topic
+	Overrides  map[string]Override    `json:"overrides,omitempty"`  // key: TRV topic
+	Holds      map[string]Hold        `json:"holds,omitempty"`      // key: TRV topic
+	Pairs      map[string]PairStatus  `json:"pairs,omitempty"`      // key: sensor topic
+	Profile    string                 `json:"profile,omitempty"`    // active heating profile switched at runtime
+	Profiles   map[string]string      `json:"profiles,omitempty"`   // key: TRV topic, profile of the room
+	Exceptions map[string][]Exception `json:"exceptions,omitempty"` // key: TRV topic
+	WarmUps    map[string][]WarmUp    `json:"warm-ups,omitempty"`   // key: TRV topic, latest warm-ups of the room
+}
+
+type Store struct {
+	path  string
+	mu    sync.Mutex
+	state State
+	dirty bool
+}
+
+// NewMemoryStore creates store keeping the state in memory only
+func NewMemoryStore() *Store {
+	s := &Store{}
+	s.state.init()
+	return s
+}
+
+// Open loads the state file, missing file means empty state
+func Open(path string) (*Store, error) {
+	if path == "" {
+		return NewMemoryStore(), nil
+	}
+	s := &Store{path: path}
+	s.state.init()
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("State file %s doesn't exist, starting with empty state", path)
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.state); err != nil {
+		return nil, fmt.Errorf("invalid state file %s: %w", path, err)
+	}
+	s.state.init()
+	return s, nil
+}
+
+func (state *State) init() {
+	if state.Readings == nil {
+		state.Readings = map[string]Reading{}
+	}
+	if state.Setpoints == nil {
+		state.Setpoints = map[string]Setpoint{}
+	}
+	if state.Overrides == nil {
+		state.Overrides = map[string]Override{}
+	}
+	if state.Holds == nil {
+		state.Holds = map[string]Hold{}
+	}
+	if state.Pairs == nil {
+		state.Pairs = map[string]PairStatus{}
+	}
+	if state.Profiles == nil {
+		state.Profiles = map[string]string{}
+	}
+	if state.Exceptions == nil {
+		state.Exceptions = map[string][]Exception{}
+	}
+	if state.WarmUps == nil {
+		state.WarmUps = map[string][]WarmUp{}
+	}
+}
+
+// View calls fn with the current state, the state must not be modified or retained
+func (s *Store) View(fn func(state *State)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.state)
+}
+
+// Update calls fn to modify the state, fn reports whether it changed the state, changes are written by the next Flush
+func (s *Store) Update(fn func(state *State) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fn(&s.state) {
+		s.dirty = true
+	}
+}
+
+// Flush writes the state file when the state has changed since the last flush
+func (s *Store) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.dirty || s.path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := config.WriteFileAtomic(s.path, data, 0o600); err != nil {
+		return err
+	}
+	s.dirty = false
+	return nil
+}
+
+// AutoFlush flushes the state on the interval until the context is done
+func (s *Store) AutoFlush(ctx context.Context, interval time.Duration) {
+	if s.path == "" {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := s.Flush(); err != nil {
+					log.Printf("Error! State flush failed (%s): %v", s.path, err)
+				}
+			}
+		}
+	}()
+}
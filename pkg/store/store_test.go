@@ -0,0 +1,94 @@
+package store
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStoreFlushAndReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	readingTime := time.Date(2023, 2, 4, 12, 0, 0, 0, time.UTC)
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() of missing file error = %v", err)
+	}
+	s.Update(func(state *State) bool {
+		state.Readings["sensor1"] = Reading{Temperature: 21.5, Time: readingTime}
+		state.Setpoints["trv1"] = Setpoint{Temperature: 20.5, Time: readingTime}
+		return true
+	})
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	reopened.View(func(state *State) {
+		if reading := state.Readings["sensor1"]; reading.Temperature != 21.5 || !reading.Time.Equal(readingTime) {
+			t.Errorf("Open() reading = %v", reading)
+		}
+		if setpoint := state.Setpoints["trv1"]; setpoint.Temperature != 20.5 {
+			t.Errorf("Open() setpoint = %v", setpoint)
+		}
+		if state.Overrides == nil || state.Holds == nil || state.Pairs == nil || state.Profiles == nil || state.Exceptions == nil || state.WarmUps == nil {
+			t.Errorf("Open() should initialize all state maps")
+		}
+	})
+}
+
+func TestStoreInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{ invalid"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Errorf("Open() of invalid file should fail")
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	s, err := Open("")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	s.Update(func(state *State) bool {
+		state.Readings["sensor1"] = Reading{Temperature: 21.5}
+		return true
+	})
+	if err := s.Flush(); err != nil {
+		t.Errorf("Flush() of memory store error = %v", err)
+	}
+}
+
+func TestStoreUnchangedNotFlushed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	s.Update(func(state *State) bool {
+		return false
+	})
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Flush() shouldn't write unchanged state, stat error = %v", err)
+	}
+
+	s.Update(func(state *State) bool {
+		state.Readings["sensor1"] = Reading{Temperature: 21.5}
+		return true
+	})
+	if err := s.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Errorf("Flush() should write changed state, stat error = %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"encoding/json"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestDurationUnmarshal(t *testing.T) {
+	testData := map[string]time.Duration{
+		`"15m"`:   15 * time.Minute,
+		`"1h30m"`: 90 * time.Minute,
+		`90`:      90 * time.Second,
+		`0.5`:     500 * time.Millisecond,
+	}
+
+	for data, expected := range testData {
+		var d Duration
+		if err := json.Unmarshal([]byte(data), &d); err != nil {
+			log.Fatalf("Duration unmarshal failed (%s): %v", data, err)
+		}
+		if d.Duration() != expected {
+			log.Fatalf("Duration unmarshal failed (%s), expected: %s, got: %s", data, expected, d)
+		}
+	}
+
+	for _, data := range []string{`"15 minutes"`, `"-5m"`, `true`} {
+		var d Duration
+		if err := json.Unmarshal([]byte(data), &d); err == nil {
+			log.Fatalf("Duration unmarshal should fail (%s)", data)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// APIError is an error of the HTTP API request answered with the status
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func NewAPIError(status int, message string) *APIError {
+	return &APIError{Status: status, Message: message}
+}
+
+func (e *APIError) Error() string {
+	return e.Message
+}
+
+// StartHTTPServer serves handler on addr in background
+//
+//	out: clean up operation shutting the server down
+func StartHTTPServer(addr string, handler http.Handler) Operation {
+	server := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		log.Printf("HTTP server listening on %s", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Error! HTTP server (%s) failed: %v", addr, err)
+		}
+	}()
+
+	return func(ctx context.Context) error {
+		return server.Shutdown(ctx)
+	}
+}
+
+// WriteJSON writes v as JSON response with the status
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error! Can't write API response: %v", err)
+	}
+}
+
+// WriteError writes {"error": "..."} response, status of APIError or 500 for other errors
+func WriteError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		status = apiErr.Status
+	}
+	WriteJSON(w, status, map[string]string{"error": err.Error()})
+}
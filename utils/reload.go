@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// WatchReload calls reload on SIGHUP and, when pollInterval is set, on every change of the watched file
+func WatchReload(ctx context.Context, path string, pollInterval time.Duration, reload func()) {
+	go func() {
+		s := make(chan os.Signal, 1)
+		signal.Notify(s, syscall.SIGHUP)
+		defer signal.Stop(s)
+
+		var poll <-chan time.Time
+		if path != "" && pollInterval > 0 {
+			ticker := time.NewTicker(pollInterval)
+			defer ticker.Stop()
+			poll = ticker.C
+		}
+		lastModified := fileModified(path)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-s:
+				log.Println("reload requested")
+				lastModified = fileModified(path)
+				reload()
+			case <-poll:
+				if modified := fileModified(path); modified != lastModified {
+					log.Printf("%s has changed, reloading", path)
+					lastModified = modified
+					reload()
+				}
+			}
+		}
+	}()
+}
+
+// fileState is a file modification time and size, zero value when file can't be read
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func fileModified(path string) fileState {
+	if path == "" {
+		return fileState{}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{modTime: info.ModTime(), size: info.Size()}
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatchReloadOnFileChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("a: 1"), 0o644); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reloaded := make(chan struct{}, 1)
+	WatchReload(ctx, path, 10*time.Millisecond, func() { reloaded <- struct{}{} })
+
+	time.Sleep(30 * time.Millisecond)
+	if err := os.WriteFile(path, []byte("a: 12"), 0o644); err != nil {
+		log.Fatal(err)
+	}
+
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		log.Fatal("WatchReload didn't call reload after file change")
+	}
+}
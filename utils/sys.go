@@ -21,7 +21,7 @@ func GracefulShutdown(ctx context.Context, timeout time.Duration, ops map[string
 		s := make(chan os.Signal, 1)
 
 		// add any other syscalls that you want to be notified with
-		signal.Notify(s, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+		signal.Notify(s, syscall.SIGINT, syscall.SIGTERM)
 		<-s
 
 		log.Println("shutting down")